@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/metrics"
+	"github.com/lokeshllkumar/flux/registration"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reports the state of a registrar; implemented by *registration.Registrar
+type StatusReporter interface {
+	Status() registration.Status
+	Ready() bool
+}
+
+// option for configuring a Server
+type Option func(*Server)
+
+// serves metrics from the given gatherer instead of the default Prometheus registry
+func WithGatherer(gatherer prometheus.Gatherer) Option {
+	return func(s *Server) {
+		s.gatherer = gatherer
+	}
+}
+
+// reports the given registrars on /readyz and /flux/status
+func WithRegistrars(registrars ...StatusReporter) Option {
+	return func(s *Server) {
+		s.sources = append(s.sources, func() []StatusReporter { return registrars })
+	}
+}
+
+// reports the registrars returned by registrars on every request, for processes whose registrars come and go
+func WithRegistrarsFunc(registrars func() []StatusReporter) Option {
+	return func(s *Server) {
+		s.sources = append(s.sources, registrars)
+	}
+}
+
+// adds a check that must pass for /readyz to report the service ready
+func WithReadinessCheck(name string, check func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.checks = append(s.checks, readinessCheck{name: name, check: check})
+	}
+}
+
+// a named readiness check
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// HTTP server for a service's admin endpoints
+// - /metrics serves Prometheus metrics
+// - /healthz reports that the process is up
+// - /readyz reports whether every registrar is registered and every readiness check passes
+// - /debug/pprof/ serves runtime profiles
+// - /flux/status dumps the state of every registrar as JSON
+type Server struct {
+	addr     string
+	gatherer prometheus.Gatherer
+	sources  []func() []StatusReporter
+	checks   []readinessCheck
+	handler  http.Handler
+	mu       sync.Mutex
+	server   *http.Server
+	closed   bool
+}
+
+// creates a new Server listening on addr, e.g. ":9090"
+func NewServer(addr string, opts ...Option) *Server {
+	s := &Server{addr: addr}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	if s.gatherer != nil {
+		mux.Handle("/metrics", metrics.HandlerFor(s.gatherer))
+	} else {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.HandleFunc("/flux/status", s.handleStatus)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.handler = mux
+
+	return s
+}
+
+// returns the handler serving the admin endpoints, for mounting on an existing server
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// listens on the server's address and serves the admin endpoints until Shutdown is called
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("admin: failed to listen on %s: %w", s.addr, err)
+	}
+	return s.Serve(listener)
+}
+
+// serves the admin endpoints on the given listener until Shutdown is called
+// a server cannot be reused once shut down; Serve then closes the listener and returns an error wrapping http.ErrServerClosed
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return fmt.Errorf("admin: server already shut down: %w", http.ErrServerClosed)
+	}
+	if s.server == nil {
+		s.server = &http.Server{Handler: s.handler, ReadHeaderTimeout: 10 * time.Second}
+	}
+	server := s.server
+	s.mu.Unlock()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("admin: server failed: %w", err)
+	}
+	return nil
+}
+
+// gracefully stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	s.closed = true
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// returns the registrars currently reported by the server
+func (s *Server) registrars() []StatusReporter {
+	var registrars []StatusReporter
+	for _, source := range s.sources {
+		registrars = append(registrars, source()...)
+	}
+	return registrars
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	var failures []string
+	for _, registrar := range s.registrars() {
+		if !registrar.Ready() {
+			status := registrar.Status()
+			failures = append(failures, fmt.Sprintf("registrar %s (%s): %s", status.Instance.ID, status.Instance.ServiceName, status.State))
+		}
+	}
+	for _, c := range s.checks {
+		if err := c.check(r.Context()); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, failure := range failures {
+			fmt.Fprintln(w, failure)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	registrars := s.registrars()
+	statuses := make([]registration.Status, 0, len(registrars))
+	for _, registrar := range registrars {
+		statuses = append(statuses, registrar.Status())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(struct {
+		Registrars []registration.Status `json:"registrars"`
+	}{statuses}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,173 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registration"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	return listener
+}
+
+func TestServeAfterShutdownFails(t *testing.T) {
+	s := NewServer("", WithGatherer(prometheus.NewRegistry()))
+	listener := listen(t)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+
+	url := "http://" + listener.Addr().String() + "/healthz"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "ok\n" {
+				t.Fatalf("unexpected /healthz body %q", body)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not come up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("expected Serve to return cleanly on shutdown, got %v", err)
+	}
+
+	second := listen(t)
+	if err := s.Serve(second); !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected serving a shut down server to fail with http.ErrServerClosed, got %v", err)
+	}
+	if _, err := second.Accept(); err == nil {
+		t.Fatal("expected the listener to be closed")
+	}
+}
+
+func TestServeAfterShutdownBeforeStartFails(t *testing.T) {
+	s := NewServer("", WithGatherer(prometheus.NewRegistry()))
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := s.Serve(listen(t)); !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected http.ErrServerClosed, got %v", err)
+	}
+}
+
+// starts an HTTP registry answering registrations with the given status code
+func startRegistry(t *testing.T, registerStatus int) string {
+	t.Helper()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/services/register" {
+			w.WriteHeader(registerStatus)
+		}
+	}))
+	t.Cleanup(registry.Close)
+	return registry.URL
+}
+
+func newTestRegistrar(t *testing.T, registryURL string, instance api.ServiceInstance) *registration.Registrar {
+	t.Helper()
+	cfg := registration.NewDefaultConfig()
+	cfg.RegistryURL = registryURL
+	cfg.RetryDelay = time.Millisecond
+	r, err := registration.NewRegistrar(instance, cfg)
+	if err != nil {
+		t.Fatalf("failed to create registrar: %v", err)
+	}
+	t.Cleanup(func() { r.Stop(context.Background()) })
+	return r
+}
+
+// serves a request for path on the server's handler, returning the response
+func get(s *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestReadyzReportsRegistration(t *testing.T) {
+	registrar := newTestRegistrar(t, startRegistry(t, http.StatusCreated), api.ServiceInstance{ID: "billing-1", ServiceName: "billing"})
+	s := NewServer("", WithGatherer(prometheus.NewRegistry()), WithRegistrars(registrar))
+
+	rec := get(s, "/readyz")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before the registrar has registered, got %d %s", rec.Code, rec.Body)
+	}
+	if body := rec.Body.String(); body != "registrar billing-1 (billing): idle\n" {
+		t.Fatalf("expected the registrar to be reported as not ready, got %q", body)
+	}
+
+	registrar.Start(context.Background())
+	if rec := get(s, "/readyz"); rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Fatalf("expected 200 once the registrar has registered, got %d %q", rec.Code, rec.Body)
+	}
+
+	s = NewServer("", WithGatherer(prometheus.NewRegistry()), WithRegistrars(registrar),
+		WithReadinessCheck("database", func(ctx context.Context) error { return errors.New("connection refused") }))
+	if rec := get(s, "/readyz"); rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "database: connection refused\n" {
+		t.Fatalf("expected a failing readiness check to be reported, got %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestStatusReportsRegistrars(t *testing.T) {
+	registered := newTestRegistrar(t, startRegistry(t, http.StatusCreated), api.ServiceInstance{ID: "billing-1", ServiceName: "billing"})
+	rejected := newTestRegistrar(t, startRegistry(t, http.StatusBadRequest), api.ServiceInstance{ID: "search-1", ServiceName: "search"})
+	registered.Start(context.Background())
+	rejected.Start(context.Background())
+
+	rec := get(NewServer("", WithGatherer(prometheus.NewRegistry()), WithRegistrars(registered, rejected)), "/flux/status")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON status, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var status struct {
+		Registrars []struct {
+			Instance     api.ServiceInstance `json:"instance"`
+			State        string              `json:"state"`
+			RecentErrors []struct {
+				Time      time.Time `json:"time"`
+				Operation string    `json:"operation"`
+				Error     string    `json:"error"`
+			} `json:"recentErrors"`
+		} `json:"registrars"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode status %s: %v", rec.Body, err)
+	}
+	if len(status.Registrars) != 2 {
+		t.Fatalf("expected both registrars, got %s", rec.Body)
+	}
+
+	first := status.Registrars[0]
+	if first.Instance.ID != "billing-1" || first.Instance.ServiceName != "billing" || first.State != "registered" || len(first.RecentErrors) != 0 {
+		t.Fatalf("expected billing-1 to be registered without errors, got %+v", first)
+	}
+	second := status.Registrars[1]
+	if second.Instance.ID != "search-1" || second.State != "unregistered" {
+		t.Fatalf("expected search-1 to be unregistered, got %+v", second)
+	}
+	if len(second.RecentErrors) != 1 || second.RecentErrors[0].Operation != "register" || second.RecentErrors[0].Error == "" || second.RecentErrors[0].Time.IsZero() {
+		t.Fatalf("expected the rejected registration to be listed among the recent errors, got %+v", second.RecentErrors)
+	}
+}
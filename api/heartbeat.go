@@ -0,0 +1,23 @@
+package api
+
+// request body for a batched heartbeat covering several service instances
+type HeartbeatsRequest struct {
+	InstanceIDs []string `json:"instanceIds"`
+}
+
+// outcome of a single instance's heartbeat within a batched heartbeat call
+type HeartbeatResult struct {
+	InstanceID string `json:"instanceId"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message,omitempty"`
+	// renewed lease TTL, zero when the registry does not grant leases
+	TTLSeconds   int64 `json:"ttlSeconds,omitempty"`
+	LeaseExpired bool  `json:"leaseExpired,omitempty"`
+	// set when the registry has no record of the instance, e.g. after losing its state on restart
+	NotRegistered bool `json:"notRegistered,omitempty"`
+}
+
+// response body for a batched heartbeat, holding one result per requested instance
+type HeartbeatsResponse struct {
+	Results []HeartbeatResult `json:"results"`
+}
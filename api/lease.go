@@ -0,0 +1,15 @@
+package api
+
+import "time"
+
+// lease granted by the service registry on registration and renewed by heartbeats
+// a zero TTL means the registry does not grant leases and the client's own heartbeat interval applies
+type Lease struct {
+	ID         string `json:"leaseId"`
+	TTLSeconds int64  `json:"ttlSeconds"`
+}
+
+// returns the lease's time-to-live as a duration
+func (l Lease) TTL() time.Duration {
+	return time.Duration(l.TTLSeconds) * time.Second
+}
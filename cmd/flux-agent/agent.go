@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/admin"
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registration"
+)
+
+// how long stopping a registrar may take, including its deregistration
+const stopTimeout = 10 * time.Second
+
+// runs one registrar per configured instance and keeps them in line with the configuration
+type agent struct {
+	ctx        context.Context // outlives reloads, cancelled when the agent shuts down
+	logger     *slog.Logger
+	applyMu    sync.Mutex // serialises reloads and shutdown, held while registrars stop
+	mu         sync.Mutex // guards registry and registrars, never held while registrars stop
+	registry   registryConfig
+	registrars map[string]*managedRegistrar // by instance ID
+}
+
+// registrar run by the agent, along with the instance definition it was created from
+type managedRegistrar struct {
+	instance  api.ServiceInstance
+	registrar *registration.Registrar
+	cancel    context.CancelFunc // cancels the registrar's context, cutting short an initial registration still retrying
+	started   chan struct{}      // closed once Start has returned
+}
+
+func newAgent(ctx context.Context, logger *slog.Logger) *agent {
+	return &agent{
+		ctx:        ctx,
+		logger:     logger,
+		registrars: map[string]*managedRegistrar{},
+	}
+}
+
+// brings the running registrars in line with cfg: registrars of removed or changed instances are stopped, those of new or changed ones started
+// a change to the registry settings restarts every registrar
+// every new registrar is created before anything is changed, so a configuration that fails leaves the running one untouched. The new
+// registrars are swapped in under the lock and only started once the old ones have stopped outside it, since a changed instance keeps its ID
+// and the old registrar's deregistration would otherwise remove the new registration
+func (a *agent) apply(cfg *agentConfig) error {
+	a.applyMu.Lock()
+	defer a.applyMu.Unlock()
+
+	// registrars only change under applyMu, so they can be read here without mu
+	var stop []*managedRegistrar
+	wanted := make(map[string]api.ServiceInstance, len(cfg.Instances))
+	for _, instance := range cfg.Instances {
+		wanted[instance.ID] = instance
+	}
+	registryChanged := cfg.Registry != a.registry
+	for id, managed := range a.registrars {
+		if instance, ok := wanted[id]; registryChanged || !ok || instance != managed.instance {
+			stop = append(stop, managed)
+		}
+	}
+
+	var start []*managedRegistrar
+	for _, instance := range cfg.Instances {
+		if managed, ok := a.registrars[instance.ID]; ok && !slices.Contains(stop, managed) {
+			continue
+		}
+		registrar, err := registration.NewRegistrar(instance, registrationConfig(cfg.Registry, instance, a.logger))
+		if err != nil {
+			a.discard(start)
+			return fmt.Errorf("failed to create registrar for instance %s: %w", instance.ID, err)
+		}
+		start = append(start, &managedRegistrar{instance: instance, registrar: registrar, started: make(chan struct{})})
+	}
+
+	a.mu.Lock()
+	for _, managed := range stop {
+		delete(a.registrars, managed.instance.ID)
+	}
+	for _, managed := range start {
+		a.registrars[managed.instance.ID] = managed
+	}
+	a.registry = cfg.Registry
+	instances := len(a.registrars)
+	a.mu.Unlock()
+
+	a.stop(stop)
+	for _, managed := range start {
+		a.start(managed)
+	}
+
+	a.logger.Info("configuration applied", "instances", instances, "started", len(start), "stopped", len(stop))
+	return nil
+}
+
+// starts a registrar in the background, since its initial registration retries with backoff and would otherwise hold up a reload
+func (a *agent) start(managed *managedRegistrar) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	managed.cancel = cancel
+	go func() {
+		defer close(managed.started)
+		managed.registrar.Start(ctx)
+	}()
+}
+
+// releases registrars created for a configuration that failed to apply; they were never started, so nothing is deregistered
+func (a *agent) discard(registrars []*managedRegistrar) {
+	for _, managed := range registrars {
+		managed.registrar.Stop(context.Background())
+	}
+}
+
+// returns the registrar config for an instance of the given registry, checking the instance's health endpoint when it has one
+func registrationConfig(registry registryConfig, instance api.ServiceInstance, logger *slog.Logger) *registration.Config {
+	cfg := registration.NewDefaultConfig()
+	cfg.RegistryURL = registry.URL
+	cfg.RegistryType = registry.Type
+	if registry.HeartbeatInterval > 0 {
+		cfg.HeartbeatInterval = time.Duration(registry.HeartbeatInterval)
+		if cfg.MaxHeartbeatInterval < cfg.HeartbeatInterval {
+			cfg.MaxHeartbeatInterval = cfg.HeartbeatInterval
+		}
+	}
+	if registry.CallTimeout > 0 {
+		cfg.CallTimeout = time.Duration(registry.CallTimeout)
+	}
+	if url := healthCheckURL(instance); url != "" {
+		cfg.HealthCheck = registration.HTTPHealthCheck(url, &http.Client{Timeout: cfg.CallTimeout})
+	}
+	cfg.Logger = logger
+	return cfg
+}
+
+// stops the given registrars concurrently, deregistering their instances
+func (a *agent) stop(registrars []*managedRegistrar) {
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, managed := range registrars {
+		wg.Add(1)
+		go func(managed *managedRegistrar) {
+			defer wg.Done()
+			// a registrar still registering would otherwise register its instance again after being stopped
+			managed.cancel()
+			<-managed.started
+			managed.registrar.Stop(ctx)
+		}(managed)
+	}
+	wg.Wait()
+}
+
+// stops every registrar
+func (a *agent) shutdown() {
+	a.applyMu.Lock()
+	defer a.applyMu.Unlock()
+
+	a.mu.Lock()
+	stop := make([]*managedRegistrar, 0, len(a.registrars))
+	for id, managed := range a.registrars {
+		stop = append(stop, managed)
+		delete(a.registrars, id)
+	}
+	a.mu.Unlock()
+
+	a.stop(stop)
+}
+
+// returns the running registrars ordered by instance ID, for the admin server
+func (a *agent) statusReporters() []admin.StatusReporter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ids := make([]string, 0, len(a.registrars))
+	for id := range a.registrars {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	reporters := make([]admin.StatusReporter, 0, len(ids))
+	for _, id := range ids {
+		reporters = append(reporters, a.registrars[id].registrar)
+	}
+	return reporters
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// HTTP registry recording the calls it receives; deregistrations wait on block when it is set
+type fakeRegistry struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string
+	block chan struct{}
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+	r := &fakeRegistry{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.calls = append(r.calls, req.Method+" "+req.URL.Path)
+		block := r.block
+		r.mu.Unlock()
+		if block != nil && req.Method == http.MethodDelete {
+			<-block
+		}
+		if req.URL.Path == "/api/v1/services/register" {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRegistry) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func newTestAgent(t *testing.T) *agent {
+	t.Helper()
+	a := newAgent(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(a.shutdown)
+	return a
+}
+
+func testConfig(registry *fakeRegistry, instances ...api.ServiceInstance) *agentConfig {
+	return &agentConfig{
+		Registry:  registryConfig{URL: registry.URL, Type: "http", CallTimeout: duration(5 * time.Second)},
+		Instances: instances,
+	}
+}
+
+// waits until every registrar run by the agent is registered
+func waitReady(t *testing.T, a *agent) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ready := true
+		for _, reporter := range a.statusReporters() {
+			ready = ready && reporter.Ready()
+		}
+		if ready {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("registrars did not register in time")
+}
+
+func reportedIDs(a *agent) []string {
+	var ids []string
+	for _, reporter := range a.statusReporters() {
+		ids = append(ids, reporter.Status().Instance.ID)
+	}
+	return ids
+}
+
+func TestApplyFailureLeavesRunningConfigUntouched(t *testing.T) {
+	registry := newFakeRegistry(t)
+	a := newTestAgent(t)
+	instance := api.ServiceInstance{ID: "i1", ServiceName: "svc", Host: "10.0.0.1", Port: 8000}
+
+	if err := a.apply(testConfig(registry, instance)); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	waitReady(t, a)
+
+	bad := testConfig(registry, instance, api.ServiceInstance{ID: "i2", ServiceName: "svc"})
+	bad.Registry.Type = "unknown"
+	if err := a.apply(bad); err == nil {
+		t.Fatal("expected a config with an unknown registry type to fail")
+	}
+
+	if ids := reportedIDs(a); !slices.Equal(ids, []string{"i1"}) {
+		t.Fatalf("expected the running registrar to be kept, got %v", ids)
+	}
+	if calls := registry.recorded(); slices.Contains(calls, "DELETE /api/v1/services/deregister/i1") {
+		t.Fatalf("expected the running instance to stay registered, got calls %v", calls)
+	}
+	if a.registry.Type != "http" {
+		t.Fatalf("expected the registry settings to be kept, got type %q", a.registry.Type)
+	}
+}
+
+func TestApplyDeregistersChangedInstanceBeforeRegisteringItAgain(t *testing.T) {
+	registry := newFakeRegistry(t)
+	a := newTestAgent(t)
+	instance := api.ServiceInstance{ID: "i1", ServiceName: "svc", Host: "10.0.0.1", Port: 8000}
+
+	if err := a.apply(testConfig(registry, instance)); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	waitReady(t, a)
+
+	instance.Port = 8001
+	if err := a.apply(testConfig(registry, instance)); err != nil {
+		t.Fatalf("failed to apply changed config: %v", err)
+	}
+	waitReady(t, a)
+
+	var lifecycle []string
+	for _, call := range registry.recorded() {
+		if call == "POST /api/v1/services/register" || call == "DELETE /api/v1/services/deregister/i1" {
+			lifecycle = append(lifecycle, call)
+		}
+	}
+	want := []string{"POST /api/v1/services/register", "DELETE /api/v1/services/deregister/i1", "POST /api/v1/services/register"}
+	if !slices.Equal(lifecycle, want) {
+		t.Fatalf("expected calls %v, got %v", want, lifecycle)
+	}
+}
+
+func TestStatusIsServedWhileRegistrarsStop(t *testing.T) {
+	registry := newFakeRegistry(t)
+	a := newTestAgent(t)
+
+	if err := a.apply(testConfig(registry, api.ServiceInstance{ID: "i1", ServiceName: "svc", Host: "10.0.0.1", Port: 8000})); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	waitReady(t, a)
+
+	block := make(chan struct{})
+	registry.mu.Lock()
+	registry.block = block
+	registry.mu.Unlock()
+
+	applied := make(chan error, 1)
+	go func() { applied <- a.apply(testConfig(registry)) }()
+
+	// the removed registrar is stuck deregistering, the status must still be served without it
+	deadline := time.Now().Add(5 * time.Second)
+	for len(reportedIDs(a)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("status kept reporting the removed registrar")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-applied:
+		t.Fatalf("expected apply to wait for the deregistration, returned %v", err)
+	default:
+	}
+
+	close(block)
+	if err := <-applied; err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+}
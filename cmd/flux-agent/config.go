@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+// agent configuration, read from a JSON file or assembled from flags
+//
+//	{
+//	  "registry": {"url": "http://registry:8080", "type": "http", "heartbeatInterval": "10s", "callTimeout": "5s"},
+//	  "adminAddr": ":9090",
+//	  "instances": [
+//	    {"id": "billing-1", "serviceName": "billing", "host": "10.0.0.7", "port": 8000, "healthPath": "/health"}
+//	  ]
+//	}
+type agentConfig struct {
+	Registry registryConfig `json:"registry"`
+	// address of the admin server exposing metrics, health and status; the admin server is not started when empty
+	AdminAddr string                `json:"adminAddr"`
+	Instances []api.ServiceInstance `json:"instances"`
+}
+
+// how the agent reaches the registry; changing any of it restarts every registrar
+type registryConfig struct {
+	URL               string   `json:"url"`
+	Type              string   `json:"type"`
+	HeartbeatInterval duration `json:"heartbeatInterval"`
+	CallTimeout       duration `json:"callTimeout"`
+}
+
+// time.Duration read from JSON either as a Go duration string such as "10s" or as a number of seconds
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		*d = duration(parsed)
+	case float64:
+		*d = duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration %s, must be a string such as \"10s\" or a number of seconds", data)
+	}
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// reads and validates the agent configuration at path
+func loadConfig(path string) (*agentConfig, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	var cfg agentConfig
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return &cfg, data, nil
+}
+
+// checks that the configuration describes a usable registry and uniquely identified instances
+func (c *agentConfig) validate() error {
+	if c.Registry.URL == "" {
+		return fmt.Errorf("registry url must be provided")
+	}
+	if c.Registry.Type == "" {
+		backend, ok := registry.BackendForURL(c.Registry.URL)
+		if !ok {
+			return fmt.Errorf("registry type must be provided when the scheme of url %q selects no backend", c.Registry.URL)
+		}
+		c.Registry.Type = backend
+	}
+	if c.Registry.HeartbeatInterval < 0 || c.Registry.CallTimeout < 0 {
+		return fmt.Errorf("registry heartbeatInterval and callTimeout must be non-negative")
+	}
+
+	seen := make(map[string]bool, len(c.Instances))
+	for i, instance := range c.Instances {
+		if instance.ID == "" || instance.ServiceName == "" {
+			return fmt.Errorf("instance %d must have an id and a serviceName", i)
+		}
+		if seen[instance.ID] {
+			return fmt.Errorf("instance id %q is used more than once", instance.ID)
+		}
+		seen[instance.ID] = true
+		if instance.HealthPath != "" && instance.URL == "" && (instance.Host == "" || instance.Port == 0) {
+			return fmt.Errorf("instance %q has a healthPath but neither a url nor a host and port to check it at", instance.ID)
+		}
+	}
+	return nil
+}
+
+// returns the URL of the instance's health check endpoint, or an empty string if it has none
+func healthCheckURL(instance api.ServiceInstance) string {
+	if instance.HealthPath == "" {
+		return ""
+	}
+	base := instance.URL
+	if base == "" {
+		base = fmt.Sprintf("http://%s:%d", instance.Host, instance.Port)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(instance.HealthPath, "/")
+}
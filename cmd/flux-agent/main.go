@@ -0,0 +1,165 @@
+// flux-agent registers services that cannot embed flux, such as those written in other languages, with a flux service registry
+//
+// It runs a registrar per instance, checking each instance's health endpoint before every heartbeat and
+// keeping instances that fail it out of the registry. Instances are defined in a JSON config file, which is
+// reloaded on SIGHUP, or for a single instance with flags:
+//
+//	flux-agent --config /etc/flux/agent.json
+//	flux-agent --registry http://registry:8080 --id billing-1 --service billing --host 10.0.0.7 --port 8000
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lokeshllkumar/flux/admin"
+	"github.com/lokeshllkumar/flux/api"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// runs the agent until it is interrupted and returns its exit code
+func run(args []string, stderr io.Writer) int {
+	var (
+		configPath string
+		verbose    bool
+		flagConfig agentConfig
+		instance   api.ServiceInstance
+		interval   time.Duration
+		timeout    time.Duration
+	)
+	flags := flag.NewFlagSet("flux-agent", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&configPath, "config", "", "path of a JSON config file defining the registry and instances; reloaded on SIGHUP")
+	flags.StringVar(&flagConfig.Registry.URL, "registry", os.Getenv("REGISTRY_URL"), "address of the service registry (env REGISTRY_URL)")
+	flags.StringVar(&flagConfig.Registry.Type, "protocol", os.Getenv("REGISTRY_TYPE"), "registry backend: http, grpc, consul, etcd or any other registered backend; selected by the scheme of --registry when empty (env REGISTRY_TYPE)")
+	flags.DurationVar(&interval, "heartbeat-interval", 0, "interval between heartbeats (default from the registration package)")
+	flags.DurationVar(&timeout, "timeout", 0, "timeout of each registry call and health check (default from the registration package)")
+	flags.StringVar(&flagConfig.AdminAddr, "admin-addr", "", "address of the admin server exposing /metrics, /healthz, /readyz and /flux/status")
+	flags.StringVar(&instance.ID, "id", "", "unique ID of the instance")
+	flags.StringVar(&instance.ServiceName, "service", "", "name of the service the instance belongs to")
+	flags.StringVar(&instance.Host, "host", "", "host or IP the instance is reachable at")
+	flags.IntVar(&instance.Port, "port", 0, "port the instance listens on")
+	flags.StringVar(&instance.URL, "url", "", "base URL of the instance; derived from host and port when empty")
+	flags.StringVar(&instance.HealthPath, "health-path", "/health", "path of the instance's health check endpoint; empty disables health checks")
+	flags.BoolVar(&verbose, "verbose", false, "log debug messages")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintf(stderr, "flux-agent: unexpected arguments %v\n", flags.Args())
+		return 2
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+
+	var cfg *agentConfig
+	var raw []byte
+	if configPath != "" {
+		var err error
+		if cfg, raw, err = loadConfig(configPath); err != nil {
+			fmt.Fprintf(stderr, "flux-agent: %v\n", err)
+			return 2
+		}
+	} else {
+		if instance.URL == "" && instance.Host != "" && instance.Port != 0 {
+			instance.URL = fmt.Sprintf("http://%s:%d", instance.Host, instance.Port)
+		}
+		flagConfig.Registry.HeartbeatInterval = duration(interval)
+		flagConfig.Registry.CallTimeout = duration(timeout)
+		flagConfig.Instances = []api.ServiceInstance{instance}
+		if err := flagConfig.validate(); err != nil {
+			fmt.Fprintf(stderr, "flux-agent: %v\n", err)
+			return 2
+		}
+		cfg = &flagConfig
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := newAgent(ctx, logger)
+	if err := a.apply(cfg); err != nil {
+		logger.Error("failed to start registrars", "error", err)
+		a.shutdown()
+		return 1
+	}
+
+	var adminServer *admin.Server
+	if cfg.AdminAddr != "" {
+		adminServer = admin.NewServer(cfg.AdminAddr, admin.WithRegistrarsFunc(a.statusReporters))
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil {
+				logger.Error("admin server stopped", "error", err)
+			}
+		}()
+		logger.Info("admin server listening", "addr", cfg.AdminAddr)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			logger.Info("shutting down", "signal", sig.String())
+			break
+		}
+		if configPath == "" {
+			logger.Warn("ignoring SIGHUP, the agent was configured with flags rather than a config file")
+			continue
+		}
+		raw = reload(a, configPath, raw, cfg.AdminAddr, logger)
+	}
+
+	cancel()
+	a.shutdown()
+	if adminServer != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("failed to shut down admin server", "error", err)
+		}
+	}
+	return 0
+}
+
+// re-reads the config file and applies it if it changed since it was last read; returns the contents now in effect
+// a config that cannot be read or is invalid is rejected and the running registrars are left as they are
+func reload(a *agent, path string, current []byte, adminAddr string, logger *slog.Logger) []byte {
+	cfg, raw, err := loadConfig(path)
+	if err != nil {
+		logger.Error("config reload failed, keeping the current configuration", "error", err)
+		return current
+	}
+	if bytes.Equal(raw, current) {
+		logger.Info("config file unchanged, nothing to reload")
+		return current
+	}
+	if cfg.AdminAddr != adminAddr {
+		logger.Warn("adminAddr cannot be changed by a reload, restart the agent to apply it")
+	}
+	if err := a.apply(cfg); err != nil {
+		logger.Error("config reload failed", "error", err)
+		return current
+	}
+	logger.Info("config reloaded", "path", path)
+	return raw
+}
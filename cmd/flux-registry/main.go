@@ -0,0 +1,130 @@
+// flux-registry is a service registry speaking the HTTP API of registry.NewHTTPClient
+//
+// Registrations and lease renewals are appended to a write-ahead log in the data directory and compacted into periodic
+// snapshots, so that a restarted registry recovers its instances instead of every service registering again at once:
+//
+//	flux-registry --addr :8080 --data-dir /var/lib/flux-registry
+//
+// Given a node ID, it instead runs as a node of a cluster replicating the registry with Raft; every node serves reads
+// and forwards writes to the leader. Each node lists all of the cluster's nodes, itself included:
+//
+//	flux-registry --addr :8080 --data-dir /var/lib/flux-registry --node-id r1 --raft-addr 10.0.0.1:7000 --bootstrap \
+//	  --peer r1,10.0.0.1:7000,http://10.0.0.1:8080 --peer r2,10.0.0.2:7000,http://10.0.0.2:8080 --peer r3,10.0.0.3:7000,http://10.0.0.3:8080
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lokeshllkumar/flux/server"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// runs the registry until it is interrupted and returns its exit code
+func run(args []string, stderr io.Writer) int {
+	cfg := server.NewDefaultConfig()
+	cluster := &server.ClusterConfig{}
+	var (
+		addr    string
+		verbose bool
+	)
+	flags := flag.NewFlagSet("flux-registry", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&addr, "addr", ":8080", "address to serve the registry API on")
+	flags.StringVar(&cfg.DataDir, "data-dir", "", "directory for the snapshot and write-ahead log; state is kept in memory only when empty")
+	flags.DurationVar(&cfg.LeaseTTL, "lease-ttl", cfg.LeaseTTL, "TTL of the leases granted to registered instances")
+	flags.BoolVar(&cfg.SyncWrites, "sync", cfg.SyncWrites, "fsync every change before acknowledging it")
+	flags.DurationVar(&cfg.SnapshotInterval, "snapshot-interval", cfg.SnapshotInterval, "interval between snapshots compacting the write-ahead log")
+	flags.IntVar(&cfg.SnapshotThreshold, "snapshot-threshold", cfg.SnapshotThreshold, "number of changes after which a snapshot is taken early; 0 disables it")
+	flags.StringVar(&cluster.NodeID, "node-id", "", "ID of this node; runs the registry as a node of a Raft cluster when set")
+	flags.StringVar(&cluster.RaftAddr, "raft-addr", "", "address to listen on for Raft traffic from the other nodes")
+	flags.Func("peer", "node of the cluster as id,raft-addr,api-url; repeated for every node, this one included", func(value string) error {
+		parts := strings.Split(value, ",")
+		if len(parts) != 3 {
+			return fmt.Errorf("peer must be given as id,raft-addr,api-url")
+		}
+		cluster.Peers = append(cluster.Peers, server.Peer{ID: parts[0], RaftAddr: parts[1], APIURL: parts[2]})
+		return nil
+	})
+	flags.BoolVar(&cluster.Bootstrap, "bootstrap", false, "bootstrap a new cluster from the peers unless the data directory already holds cluster state")
+	flags.BoolVar(&verbose, "verbose", false, "log debug messages")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintf(stderr, "flux-registry: unexpected arguments %v\n", flags.Args())
+		return 2
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	cfg.Logger = logger
+
+	var store io.Closer
+	var handler http.Handler
+	if cluster.NodeID != "" {
+		cfg.Cluster = cluster
+		node, err := server.OpenCluster(cfg)
+		if err != nil {
+			logger.Error("failed to start registry cluster node", "error", err)
+			return 1
+		}
+		store, handler = node, node.Handler()
+	} else {
+		single, err := server.Open(cfg)
+		if err != nil {
+			logger.Error("failed to open registry store", "error", err)
+			return 1
+		}
+		store, handler = single, server.NewHandler(single, logger)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: handler}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	logger.Info("registry listening", "addr", addr, "data_dir", cfg.DataDir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	code := 0
+	select {
+	case <-ctx.Done():
+		logger.Info("shutting down")
+	case err := <-errs:
+		logger.Error("registry server stopped", "error", err)
+		code = 1
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down registry server", "error", err)
+	}
+	if err := store.Close(); err != nil {
+		logger.Error("failed to close registry store", "error", err)
+		code = 1
+	}
+	return code
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+// parses a command's own flags, reporting malformed ones as usage errors
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return usageErrorf("%v", err)
+	}
+	return nil
+}
+
+func runList(ctx context.Context, g *globalFlags, client registry.Client, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return usageErrorf("expected exactly one service name")
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	instances, err := client.GetHealthyServices(callCtx, args[0])
+	if err != nil {
+		return err
+	}
+
+	sortInstances(instances)
+	return newPrinter(g.output, stdout).instances(instances)
+}
+
+func runRegister(ctx context.Context, g *globalFlags, client registry.Client, args []string, stdout io.Writer) error {
+	var instance api.ServiceInstance
+	flags := flag.NewFlagSet("register", flag.ContinueOnError)
+	flags.StringVar(&instance.ID, "id", "", "unique ID of the instance")
+	flags.StringVar(&instance.ServiceName, "service", "", "name of the service the instance belongs to")
+	flags.StringVar(&instance.Host, "host", "", "host or IP the instance is reachable at")
+	flags.IntVar(&instance.Port, "port", 0, "port the instance listens on")
+	flags.StringVar(&instance.URL, "url", "", "base URL of the instance; derived from host and port when empty")
+	flags.StringVar(&instance.HealthPath, "health-path", "/health", "path of the instance's health check endpoint")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return usageErrorf("unexpected arguments %v", flags.Args())
+	}
+	if instance.ID == "" || instance.ServiceName == "" {
+		return usageErrorf("--id and --service must be provided")
+	}
+	if instance.URL == "" && instance.Host != "" && instance.Port != 0 {
+		instance.URL = fmt.Sprintf("http://%s:%d", instance.Host, instance.Port)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	lease, err := client.Register(callCtx, instance)
+	if err != nil {
+		return err
+	}
+	return newPrinter(g.output, stdout).registered(instance, lease)
+}
+
+func runDeregister(ctx context.Context, g *globalFlags, client registry.Client, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return usageErrorf("expected exactly one instance ID")
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	if err := client.Deregister(callCtx, args[0]); err != nil {
+		return err
+	}
+	return newPrinter(g.output, stdout).deregistered(args[0])
+}
+
+func runHeartbeat(ctx context.Context, g *globalFlags, client registry.Client, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usageErrorf("expected at least one instance ID")
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	if len(args) == 1 {
+		lease, err := client.SendHeartbeat(callCtx, args[0])
+		if err != nil {
+			return err
+		}
+		return newPrinter(g.output, stdout).heartbeats([]api.HeartbeatResult{{InstanceID: args[0], Success: true, TTLSeconds: lease.TTLSeconds}})
+	}
+
+	results, err := client.SendHeartbeats(callCtx, args)
+	if err != nil {
+		return err
+	}
+	if err := newPrinter(g.output, stdout).heartbeats(results); err != nil {
+		return err
+	}
+
+	// a batch succeeds only if every instance's heartbeat did; the exit code follows the first failure
+	for _, result := range results {
+		switch {
+		case result.NotRegistered:
+			return fmt.Errorf("instance %s is not registered: %w", result.InstanceID, registry.ErrNotFound)
+		case result.LeaseExpired:
+			return fmt.Errorf("lease of instance %s expired: %w", result.InstanceID, registry.ErrLeaseExpired)
+		case !result.Success:
+			return fmt.Errorf("heartbeat for instance %s failed: %s", result.InstanceID, result.Message)
+		}
+	}
+	return nil
+}
+
+func runWatch(ctx context.Context, g *globalFlags, client registry.Client, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := flags.Duration("interval", 2*time.Second, "how often the registry is polled")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageErrorf("expected exactly one service name")
+	}
+	if *interval <= 0 {
+		return usageErrorf("--interval must be a positive duration")
+	}
+	serviceName := flags.Arg(0)
+	printer := newPrinter(g.output, stdout)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	known := map[string]api.ServiceInstance{}
+	first := true
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, g.timeout)
+		instances, err := client.GetHealthyServices(callCtx, serviceName)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil && first:
+			// a registry that cannot be reached at all is reported straight away
+			return err
+		case err != nil:
+			// transient failures while watching are reported without ending the watch
+			if err := printer.watchError(serviceName, err); err != nil {
+				return err
+			}
+		default:
+			events := diffInstances(known, instances)
+			for _, event := range events {
+				if err := printer.watchEvent(event); err != nil {
+					return err
+				}
+			}
+			known = make(map[string]api.ServiceInstance, len(instances))
+			for _, instance := range instances {
+				known[instance.ID] = instance
+			}
+		}
+		first = false
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// kind of change observed by watch
+type eventType string
+
+const (
+	eventAdded   eventType = "added"
+	eventRemoved eventType = "removed"
+	eventUpdated eventType = "updated"
+)
+
+// change to the healthy instances of a service
+type watchEvent struct {
+	Type     eventType           `json:"type"`
+	Time     time.Time           `json:"time"`
+	Instance api.ServiceInstance `json:"instance"`
+}
+
+// returns the changes between the known instances and the current ones, ordered by instance ID
+func diffInstances(known map[string]api.ServiceInstance, current []api.ServiceInstance) []watchEvent {
+	now := time.Now()
+	var events []watchEvent
+	seen := make(map[string]bool, len(current))
+	for _, instance := range current {
+		seen[instance.ID] = true
+		previous, ok := known[instance.ID]
+		switch {
+		case !ok:
+			events = append(events, watchEvent{Type: eventAdded, Time: now, Instance: instance})
+		case previous != instance:
+			events = append(events, watchEvent{Type: eventUpdated, Time: now, Instance: instance})
+		}
+	}
+	for id, instance := range known {
+		if !seen[id] {
+			events = append(events, watchEvent{Type: eventRemoved, Time: now, Instance: instance})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Instance.ID < events[j].Instance.ID
+	})
+	return events
+}
+
+func sortInstances(instances []api.ServiceInstance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+}
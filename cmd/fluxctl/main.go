@@ -0,0 +1,191 @@
+// fluxctl inspects and manipulates a flux service registry from the command line
+//
+// usage: fluxctl [flags] <command> [args]
+//
+// commands:
+//
+//	list <service>        lists the healthy instances of a service
+//	register [flags]      registers a service instance
+//	deregister <id>       deregisters a service instance
+//	heartbeat <id>...     sends a heartbeat for one or more service instances
+//	watch <service>       prints changes to the healthy instances of a service until interrupted
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+// exit codes, so that scripts can tell failures apart without parsing output
+const (
+	exitOK = 0
+	// the registry call failed for a reason not covered below
+	exitError = 1
+	// the command line was malformed
+	exitUsage = 2
+	// the registry does not know the instance or service
+	exitNotFound = 3
+	// the registry could not be reached, is unavailable or throttled the call
+	exitUnavailable = 4
+	// the registry rejected the request as invalid, unauthorized or conflicting
+	exitRejected = 5
+)
+
+// settings shared by every command
+type globalFlags struct {
+	protocol string
+	registry string
+	timeout  time.Duration
+	output   string
+	verbose  bool
+}
+
+// a fluxctl command; run returns the error to report, if any
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, g *globalFlags, client registry.Client, args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "list", usage: "list <service>", summary: "lists the healthy instances of a service", run: runList},
+	{name: "register", usage: "register --id <id> --service <name> [--host <host>] [--port <port>] [--url <url>] [--health-path <path>]", summary: "registers a service instance", run: runRegister},
+	{name: "deregister", usage: "deregister <id>", summary: "deregisters a service instance", run: runDeregister},
+	{name: "heartbeat", usage: "heartbeat <id>...", summary: "sends a heartbeat for one or more service instances", run: runHeartbeat},
+	{name: "watch", usage: "watch [--interval <duration>] <service>", summary: "prints changes to the healthy instances of a service until interrupted", run: runWatch},
+}
+
+// error caused by a malformed command line
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runs fluxctl with the given arguments and returns its exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	g := &globalFlags{}
+	flags := flag.NewFlagSet("fluxctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&g.protocol, "protocol", os.Getenv("REGISTRY_TYPE"), "registry backend: http, grpc, consul or etcd; dns (--registry is the SRV domain) and file (--registry is a JSON or YAML instances file) are read-only. Selected by the scheme of --registry when empty (env REGISTRY_TYPE)")
+	flags.StringVar(&g.registry, "registry", os.Getenv("REGISTRY_URL"), "address of the service registry (env REGISTRY_URL)")
+	flags.DurationVar(&g.timeout, "timeout", 5*time.Second, "timeout of each registry call")
+	flags.StringVar(&g.output, "output", "table", "output format: table or json")
+	flags.BoolVar(&g.verbose, "verbose", false, "log registry client activity to stderr")
+	flags.Usage = func() { printUsage(flags, stderr) }
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		printUsage(flags, stderr)
+		return exitUsage
+	}
+
+	cmd, ok := lookupCommand(flags.Arg(0))
+	if !ok {
+		fmt.Fprintf(stderr, "fluxctl: unknown command %q\n", flags.Arg(0))
+		printUsage(flags, stderr)
+		return exitUsage
+	}
+	if g.registry == "" {
+		fmt.Fprintln(stderr, "fluxctl: --registry or REGISTRY_URL must be set")
+		return exitUsage
+	}
+	if g.output != "table" && g.output != "json" {
+		fmt.Fprintf(stderr, "fluxctl: unsupported output format %q, must be 'table' or 'json'\n", g.output)
+		return exitUsage
+	}
+
+	client, err := newClient(g, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "fluxctl: %v\n", err)
+		return exitUsage
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, g, client, flags.Args()[1:], stdout); err != nil {
+		var usageErr *usageError
+		if errors.As(err, &usageErr) {
+			fmt.Fprintf(stderr, "fluxctl %s: %v\nusage: fluxctl [flags] %s\n", cmd.name, err, cmd.usage)
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "fluxctl %s: %v\n", cmd.name, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// creates the registry client selected by --protocol, or by the scheme of --registry
+func newClient(g *globalFlags, stderr io.Writer) (registry.Client, error) {
+	level := slog.LevelWarn
+	if g.verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+
+	return registry.NewClient(g.protocol, g.registry, g.timeout, registry.WithLogger(logger))
+}
+
+// maps a registry error onto the exit code reported for it
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, registry.ErrNotFound), errors.Is(err, registry.ErrLeaseExpired):
+		return exitNotFound
+	case errors.Is(err, registry.ErrUnavailable), errors.Is(err, registry.ErrThrottled), errors.Is(err, context.DeadlineExceeded):
+		return exitUnavailable
+	case errors.Is(err, registry.ErrInvalid), errors.Is(err, registry.ErrUnauthorized), errors.Is(err, registry.ErrConflict):
+		return exitRejected
+	case errors.Is(err, registry.ErrUnsupported):
+		return exitUsage
+	default:
+		return exitError
+	}
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(flags *flag.FlagSet, w io.Writer) {
+	fmt.Fprintln(w, "usage: fluxctl [flags] <command> [args]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w, "\nexit codes: 0 ok, 1 error, 2 usage, 3 not found, 4 registry unavailable or throttled, 5 request rejected")
+}
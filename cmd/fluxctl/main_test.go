@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// starts an HTTP registry knowing the billing service, answering for the missing and down services and the bad instance with errors
+func startRegistry(t *testing.T) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/services/billing/healthy", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]api.ServiceInstance{
+			{ID: "billing-2", ServiceName: "billing", Host: "10.0.0.8", Port: 8000},
+			{ID: "billing-1", ServiceName: "billing", Host: "10.0.0.7", Port: 8000},
+		})
+	})
+	mux.HandleFunc("GET /api/v1/services/missing/healthy", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown service", http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /api/v1/services/down/healthy", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("POST /api/v1/services/register", func(w http.ResponseWriter, r *http.Request) {
+		var instance api.ServiceInstance
+		json.NewDecoder(r.Body).Decode(&instance)
+		if instance.ID == "bad" {
+			http.Error(w, "invalid instance", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /api/v1/services/heartbeat/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "billing-1" {
+			http.Error(w, "unknown instance", http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("POST /api/v1/services/heartbeats", func(w http.ResponseWriter, r *http.Request) {
+		var req api.HeartbeatsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var resp api.HeartbeatsResponse
+		for _, id := range req.InstanceIDs {
+			resp.Results = append(resp.Results, api.HeartbeatResult{InstanceID: id, Success: id == "billing-1", NotRegistered: id != "billing-1"})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	registry := httptest.NewServer(mux)
+	t.Cleanup(registry.Close)
+	return registry.URL
+}
+
+// runs fluxctl against the registry, returning its exit code and output; the registry settings of the environment are ignored
+func runFluxctl(t *testing.T, registryURL string, args ...string) (int, string, string) {
+	t.Helper()
+	t.Setenv("REGISTRY_URL", "")
+	t.Setenv("REGISTRY_TYPE", "")
+	var stdout, stderr bytes.Buffer
+	if registryURL != "" {
+		args = append([]string{"--registry", registryURL}, args...)
+	}
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	registryURL := startRegistry(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name        string
+		registryURL string
+		args        []string
+		want        int
+	}{
+		{name: "list", registryURL: registryURL, args: []string{"list", "billing"}, want: exitOK},
+		{name: "heartbeat", registryURL: registryURL, args: []string{"heartbeat", "billing-1"}, want: exitOK},
+		{name: "register", registryURL: registryURL, args: []string{"register", "--id", "billing-3", "--service", "billing"}, want: exitOK},
+		{name: "not found", registryURL: registryURL, args: []string{"list", "missing"}, want: exitNotFound},
+		{name: "heartbeat of unknown instance", registryURL: registryURL, args: []string{"heartbeat", "billing-9"}, want: exitNotFound},
+		{name: "unavailable", registryURL: registryURL, args: []string{"list", "down"}, want: exitUnavailable},
+		{name: "unreachable", registryURL: unreachable.URL, args: []string{"list", "billing"}, want: exitUnavailable},
+		{name: "rejected", registryURL: registryURL, args: []string{"register", "--id", "bad", "--service", "billing"}, want: exitRejected},
+		{name: "no command", registryURL: registryURL, want: exitUsage},
+		{name: "unknown command", registryURL: registryURL, args: []string{"describe", "billing"}, want: exitUsage},
+		{name: "unknown flag", registryURL: registryURL, args: []string{"--colour", "list", "billing"}, want: exitUsage},
+		{name: "missing arguments", registryURL: registryURL, args: []string{"list"}, want: exitUsage},
+		{name: "missing command flags", registryURL: registryURL, args: []string{"register", "--id", "billing-3"}, want: exitUsage},
+		{name: "unsupported output", registryURL: registryURL, args: []string{"--output", "yaml", "list", "billing"}, want: exitUsage},
+		{name: "no registry", args: []string{"list", "billing"}, want: exitUsage},
+		{name: "unknown backend", registryURL: "zookeeper://localhost:2181", args: []string{"list", "billing"}, want: exitUsage},
+		{name: "read-only backend", registryURL: "dns://example.com", args: []string{"deregister", "billing-1"}, want: exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runFluxctl(t, tt.registryURL, tt.args...)
+			if code != tt.want {
+				t.Fatalf("expected exit code %d, got %d\nstdout: %s\nstderr: %s", tt.want, code, stdout, stderr)
+			}
+			if code != exitOK && stderr == "" {
+				t.Fatal("expected the failure to be explained on stderr")
+			}
+		})
+	}
+}
+
+func TestListPrintsJSON(t *testing.T) {
+	code, stdout, stderr := runFluxctl(t, startRegistry(t), "--output", "json", "list", "billing")
+	if code != exitOK {
+		t.Fatalf("list failed with %d: %s", code, stderr)
+	}
+
+	var instances []api.ServiceInstance
+	if err := json.Unmarshal([]byte(stdout), &instances); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", stdout, err)
+	}
+	if len(instances) != 2 || instances[0].ID != "billing-1" || instances[1].ID != "billing-2" || instances[0].Host != "10.0.0.7" {
+		t.Fatalf("expected both instances sorted by ID, got %+v", instances)
+	}
+}
+
+func TestHeartbeatBatchFailure(t *testing.T) {
+	code, stdout, stderr := runFluxctl(t, startRegistry(t), "--output", "json", "heartbeat", "billing-1", "billing-9")
+	if code != exitNotFound {
+		t.Fatalf("expected a batch with an unknown instance to exit with %d, got %d: %s", exitNotFound, code, stderr)
+	}
+	if !strings.Contains(stderr, "instance billing-9 is not registered") {
+		t.Fatalf("expected the failed instance to be named, got %q", stderr)
+	}
+
+	// every instance's outcome is still printed
+	var results []api.HeartbeatResult
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", stdout, err)
+	}
+	if len(results) != 2 || !results[0].Success || !results[1].NotRegistered {
+		t.Fatalf("expected billing-1 to succeed and billing-9 to be reported as not registered, got %+v", results)
+	}
+}
+
+func TestDiffInstances(t *testing.T) {
+	known := map[string]api.ServiceInstance{
+		"a": {ID: "a", ServiceName: "svc", Port: 8000},
+		"b": {ID: "b", ServiceName: "svc", Port: 8000},
+		"c": {ID: "c", ServiceName: "svc", Port: 8000},
+	}
+	current := []api.ServiceInstance{
+		{ID: "d", ServiceName: "svc", Port: 8000},
+		{ID: "c", ServiceName: "svc", Port: 8000},
+		{ID: "b", ServiceName: "svc", Port: 8001},
+	}
+
+	events := diffInstances(known, current)
+	want := []struct {
+		typ  eventType
+		id   string
+		port int
+	}{
+		{eventRemoved, "a", 8000},
+		{eventUpdated, "b", 8001},
+		{eventAdded, "d", 8000},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Type != w.typ || events[i].Instance.ID != w.id || events[i].Instance.Port != w.port || events[i].Time.IsZero() {
+			t.Errorf("event %d: expected %s %s on port %d, got %+v", i, w.typ, w.id, w.port, events[i])
+		}
+	}
+
+	if events := diffInstances(nil, nil); len(events) != 0 {
+		t.Fatalf("expected no events without instances, got %+v", events)
+	}
+}
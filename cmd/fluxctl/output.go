@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// writes command results either as aligned tables for people or as JSON for scripts
+type printer struct {
+	json bool
+	w    io.Writer
+}
+
+func newPrinter(format string, w io.Writer) *printer {
+	return &printer{json: format == "json", w: w}
+}
+
+func (p *printer) instances(instances []api.ServiceInstance) error {
+	if p.json {
+		if instances == nil {
+			instances = []api.ServiceInstance{}
+		}
+		return p.encode(instances)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSERVICE\tHOST\tPORT\tURL\tHEALTH PATH")
+	for _, instance := range instances {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", instance.ID, instance.ServiceName, instance.Host, instance.Port, instance.URL, instance.HealthPath)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) registered(instance api.ServiceInstance, lease api.Lease) error {
+	if p.json {
+		return p.encode(struct {
+			Instance api.ServiceInstance `json:"instance"`
+			Lease    api.Lease           `json:"lease"`
+		}{instance, lease})
+	}
+
+	if lease.ID == "" && lease.TTLSeconds == 0 {
+		_, err := fmt.Fprintf(p.w, "registered %s (%s)\n", instance.ID, instance.ServiceName)
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "registered %s (%s) with lease %q, ttl %s\n", instance.ID, instance.ServiceName, lease.ID, lease.TTL())
+	return err
+}
+
+func (p *printer) deregistered(instanceID string) error {
+	if p.json {
+		return p.encode(struct {
+			InstanceID   string `json:"instanceId"`
+			Deregistered bool   `json:"deregistered"`
+		}{instanceID, true})
+	}
+
+	_, err := fmt.Fprintf(p.w, "deregistered %s\n", instanceID)
+	return err
+}
+
+func (p *printer) heartbeats(results []api.HeartbeatResult) error {
+	if p.json {
+		if results == nil {
+			results = []api.HeartbeatResult{}
+		}
+		return p.encode(results)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tTTL\tMESSAGE")
+	for _, result := range results {
+		status := "ok"
+		switch {
+		case result.NotRegistered:
+			status = "not registered"
+		case result.LeaseExpired:
+			status = "lease expired"
+		case !result.Success:
+			status = "failed"
+		}
+		ttl := "-"
+		if result.TTLSeconds > 0 {
+			ttl = (time.Duration(result.TTLSeconds) * time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.InstanceID, status, ttl, result.Message)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) watchEvent(event watchEvent) error {
+	if p.json {
+		return p.encode(event)
+	}
+
+	instance := event.Instance
+	_, err := fmt.Fprintf(p.w, "%s  %-8s %s (%s) %s:%d\n", event.Time.Format(time.RFC3339), event.Type, instance.ID, instance.ServiceName, instance.Host, instance.Port)
+	return err
+}
+
+func (p *printer) watchError(serviceName string, watchErr error) error {
+	if p.json {
+		return p.encode(struct {
+			Type    string    `json:"type"`
+			Time    time.Time `json:"time"`
+			Service string    `json:"service"`
+			Error   string    `json:"error"`
+		}{"error", time.Now(), serviceName, watchErr.Error()})
+	}
+
+	_, err := fmt.Fprintf(p.w, "%s  %-8s %v\n", time.Now().Format(time.RFC3339), "error", watchErr)
+	return err
+}
+
+// writes v as a single line of JSON, so that streamed results such as watch events can be read line by line
+func (p *printer) encode(v any) error {
+	return json.NewEncoder(p.w).Encode(v)
+}
@@ -21,6 +21,58 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type KeepAliveCommand int32
+
+const (
+	KeepAliveCommand_NONE            KeepAliveCommand = 0
+	KeepAliveCommand_REREGISTER      KeepAliveCommand = 1
+	KeepAliveCommand_DRAIN           KeepAliveCommand = 2
+	KeepAliveCommand_CHANGE_INTERVAL KeepAliveCommand = 3
+)
+
+// Enum value maps for KeepAliveCommand.
+var (
+	KeepAliveCommand_name = map[int32]string{
+		0: "NONE",
+		1: "REREGISTER",
+		2: "DRAIN",
+		3: "CHANGE_INTERVAL",
+	}
+	KeepAliveCommand_value = map[string]int32{
+		"NONE":            0,
+		"REREGISTER":      1,
+		"DRAIN":           2,
+		"CHANGE_INTERVAL": 3,
+	}
+)
+
+func (x KeepAliveCommand) Enum() *KeepAliveCommand {
+	p := new(KeepAliveCommand)
+	*p = x
+	return p
+}
+
+func (x KeepAliveCommand) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (KeepAliveCommand) Descriptor() protoreflect.EnumDescriptor {
+	return file_service_registry_proto_enumTypes[0].Descriptor()
+}
+
+func (KeepAliveCommand) Type() protoreflect.EnumType {
+	return &file_service_registry_proto_enumTypes[0]
+}
+
+func (x KeepAliveCommand) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use KeepAliveCommand.Descriptor instead.
+func (KeepAliveCommand) EnumDescriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{0}
+}
+
 type GrpcServiceInstance struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -325,17 +377,192 @@ func (x *SendHeartbeatRequest) GetInstanceId() string {
 	return ""
 }
 
+type SendHeartbeatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceIds   []string               `protobuf:"bytes,1,rep,name=instanceIds,proto3" json:"instanceIds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendHeartbeatsRequest) Reset() {
+	*x = SendHeartbeatsRequest{}
+	mi := &file_service_registry_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendHeartbeatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendHeartbeatsRequest) ProtoMessage() {}
+
+func (x *SendHeartbeatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendHeartbeatsRequest.ProtoReflect.Descriptor instead.
+func (*SendHeartbeatsRequest) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SendHeartbeatsRequest) GetInstanceIds() []string {
+	if x != nil {
+		return x.InstanceIds
+	}
+	return nil
+}
+
+type HeartbeatResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instanceId,proto3" json:"instanceId,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	TtlSeconds    int64                  `protobuf:"varint,4,opt,name=ttlSeconds,proto3" json:"ttlSeconds,omitempty"`
+	LeaseExpired  bool                   `protobuf:"varint,5,opt,name=leaseExpired,proto3" json:"leaseExpired,omitempty"`
+	NotRegistered bool                   `protobuf:"varint,6,opt,name=notRegistered,proto3" json:"notRegistered,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResult) Reset() {
+	*x = HeartbeatResult{}
+	mi := &file_service_registry_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResult) ProtoMessage() {}
+
+func (x *HeartbeatResult) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResult.ProtoReflect.Descriptor instead.
+func (*HeartbeatResult) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *HeartbeatResult) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *HeartbeatResult) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *HeartbeatResult) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *HeartbeatResult) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *HeartbeatResult) GetLeaseExpired() bool {
+	if x != nil {
+		return x.LeaseExpired
+	}
+	return false
+}
+
+func (x *HeartbeatResult) GetNotRegistered() bool {
+	if x != nil {
+		return x.NotRegistered
+	}
+	return false
+}
+
+type SendHeartbeatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*HeartbeatResult     `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendHeartbeatsResponse) Reset() {
+	*x = SendHeartbeatsResponse{}
+	mi := &file_service_registry_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendHeartbeatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendHeartbeatsResponse) ProtoMessage() {}
+
+func (x *SendHeartbeatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendHeartbeatsResponse.ProtoReflect.Descriptor instead.
+func (*SendHeartbeatsResponse) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SendHeartbeatsResponse) GetResults() []*HeartbeatResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
 type ServiceRegistryResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
 	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	LeaseId       string                 `protobuf:"bytes,3,opt,name=leaseId,proto3" json:"leaseId,omitempty"`
+	TtlSeconds    int64                  `protobuf:"varint,4,opt,name=ttlSeconds,proto3" json:"ttlSeconds,omitempty"`
+	LeaseExpired  bool                   `protobuf:"varint,5,opt,name=leaseExpired,proto3" json:"leaseExpired,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ServiceRegistryResponse) Reset() {
 	*x = ServiceRegistryResponse{}
-	mi := &file_service_registry_proto_msgTypes[6]
+	mi := &file_service_registry_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -347,7 +574,7 @@ func (x *ServiceRegistryResponse) String() string {
 func (*ServiceRegistryResponse) ProtoMessage() {}
 
 func (x *ServiceRegistryResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_service_registry_proto_msgTypes[6]
+	mi := &file_service_registry_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -360,7 +587,7 @@ func (x *ServiceRegistryResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServiceRegistryResponse.ProtoReflect.Descriptor instead.
 func (*ServiceRegistryResponse) Descriptor() ([]byte, []int) {
-	return file_service_registry_proto_rawDescGZIP(), []int{6}
+	return file_service_registry_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *ServiceRegistryResponse) GetSuccess() bool {
@@ -377,6 +604,187 @@ func (x *ServiceRegistryResponse) GetMessage() string {
 	return ""
 }
 
+func (x *ServiceRegistryResponse) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *ServiceRegistryResponse) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *ServiceRegistryResponse) GetLeaseExpired() bool {
+	if x != nil {
+		return x.LeaseExpired
+	}
+	return false
+}
+
+type KeepAlivePing struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instanceId,proto3" json:"instanceId,omitempty"`
+	Sequence      int64                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeepAlivePing) Reset() {
+	*x = KeepAlivePing{}
+	mi := &file_service_registry_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeepAlivePing) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeepAlivePing) ProtoMessage() {}
+
+func (x *KeepAlivePing) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeepAlivePing.ProtoReflect.Descriptor instead.
+func (*KeepAlivePing) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *KeepAlivePing) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *KeepAlivePing) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+type KeepAliveResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId      string                 `protobuf:"bytes,1,opt,name=instanceId,proto3" json:"instanceId,omitempty"`
+	Sequence        int64                  `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Success         bool                   `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`
+	Message         string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	TtlSeconds      int64                  `protobuf:"varint,5,opt,name=ttlSeconds,proto3" json:"ttlSeconds,omitempty"`
+	LeaseExpired    bool                   `protobuf:"varint,6,opt,name=leaseExpired,proto3" json:"leaseExpired,omitempty"`
+	Command         KeepAliveCommand       `protobuf:"varint,7,opt,name=command,proto3,enum=serviceregistry.KeepAliveCommand" json:"command,omitempty"`
+	IntervalSeconds int64                  `protobuf:"varint,8,opt,name=intervalSeconds,proto3" json:"intervalSeconds,omitempty"`
+	NotRegistered   bool                   `protobuf:"varint,9,opt,name=notRegistered,proto3" json:"notRegistered,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *KeepAliveResponse) Reset() {
+	*x = KeepAliveResponse{}
+	mi := &file_service_registry_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeepAliveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeepAliveResponse) ProtoMessage() {}
+
+func (x *KeepAliveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeepAliveResponse.ProtoReflect.Descriptor instead.
+func (*KeepAliveResponse) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *KeepAliveResponse) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *KeepAliveResponse) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *KeepAliveResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *KeepAliveResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *KeepAliveResponse) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *KeepAliveResponse) GetLeaseExpired() bool {
+	if x != nil {
+		return x.LeaseExpired
+	}
+	return false
+}
+
+func (x *KeepAliveResponse) GetCommand() KeepAliveCommand {
+	if x != nil {
+		return x.Command
+	}
+	return KeepAliveCommand_NONE
+}
+
+func (x *KeepAliveResponse) GetIntervalSeconds() int64 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+func (x *KeepAliveResponse) GetNotRegistered() bool {
+	if x != nil {
+		return x.NotRegistered
+	}
+	return false
+}
+
 var File_service_registry_proto protoreflect.FileDescriptor
 
 const file_service_registry_proto_rawDesc = "" +
@@ -404,15 +812,62 @@ const file_service_registry_proto_rawDesc = "" +
 	"\x14SendHeartbeatRequest\x12\x1e\n" +
 	"\n" +
 	"instanceId\x18\x01 \x01(\tR\n" +
-	"instanceId\"M\n" +
+	"instanceId\"9\n" +
+	"\x15SendHeartbeatsRequest\x12 \n" +
+	"\vinstanceIds\x18\x01 \x03(\tR\vinstanceIds\"\xcf\x01\n" +
+	"\x0fHeartbeatResult\x12\x1e\n" +
+	"\n" +
+	"instanceId\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1e\n" +
+	"\n" +
+	"ttlSeconds\x18\x04 \x01(\x03R\n" +
+	"ttlSeconds\x12\"\n" +
+	"\fleaseExpired\x18\x05 \x01(\bR\fleaseExpired\x12$\n" +
+	"\rnotRegistered\x18\x06 \x01(\bR\rnotRegistered\"T\n" +
+	"\x16SendHeartbeatsResponse\x12:\n" +
+	"\aresults\x18\x01 \x03(\v2 .serviceregistry.HeartbeatResultR\aresults\"\xab\x01\n" +
 	"\x17ServiceRegistryResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\xb2\x03\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x18\n" +
+	"\aleaseId\x18\x03 \x01(\tR\aleaseId\x12\x1e\n" +
+	"\n" +
+	"ttlSeconds\x18\x04 \x01(\x03R\n" +
+	"ttlSeconds\x12\"\n" +
+	"\fleaseExpired\x18\x05 \x01(\bR\fleaseExpired\"K\n" +
+	"\rKeepAlivePing\x12\x1e\n" +
+	"\n" +
+	"instanceId\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x03R\bsequence\"\xd4\x02\n" +
+	"\x11KeepAliveResponse\x12\x1e\n" +
+	"\n" +
+	"instanceId\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x03R\bsequence\x12\x18\n" +
+	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x12\x1e\n" +
+	"\n" +
+	"ttlSeconds\x18\x05 \x01(\x03R\n" +
+	"ttlSeconds\x12\"\n" +
+	"\fleaseExpired\x18\x06 \x01(\bR\fleaseExpired\x12;\n" +
+	"\acommand\x18\a \x01(\x0e2!.serviceregistry.KeepAliveCommandR\acommand\x12(\n" +
+	"\x0fintervalSeconds\x18\b \x01(\x03R\x0fintervalSeconds\x12$\n" +
+	"\rnotRegistered\x18\t \x01(\bR\rnotRegistered*L\n" +
+	"\x10KeepAliveCommand\x12\b\n" +
+	"\x04NONE\x10\x00\x12\x0e\n" +
+	"\n" +
+	"REREGISTER\x10\x01\x12\t\n" +
+	"\x05DRAIN\x10\x02\x12\x13\n" +
+	"\x0fCHANGE_INTERVAL\x10\x032\xea\x04\n" +
 	"\x0fServiceRegistry\x12m\n" +
 	"\x12GetHealthyServices\x12*.serviceregistry.GetHealthyServicesRequest\x1a+.serviceregistry.GetHealthyServicesResponse\x12d\n" +
 	"\x0fRegisterService\x12'.serviceregistry.RegisterServiceRequest\x1a(.serviceregistry.ServiceRegistryResponse\x12h\n" +
 	"\x11DeregisterService\x12).serviceregistry.DeregisterServiceRequest\x1a(.serviceregistry.ServiceRegistryResponse\x12`\n" +
-	"\rSendHeartbeat\x12%.serviceregistry.SendHeartbeatRequest\x1a(.serviceregistry.ServiceRegistryResponseBw\n" +
+	"\rSendHeartbeat\x12%.serviceregistry.SendHeartbeatRequest\x1a(.serviceregistry.ServiceRegistryResponse\x12a\n" +
+	"\x0eSendHeartbeats\x12&.serviceregistry.SendHeartbeatsRequest\x1a'.serviceregistry.SendHeartbeatsResponse\x12S\n" +
+	"\tKeepAlive\x12\x1e.serviceregistry.KeepAlivePing\x1a\".serviceregistry.KeepAliveResponse(\x010\x01Bw\n" +
 	" com.example.serviceregistry.grpcB\x14ServiceRegistryProtoP\x01Z;github.com/lokeshllkumar/load-balancer/internal/proto;protob\x06proto3"
 
 var (
@@ -427,32 +882,45 @@ func file_service_registry_proto_rawDescGZIP() []byte {
 	return file_service_registry_proto_rawDescData
 }
 
-var file_service_registry_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_service_registry_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_service_registry_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
 var file_service_registry_proto_goTypes = []any{
-	(*GrpcServiceInstance)(nil),        // 0: serviceregistry.GrpcServiceInstance
-	(*GetHealthyServicesRequest)(nil),  // 1: serviceregistry.GetHealthyServicesRequest
-	(*GetHealthyServicesResponse)(nil), // 2: serviceregistry.GetHealthyServicesResponse
-	(*RegisterServiceRequest)(nil),     // 3: serviceregistry.RegisterServiceRequest
-	(*DeregisterServiceRequest)(nil),   // 4: serviceregistry.DeregisterServiceRequest
-	(*SendHeartbeatRequest)(nil),       // 5: serviceregistry.SendHeartbeatRequest
-	(*ServiceRegistryResponse)(nil),    // 6: serviceregistry.ServiceRegistryResponse
+	(KeepAliveCommand)(0),              // 0: serviceregistry.KeepAliveCommand
+	(*GrpcServiceInstance)(nil),        // 1: serviceregistry.GrpcServiceInstance
+	(*GetHealthyServicesRequest)(nil),  // 2: serviceregistry.GetHealthyServicesRequest
+	(*GetHealthyServicesResponse)(nil), // 3: serviceregistry.GetHealthyServicesResponse
+	(*RegisterServiceRequest)(nil),     // 4: serviceregistry.RegisterServiceRequest
+	(*DeregisterServiceRequest)(nil),   // 5: serviceregistry.DeregisterServiceRequest
+	(*SendHeartbeatRequest)(nil),       // 6: serviceregistry.SendHeartbeatRequest
+	(*SendHeartbeatsRequest)(nil),      // 7: serviceregistry.SendHeartbeatsRequest
+	(*HeartbeatResult)(nil),            // 8: serviceregistry.HeartbeatResult
+	(*SendHeartbeatsResponse)(nil),     // 9: serviceregistry.SendHeartbeatsResponse
+	(*ServiceRegistryResponse)(nil),    // 10: serviceregistry.ServiceRegistryResponse
+	(*KeepAlivePing)(nil),              // 11: serviceregistry.KeepAlivePing
+	(*KeepAliveResponse)(nil),          // 12: serviceregistry.KeepAliveResponse
 }
 var file_service_registry_proto_depIdxs = []int32{
-	0, // 0: serviceregistry.GetHealthyServicesResponse.instances:type_name -> serviceregistry.GrpcServiceInstance
-	0, // 1: serviceregistry.RegisterServiceRequest.instance:type_name -> serviceregistry.GrpcServiceInstance
-	1, // 2: serviceregistry.ServiceRegistry.GetHealthyServices:input_type -> serviceregistry.GetHealthyServicesRequest
-	3, // 3: serviceregistry.ServiceRegistry.RegisterService:input_type -> serviceregistry.RegisterServiceRequest
-	4, // 4: serviceregistry.ServiceRegistry.DeregisterService:input_type -> serviceregistry.DeregisterServiceRequest
-	5, // 5: serviceregistry.ServiceRegistry.SendHeartbeat:input_type -> serviceregistry.SendHeartbeatRequest
-	2, // 6: serviceregistry.ServiceRegistry.GetHealthyServices:output_type -> serviceregistry.GetHealthyServicesResponse
-	6, // 7: serviceregistry.ServiceRegistry.RegisterService:output_type -> serviceregistry.ServiceRegistryResponse
-	6, // 8: serviceregistry.ServiceRegistry.DeregisterService:output_type -> serviceregistry.ServiceRegistryResponse
-	6, // 9: serviceregistry.ServiceRegistry.SendHeartbeat:output_type -> serviceregistry.ServiceRegistryResponse
-	6, // [6:10] is the sub-list for method output_type
-	2, // [2:6] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	1,  // 0: serviceregistry.GetHealthyServicesResponse.instances:type_name -> serviceregistry.GrpcServiceInstance
+	1,  // 1: serviceregistry.RegisterServiceRequest.instance:type_name -> serviceregistry.GrpcServiceInstance
+	8,  // 2: serviceregistry.SendHeartbeatsResponse.results:type_name -> serviceregistry.HeartbeatResult
+	0,  // 3: serviceregistry.KeepAliveResponse.command:type_name -> serviceregistry.KeepAliveCommand
+	2,  // 4: serviceregistry.ServiceRegistry.GetHealthyServices:input_type -> serviceregistry.GetHealthyServicesRequest
+	4,  // 5: serviceregistry.ServiceRegistry.RegisterService:input_type -> serviceregistry.RegisterServiceRequest
+	5,  // 6: serviceregistry.ServiceRegistry.DeregisterService:input_type -> serviceregistry.DeregisterServiceRequest
+	6,  // 7: serviceregistry.ServiceRegistry.SendHeartbeat:input_type -> serviceregistry.SendHeartbeatRequest
+	7,  // 8: serviceregistry.ServiceRegistry.SendHeartbeats:input_type -> serviceregistry.SendHeartbeatsRequest
+	11, // 9: serviceregistry.ServiceRegistry.KeepAlive:input_type -> serviceregistry.KeepAlivePing
+	3,  // 10: serviceregistry.ServiceRegistry.GetHealthyServices:output_type -> serviceregistry.GetHealthyServicesResponse
+	10, // 11: serviceregistry.ServiceRegistry.RegisterService:output_type -> serviceregistry.ServiceRegistryResponse
+	10, // 12: serviceregistry.ServiceRegistry.DeregisterService:output_type -> serviceregistry.ServiceRegistryResponse
+	10, // 13: serviceregistry.ServiceRegistry.SendHeartbeat:output_type -> serviceregistry.ServiceRegistryResponse
+	9,  // 14: serviceregistry.ServiceRegistry.SendHeartbeats:output_type -> serviceregistry.SendHeartbeatsResponse
+	12, // 15: serviceregistry.ServiceRegistry.KeepAlive:output_type -> serviceregistry.KeepAliveResponse
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_service_registry_proto_init() }
@@ -465,13 +933,14 @@ func file_service_registry_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_service_registry_proto_rawDesc), len(file_service_registry_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   7,
+			NumEnums:      1,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_service_registry_proto_goTypes,
 		DependencyIndexes: file_service_registry_proto_depIdxs,
+		EnumInfos:         file_service_registry_proto_enumTypes,
 		MessageInfos:      file_service_registry_proto_msgTypes,
 	}.Build()
 	File_service_registry_proto = out.File
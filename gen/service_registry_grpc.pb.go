@@ -23,6 +23,8 @@ const (
 	ServiceRegistry_RegisterService_FullMethodName    = "/serviceregistry.ServiceRegistry/RegisterService"
 	ServiceRegistry_DeregisterService_FullMethodName  = "/serviceregistry.ServiceRegistry/DeregisterService"
 	ServiceRegistry_SendHeartbeat_FullMethodName      = "/serviceregistry.ServiceRegistry/SendHeartbeat"
+	ServiceRegistry_SendHeartbeats_FullMethodName     = "/serviceregistry.ServiceRegistry/SendHeartbeats"
+	ServiceRegistry_KeepAlive_FullMethodName          = "/serviceregistry.ServiceRegistry/KeepAlive"
 )
 
 // ServiceRegistryClient is the client API for ServiceRegistry service.
@@ -33,6 +35,8 @@ type ServiceRegistryClient interface {
 	RegisterService(ctx context.Context, in *RegisterServiceRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error)
 	DeregisterService(ctx context.Context, in *DeregisterServiceRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error)
 	SendHeartbeat(ctx context.Context, in *SendHeartbeatRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error)
+	SendHeartbeats(ctx context.Context, in *SendHeartbeatsRequest, opts ...grpc.CallOption) (*SendHeartbeatsResponse, error)
+	KeepAlive(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[KeepAlivePing, KeepAliveResponse], error)
 }
 
 type serviceRegistryClient struct {
@@ -83,6 +87,29 @@ func (c *serviceRegistryClient) SendHeartbeat(ctx context.Context, in *SendHeart
 	return out, nil
 }
 
+func (c *serviceRegistryClient) SendHeartbeats(ctx context.Context, in *SendHeartbeatsRequest, opts ...grpc.CallOption) (*SendHeartbeatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendHeartbeatsResponse)
+	err := c.cc.Invoke(ctx, ServiceRegistry_SendHeartbeats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *serviceRegistryClient) KeepAlive(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[KeepAlivePing, KeepAliveResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ServiceRegistry_ServiceDesc.Streams[0], ServiceRegistry_KeepAlive_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[KeepAlivePing, KeepAliveResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ServiceRegistry_KeepAliveClient = grpc.BidiStreamingClient[KeepAlivePing, KeepAliveResponse]
+
 // ServiceRegistryServer is the server API for ServiceRegistry service.
 // All implementations must embed UnimplementedServiceRegistryServer
 // for forward compatibility.
@@ -91,6 +118,8 @@ type ServiceRegistryServer interface {
 	RegisterService(context.Context, *RegisterServiceRequest) (*ServiceRegistryResponse, error)
 	DeregisterService(context.Context, *DeregisterServiceRequest) (*ServiceRegistryResponse, error)
 	SendHeartbeat(context.Context, *SendHeartbeatRequest) (*ServiceRegistryResponse, error)
+	SendHeartbeats(context.Context, *SendHeartbeatsRequest) (*SendHeartbeatsResponse, error)
+	KeepAlive(grpc.BidiStreamingServer[KeepAlivePing, KeepAliveResponse]) error
 	mustEmbedUnimplementedServiceRegistryServer()
 }
 
@@ -113,6 +142,12 @@ func (UnimplementedServiceRegistryServer) DeregisterService(context.Context, *De
 func (UnimplementedServiceRegistryServer) SendHeartbeat(context.Context, *SendHeartbeatRequest) (*ServiceRegistryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendHeartbeat not implemented")
 }
+func (UnimplementedServiceRegistryServer) SendHeartbeats(context.Context, *SendHeartbeatsRequest) (*SendHeartbeatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendHeartbeats not implemented")
+}
+func (UnimplementedServiceRegistryServer) KeepAlive(grpc.BidiStreamingServer[KeepAlivePing, KeepAliveResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method KeepAlive not implemented")
+}
 func (UnimplementedServiceRegistryServer) mustEmbedUnimplementedServiceRegistryServer() {}
 func (UnimplementedServiceRegistryServer) testEmbeddedByValue()                         {}
 
@@ -206,6 +241,31 @@ func _ServiceRegistry_SendHeartbeat_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ServiceRegistry_SendHeartbeats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendHeartbeatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceRegistryServer).SendHeartbeats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ServiceRegistry_SendHeartbeats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceRegistryServer).SendHeartbeats(ctx, req.(*SendHeartbeatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ServiceRegistry_KeepAlive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ServiceRegistryServer).KeepAlive(&grpc.GenericServerStream[KeepAlivePing, KeepAliveResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ServiceRegistry_KeepAliveServer = grpc.BidiStreamingServer[KeepAlivePing, KeepAliveResponse]
+
 // ServiceRegistry_ServiceDesc is the grpc.ServiceDesc for ServiceRegistry service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,7 +289,18 @@ var ServiceRegistry_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendHeartbeat",
 			Handler:    _ServiceRegistry_SendHeartbeat_Handler,
 		},
+		{
+			MethodName: "SendHeartbeats",
+			Handler:    _ServiceRegistry_SendHeartbeats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "KeepAlive",
+			Handler:       _ServiceRegistry_KeepAlive_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "service_registry.proto",
 }
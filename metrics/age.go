@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gauge reporting, per label set, the seconds elapsed since it was last touched
+// the age is computed at scrape time, so it keeps growing between events instead of going stale
+type AgeVec struct {
+	desc *prometheus.Desc
+
+	mu      sync.Mutex
+	touched map[string]ageEntry
+}
+
+// time of the last touch of a label set, along with its label values
+type ageEntry struct {
+	labelValues []string
+	at          time.Time
+}
+
+// creates a new AgeVec; it still needs registering like any other collector
+func NewAgeVec(opts prometheus.GaugeOpts, labelNames []string) *AgeVec {
+	return &AgeVec{
+		desc:    prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labelNames, opts.ConstLabels),
+		touched: make(map[string]ageEntry),
+	}
+}
+
+// records that the event tracked for the label set has just happened
+func (a *AgeVec) Touch(labelValues ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.touched[strings.Join(labelValues, "\xff")] = ageEntry{labelValues: labelValues, at: time.Now()}
+}
+
+// stops reporting the label set
+func (a *AgeVec) Delete(labelValues ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.touched, strings.Join(labelValues, "\xff"))
+}
+
+func (a *AgeVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.desc
+}
+
+func (a *AgeVec) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range a.touched {
+		ch <- prometheus.MustNewConstMetric(a.desc, prometheus.GaugeValue, time.Since(entry.at).Seconds(), entry.labelValues...)
+	}
+}
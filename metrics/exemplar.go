@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// observes value, attaching the trace and span IDs of the span in ctx as an exemplar when there is one
+// exemplars are only exposed by handlers serving the OpenMetrics format
+func ObserveWithExemplar(ctx context.Context, observer prometheus.Observer, value float64) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && spanContext.IsValid() {
+		exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{
+			"trace_id": spanContext.TraceID().String(),
+			"span_id":  spanContext.SpanID().String(),
+		})
+		return
+	}
+	observer.Observe(value)
+}
@@ -1,51 +1,287 @@
 package metrics
 
 import (
+	"errors"
 	"net/http"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 )
 
-// counts the total calls to teh service registry
-var RegistryCallsTotal = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "flux_registry_calls_total",
-		Help: "Total number of calls made to the service registry",
-	},
-	[]string{"operation", "protocol", "status"},
-)
+// namespace prefixed to every metric name unless Options says otherwise
+const DefaultNamespace = "flux"
+
+// options for creating Metrics
+type Options struct {
+	// prefix of every metric name; DefaultNamespace is used when empty
+	Namespace string
+	// labels added to every metric, e.g. to tell apart several registrars in one process
+	ConstLabels prometheus.Labels
+}
+
+// the metrics recorded by flux
+type Metrics struct {
+	// counts the total calls to the service registry
+	RegistryCallsTotal *prometheus.CounterVec
+	// records the duration of calls to the service registry
+	RegistryCallDurationSeconds *prometheus.HistogramVec
+	// indicates the current state of the registrar
+	RegistrarState *prometheus.GaugeVec
+	// indicates the state of the circuit breaker guarding calls to a service registry
+	RegistryCircuitBreakerState *prometheus.GaugeVec
+	// counts registry calls held back by the client-side rate limiter or rejected by the registry's own rate limiting
+	RegistryThrottledCallsTotal *prometheus.CounterVec
+	// identifies the registry endpoint and protocol each registrar talks to
+	RegistryEndpointInfo *prometheus.GaugeVec
+	// counts heartbeats that have failed in a row, reset by the next successful heartbeat
+	HeartbeatConsecutiveFailures *prometheus.GaugeVec
+	// seconds since the last successful heartbeat
+	HeartbeatAgeSeconds *AgeVec
+	// counts successful re-registrations, e.g. after the registry lost the instance or its lease expired
+	ReregistrationsTotal *prometheus.CounterVec
+	// records how many attempts each registration took
+	RegistrationAttempts *prometheus.HistogramVec
+	// number of healthy instances returned by the last discovery of each service
+	DiscoveryInstances *prometheus.GaugeVec
+	// seconds since instances of each service were last discovered
+	DiscoveryAgeSeconds *AgeVec
+}
+
+// creates a new set of metrics and registers them with the given registerer
+// metrics already registered by an earlier call are reused, so creating Metrics twice against one registry is safe
+func New(reg prometheus.Registerer, opts Options) (*Metrics, error) {
+	m := newMetrics(opts)
+	if reg == nil {
+		return m, nil
+	}
+	if err := m.registerWith(reg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// creates a new set of metrics without registering them
+func newMetrics(opts Options) *Metrics {
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	m := &Metrics{
+		RegistryCallsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Name:        "registry_calls_total",
+				Help:        "Total number of calls made to the service registry",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"operation", "protocol", "status"},
+		),
+		RegistryCallDurationSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   namespace,
+				Name:        "registry_call_duration_seconds",
+				Help:        "Duration of calls made to the service registry in seconds",
+				Buckets:     prometheus.DefBuckets,
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"operation", "protocol", "status"},
+		),
+		RegistrarState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "registrar_state",
+				Help:        "Current state of the registrar (1 = running/registered, 0 = stopped/failed)",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"instance_id", "service_name"},
+		),
+		RegistryCircuitBreakerState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "registry_circuit_breaker_state",
+				Help:        "Current state of the circuit breaker guarding registry calls (0 = closed, 1 = open, 2 = half-open)",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"registry"},
+		),
+		RegistryThrottledCallsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Name:        "registry_throttled_calls_total",
+				Help:        "Total number of registry calls throttled, either delayed by the client-side rate limiter (source = client) or rejected by the registry (source = registry)",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"operation", "source"},
+		),
+		RegistryEndpointInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "registry_endpoint_info",
+				Help:        "Registry endpoint in use, always 1",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"protocol", "endpoint"},
+		),
+		HeartbeatConsecutiveFailures: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "registrar_heartbeat_consecutive_failures",
+				Help:        "Number of heartbeats that have failed in a row",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"instance_id", "service_name"},
+		),
+		HeartbeatAgeSeconds: NewAgeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "registrar_seconds_since_last_heartbeat",
+				Help:        "Seconds elapsed since the last successful heartbeat",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"instance_id", "service_name"},
+		),
+		ReregistrationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Name:        "registrar_reregistrations_total",
+				Help:        "Total number of successful re-registrations with the service registry",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"instance_id", "service_name"},
+		),
+		RegistrationAttempts: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   namespace,
+				Name:        "registrar_registration_attempts",
+				Help:        "Number of attempts taken by each registration, successful or not",
+				Buckets:     prometheus.LinearBuckets(1, 1, 10),
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"service_name", "status"},
+		),
+		DiscoveryInstances: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "discovery_instances",
+				Help:        "Number of healthy instances returned by the last discovery of a service",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"service_name"},
+		),
+		DiscoveryAgeSeconds: NewAgeVec(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "discovery_age_seconds",
+				Help:        "Seconds elapsed since instances of a service were last discovered",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"service_name"},
+		),
+	}
+	return m
+}
+
+// registers the metrics with reg, swapping in those already registered by an earlier call
+func (m *Metrics) registerWith(reg prometheus.Registerer) error {
+	var err error
+	if m.RegistryCallsTotal, err = register(reg, m.RegistryCallsTotal); err != nil {
+		return err
+	}
+	if m.RegistryCallDurationSeconds, err = register(reg, m.RegistryCallDurationSeconds); err != nil {
+		return err
+	}
+	if m.RegistrarState, err = register(reg, m.RegistrarState); err != nil {
+		return err
+	}
+	if m.RegistryCircuitBreakerState, err = register(reg, m.RegistryCircuitBreakerState); err != nil {
+		return err
+	}
+	if m.RegistryThrottledCallsTotal, err = register(reg, m.RegistryThrottledCallsTotal); err != nil {
+		return err
+	}
+	if m.RegistryEndpointInfo, err = register(reg, m.RegistryEndpointInfo); err != nil {
+		return err
+	}
+	if m.HeartbeatConsecutiveFailures, err = register(reg, m.HeartbeatConsecutiveFailures); err != nil {
+		return err
+	}
+	if m.HeartbeatAgeSeconds, err = register(reg, m.HeartbeatAgeSeconds); err != nil {
+		return err
+	}
+	if m.ReregistrationsTotal, err = register(reg, m.ReregistrationsTotal); err != nil {
+		return err
+	}
+	if m.RegistrationAttempts, err = register(reg, m.RegistrationAttempts); err != nil {
+		return err
+	}
+	if m.DiscoveryInstances, err = register(reg, m.DiscoveryInstances); err != nil {
+		return err
+	}
+	if m.DiscoveryAgeSeconds, err = register(reg, m.DiscoveryAgeSeconds); err != nil {
+		return err
+	}
+	return nil
+}
+
+// registers the collector, returning the one already registered in its place if there is one
+func register[C prometheus.Collector](reg prometheus.Registerer, collector C) (C, error) {
+	if err := reg.Register(collector); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return collector, err
+	}
+	return collector, nil
+}
 
-// records the duration of calls to the service registry
-var RegistryCallDurationSeconds = prometheus.NewHistogramVec(
-	prometheus.HistogramOpts{
-		Name: "flux_registry_call_duration_seconds",
-		Help: "Duration of calls made to the service registry in seconds",
-		Buckets: prometheus.DefBuckets,
-	},
-	[]string{"operation", "protocol", "status"},
+var (
+	defaultOnce sync.Once
+	// created up front, unregistered, so that the deprecated package-level collectors below can refer to them
+	defaultMetrics = newMetrics(Options{})
 )
 
-// indicates the current state of the registrar
-var RegistrarStateGauge = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "flux_registrar_state",
-		Help: "Current state of the registrar (1 = running/registered, 0 = stopped/failed)",
-	},
-	[]string{"instance_id", "service_name"},
+// the collectors of Default(), kept for code written before metrics could be injected
+var (
+	// Deprecated: use Default().RegistryCallsTotal, or the Metrics passed to clients and registrars
+	RegistryCallsTotal = defaultMetrics.RegistryCallsTotal
+	// Deprecated: use Default().RegistryCallDurationSeconds, or the Metrics passed to clients and registrars
+	RegistryCallDurationSeconds = defaultMetrics.RegistryCallDurationSeconds
+	// Deprecated: use Default().RegistrarState, or the Metrics passed to clients and registrars
+	RegistrarStateGauge = defaultMetrics.RegistrarState
+	// Deprecated: use Default().RegistryCircuitBreakerState, or the Metrics passed to clients and registrars
+	RegistryCircuitBreakerState = defaultMetrics.RegistryCircuitBreakerState
 )
 
-// registers all metrics with the default Prometheus registry
-// expected to be called at application startup
+// returns the metrics registered with the default Prometheus registry, registering them on first use
+func Default() *Metrics {
+	defaultOnce.Do(func() {
+		if err := defaultMetrics.registerWith(prometheus.DefaultRegisterer); err != nil {
+			panic(err)
+		}
+	})
+	return defaultMetrics
+}
+
+// registers the default metrics with the default Prometheus registry
+// kept for applications that call it at startup; safe to call more than once
 func InitMetrics() {
-	prometheus.MustRegister(RegistryCallsTotal)
-	prometheus.MustRegister(RegistryCallDurationSeconds)
-	prometheus.MustRegister(RegistrarStateGauge)
+	Default()
 }
 
 // return a HTTP handler that servers Prometheus metrics
 // expected to be mounted by the main app's HTTP server
+// scrapers that negotiate the OpenMetrics format also receive exemplars linking observations to traces
 func Handler() http.Handler {
-	return promhttp.Handler()
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, HandlerFor(prometheus.DefaultGatherer))
+}
+
+// returns an HTTP handler serving the metrics gathered from a custom registry, in the OpenMetrics format when the scraper accepts it
+func HandlerFor(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
 }
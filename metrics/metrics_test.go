@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeprecatedCollectorsAreTheDefaultOnes(t *testing.T) {
+	m := Default()
+	if RegistryCallsTotal != m.RegistryCallsTotal || RegistryCallDurationSeconds != m.RegistryCallDurationSeconds ||
+		RegistrarStateGauge != m.RegistrarState || RegistryCircuitBreakerState != m.RegistryCircuitBreakerState {
+		t.Fatal("expected the package-level collectors to be those of Default()")
+	}
+
+	RegistryCallsTotal.WithLabelValues("register", "http", "success").Inc()
+	if n := testutil.ToFloat64(m.RegistryCallsTotal.WithLabelValues("register", "http", "success")); n != 1 {
+		t.Fatalf("expected a call counted through the deprecated variable to show in Default(), got %v", n)
+	}
+	// InitMetrics used to panic when called twice
+	InitMetrics()
+	InitMetrics()
+}
+
+func TestNewReusesCollectorsRegisteredEarlier(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first, err := New(reg, Options{Namespace: "app", ConstLabels: prometheus.Labels{"team": "a"}})
+	if err != nil {
+		t.Fatalf("failed to create metrics: %v", err)
+	}
+	second, err := New(reg, Options{Namespace: "app", ConstLabels: prometheus.Labels{"team": "a"}})
+	if err != nil {
+		t.Fatalf("expected creating metrics twice against one registry to succeed, got %v", err)
+	}
+	if first.RegistryCallsTotal != second.RegistryCallsTotal {
+		t.Fatal("expected the second Metrics to reuse the registered collectors")
+	}
+
+	second.RegistryCallsTotal.WithLabelValues("register", "http", "success").Inc()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %v", err)
+	}
+	found := false
+	for _, family := range families {
+		if family.GetName() == "app_registry_calls_total" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected metrics to be named after the namespace")
+	}
+}
@@ -0,0 +1,138 @@
+package registration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// coalesces heartbeats from several registrars sharing a client into batched registry calls
+type heartbeatBatcher struct {
+	client  registry.Client
+	tracer  trace.Tracer
+	window  time.Duration
+	timeout time.Duration
+
+	mu sync.Mutex
+	// lifecycle of the group the batcher belongs to; batched calls are made under it and cut short when it is cancelled
+	ctx       context.Context
+	cancel    context.CancelFunc
+	pending   map[string][]chan heartbeatOutcome
+	links     []trace.Link
+	scheduled bool
+}
+
+// result of a single instance's heartbeat handed back to its registrar
+type heartbeatOutcome struct {
+	lease api.Lease
+	err   error
+}
+
+// creates a new heartbeatBatcher that flushes collected heartbeats after the given window
+func newHeartbeatBatcher(client registry.Client, tracer trace.Tracer, window, timeout time.Duration) *heartbeatBatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &heartbeatBatcher{
+		client:  client,
+		tracer:  tracer,
+		window:  window,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[string][]chan heartbeatOutcome),
+	}
+}
+
+// binds the batcher to the lifecycle of its group, whose values such as trace context are carried by batched calls
+func (b *heartbeatBatcher) start(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cancel()
+	b.ctx, b.cancel = context.WithCancel(ctx)
+}
+
+// cancels the batched call in flight, if any, along with those of heartbeats still queued
+func (b *heartbeatBatcher) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cancel()
+}
+
+// queues a heartbeat for the instance and blocks until the batch containing it has been sent
+func (b *heartbeatBatcher) heartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	result := make(chan heartbeatOutcome, 1)
+
+	b.mu.Lock()
+	b.pending[instanceID] = append(b.pending[instanceID], result)
+	// the batched call serves several registrars, so their heartbeat spans are linked to it rather than parenting it
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		b.links = append(b.links, trace.Link{SpanContext: sc})
+	}
+	if !b.scheduled {
+		b.scheduled = true
+		time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case outcome := <-result:
+		return outcome.lease, outcome.err
+	case <-ctx.Done():
+		return api.Lease{}, ctx.Err()
+	}
+}
+
+// sends all queued heartbeats in a single call and hands each waiting registrar its own result
+func (b *heartbeatBatcher) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	links := b.links
+	lifecycle := b.ctx
+	b.pending = make(map[string][]chan heartbeatOutcome)
+	b.links = nil
+	b.scheduled = false
+	b.mu.Unlock()
+
+	instanceIDs := make([]string, 0, len(pending))
+	for instanceID := range pending {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	ctx, span := b.tracer.Start(lifecycle, "registrar.heartbeats", trace.WithLinks(links...), trace.WithAttributes(attribute.Int("flux.registry.batch_size", len(instanceIDs))))
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	results, err := b.client.SendHeartbeats(ctx, instanceIDs)
+	cancel()
+	endSpan(span, err)
+
+	resultsByID := make(map[string]api.HeartbeatResult, len(results))
+	for _, result := range results {
+		resultsByID[result.InstanceID] = result
+	}
+
+	for instanceID, waiters := range pending {
+		outcome := heartbeatOutcome{err: err}
+		if err == nil {
+			result, ok := resultsByID[instanceID]
+			switch {
+			case !ok:
+				outcome.err = fmt.Errorf("registration: registry returned no heartbeat result for instance '%s'", instanceID)
+			case result.NotRegistered:
+				outcome.err = fmt.Errorf("registration: heartbeat rejected for instance '%s', instance is not registered: %w", instanceID, registry.ErrNotFound)
+			case result.LeaseExpired:
+				outcome.err = fmt.Errorf("registration: heartbeat rejected for instance '%s': %w", instanceID, registry.ErrLeaseExpired)
+			case !result.Success:
+				outcome.err = fmt.Errorf("registration: heartbeat rejected for instance '%s': %s", instanceID, result.Message)
+			default:
+				outcome.lease = api.Lease{TTLSeconds: result.TTLSeconds}
+			}
+		}
+		for _, waiter := range waiters {
+			waiter <- outcome
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package registration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func newTestBatcher(client registry.Client, window time.Duration) *heartbeatBatcher {
+	return newHeartbeatBatcher(client, noop.NewTracerProvider().Tracer(tracerName), window, time.Second)
+}
+
+func TestBatcherCoalescesHeartbeatsWithinWindow(t *testing.T) {
+	client := &fakeClient{
+		sendHeartbeats: func(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+			results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+			for _, instanceID := range instanceIDs {
+				// results come back in a different order than requested
+				results = append([]api.HeartbeatResult{{InstanceID: instanceID, Success: true, TTLSeconds: int64(len(instanceID))}}, results...)
+			}
+			return results, nil
+		},
+	}
+	b := newTestBatcher(client, 50*time.Millisecond)
+
+	instanceIDs := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	leases := make([]api.Lease, len(instanceIDs))
+	errs := make([]error, len(instanceIDs))
+	var wg sync.WaitGroup
+	for i, instanceID := range instanceIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leases[i], errs[i] = b.heartbeat(context.Background(), instanceID)
+		}()
+	}
+	wg.Wait()
+
+	batches := client.recordedBatches()
+	if len(batches) != 1 {
+		t.Fatalf("expected heartbeats to be sent in 1 batch, got %d: %v", len(batches), batches)
+	}
+	sort.Strings(batches[0])
+	if fmt.Sprint(batches[0]) != fmt.Sprint(instanceIDs) {
+		t.Fatalf("expected batch %v, got %v", instanceIDs, batches[0])
+	}
+	for i, instanceID := range instanceIDs {
+		if errs[i] != nil {
+			t.Fatalf("heartbeat for %s failed: %v", instanceID, errs[i])
+		}
+		if leases[i].TTLSeconds != int64(len(instanceID)) {
+			t.Fatalf("expected %s to get its own lease TTL %d, got %d", instanceID, len(instanceID), leases[i].TTLSeconds)
+		}
+	}
+}
+
+func TestBatcherSendsSeparateBatchesForSeparateWindows(t *testing.T) {
+	client := &fakeClient{}
+	b := newTestBatcher(client, 10*time.Millisecond)
+
+	for _, instanceID := range []string{"a", "b"} {
+		if _, err := b.heartbeat(context.Background(), instanceID); err != nil {
+			t.Fatalf("heartbeat for %s failed: %v", instanceID, err)
+		}
+	}
+	if batches := client.recordedBatches(); len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %v", batches)
+	}
+}
+
+func TestBatcherFansOutPerInstanceResults(t *testing.T) {
+	client := &fakeClient{
+		sendHeartbeats: func(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+			return []api.HeartbeatResult{
+				{InstanceID: "ok", Success: true, TTLSeconds: 30},
+				{InstanceID: "unknown", NotRegistered: true},
+				{InstanceID: "expired", LeaseExpired: true},
+				{InstanceID: "rejected", Message: "nope"},
+			}, nil
+		},
+	}
+	b := newTestBatcher(client, 20*time.Millisecond)
+
+	type outcome struct {
+		lease api.Lease
+		err   error
+	}
+	instanceIDs := []string{"ok", "ok", "unknown", "expired", "rejected", "missing"}
+	outcomes := make([]outcome, len(instanceIDs))
+	var wg sync.WaitGroup
+	for i, instanceID := range instanceIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lease, err := b.heartbeat(context.Background(), instanceID)
+			outcomes[i] = outcome{lease, err}
+		}()
+	}
+	wg.Wait()
+
+	if batches := client.recordedBatches(); len(batches) != 1 || len(batches[0]) != 5 {
+		t.Fatalf("expected 1 batch of 5 distinct instances, got %v", batches)
+	}
+	for i := range 2 {
+		if outcomes[i].err != nil || outcomes[i].lease.TTLSeconds != 30 {
+			t.Fatalf("expected both waiters of ok to be renewed for 30s, got %+v", outcomes[i])
+		}
+	}
+	if !errors.Is(outcomes[2].err, registry.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unregistered instance, got %v", outcomes[2].err)
+	}
+	if !errors.Is(outcomes[3].err, registry.ErrLeaseExpired) {
+		t.Fatalf("expected ErrLeaseExpired for an expired lease, got %v", outcomes[3].err)
+	}
+	if outcomes[4].err == nil || errors.Is(outcomes[4].err, registry.ErrNotFound) {
+		t.Fatalf("expected a plain rejection, got %v", outcomes[4].err)
+	}
+	if outcomes[5].err == nil {
+		t.Fatal("expected an error for an instance missing from the results")
+	}
+}
+
+func TestBatcherHandsCallErrorToEveryWaiter(t *testing.T) {
+	callErr := &registry.Error{Kind: registry.ErrUnavailable, Err: errors.New("down")}
+	client := &fakeClient{
+		sendHeartbeats: func(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+			return nil, callErr
+		},
+	}
+	b := newTestBatcher(client, 20*time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = b.heartbeat(context.Background(), fmt.Sprintf("i%d", i))
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if !errors.Is(err, registry.ErrUnavailable) {
+			t.Fatalf("waiter %d: expected ErrUnavailable, got %v", i, err)
+		}
+	}
+}
+
+func TestBatcherStopCancelsCallInFlight(t *testing.T) {
+	sent := make(chan struct{})
+	client := &fakeClient{
+		sendHeartbeats: func(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+			close(sent)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	b := newHeartbeatBatcher(client, noop.NewTracerProvider().Tracer(tracerName), time.Millisecond, time.Minute)
+	b.start(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.heartbeat(context.Background(), "a")
+		done <- err
+	}()
+	<-sent
+	b.stop()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the heartbeat to fail with context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop did not cancel the batched call in flight")
+	}
+}
+
+func TestBatcherCallsCarryLifecycleContext(t *testing.T) {
+	type key struct{}
+	got := make(chan any, 1)
+	client := &fakeClient{
+		sendHeartbeats: func(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+			got <- ctx.Value(key{})
+			return []api.HeartbeatResult{{InstanceID: "a", Success: true}}, nil
+		},
+	}
+	b := newTestBatcher(client, time.Millisecond)
+	b.start(context.WithValue(context.Background(), key{}, "group"))
+
+	if _, err := b.heartbeat(context.Background(), "a"); err != nil {
+		t.Fatalf("heartbeat failed: %v", err)
+	}
+	if value := <-got; value != "group" {
+		t.Fatalf("expected the batched call to carry the group's context, got %v", value)
+	}
+}
@@ -0,0 +1,89 @@
+package registration
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// registry.Client whose calls are recorded and answered by the functions set on it
+type fakeClient struct {
+	register       func(ctx context.Context, instance api.ServiceInstance) (api.Lease, error)
+	sendHeartbeat  func(ctx context.Context, instanceID string) (api.Lease, error)
+	sendHeartbeats func(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error)
+	deregister     func(ctx context.Context, instanceID string) error
+
+	mu    sync.Mutex
+	calls []string
+	// instance IDs of every SendHeartbeats call, in order
+	batches [][]string
+}
+
+func (c *fakeClient) record(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+func (c *fakeClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	c.record("register")
+	if c.register == nil {
+		return api.Lease{}, nil
+	}
+	return c.register(ctx, instance)
+}
+
+func (c *fakeClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	c.record("heartbeat")
+	if c.sendHeartbeat == nil {
+		return api.Lease{}, nil
+	}
+	return c.sendHeartbeat(ctx, instanceID)
+}
+
+func (c *fakeClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, "heartbeats")
+	c.batches = append(c.batches, append([]string(nil), instanceIDs...))
+	c.mu.Unlock()
+	if c.sendHeartbeats == nil {
+		results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+		for _, instanceID := range instanceIDs {
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, Success: true})
+		}
+		return results, nil
+	}
+	return c.sendHeartbeats(ctx, instanceIDs)
+}
+
+func (c *fakeClient) Deregister(ctx context.Context, instanceID string) error {
+	c.record("deregister")
+	if c.deregister == nil {
+		return nil
+	}
+	return c.deregister(ctx, instanceID)
+}
+
+func (c *fakeClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) Close() error {
+	c.record("close")
+	return nil
+}
+
+// returns the calls made so far
+func (c *fakeClient) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// returns the instance IDs of the SendHeartbeats calls made so far
+func (c *fakeClient) recordedBatches() [][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]string(nil), c.batches...)
+}
@@ -0,0 +1,117 @@
+package registration
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+// manages several service instances that share a single registry client
+// heartbeats from the group's registrars are coalesced into batched registry calls
+type Group struct {
+	client     registry.Client
+	breaker    *registry.CircuitBreaker
+	config     *Config
+	batcher    *heartbeatBatcher
+	mu         sync.Mutex
+	registrars []*Registrar
+}
+
+// creates a new Group and the registry client shared by its registrars
+func NewGroup(cfg *Config) (*Group, error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	client, breaker, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Group{
+		client:  client,
+		breaker: breaker,
+		config:  cfg,
+		batcher: newHeartbeatBatcher(client, tracerProvider(cfg).Tracer(tracerName), cfg.HeartbeatBatchWindow, cfg.CallTimeout),
+	}, nil
+}
+
+// adds a service instance to the group and returns its registrar
+// the registrar is started and stopped along with the group
+func (g *Group) Add(instance api.ServiceInstance) *Registrar {
+	r := &Registrar{
+		instance:      instance,
+		client:        g.client,
+		logger:        instanceLogger(g.config, instance),
+		metrics:       metricsFor(g.config),
+		tracer:        tracerProvider(g.config).Tracer(tracerName),
+		breaker:       g.breaker,
+		config:        g.config,
+		batcher:       g.batcher,
+		stopHeartbeat: make(chan struct{}),
+	}
+
+	g.mu.Lock()
+	g.registrars = append(g.registrars, r)
+	g.mu.Unlock()
+
+	return r
+}
+
+// returns the registrars added to the group
+func (g *Group) Registrars() []*Registrar {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Registrar(nil), g.registrars...)
+}
+
+// registers every instance in the group and starts their heartbeat loops
+// ctx is the lifecycle of the group, under which batched heartbeats are sent until it is cancelled or the group is stopped
+func (g *Group) Start(ctx context.Context) {
+	g.batcher.start(ctx)
+
+	g.mu.Lock()
+	registrars := append([]*Registrar(nil), g.registrars...)
+	g.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, r := range registrars {
+		wg.Add(1)
+		go func(r *Registrar) {
+			defer wg.Done()
+			r.Start(ctx)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// deregisters every instance in the group and closes the shared registry client
+func (g *Group) Stop(ctx context.Context) {
+	g.mu.Lock()
+	registrars := append([]*Registrar(nil), g.registrars...)
+	g.mu.Unlock()
+
+	// heartbeats still in flight would only hold up the registrars' deregistration; the registrars are told to stop
+	// first so that they do not take a cancelled heartbeat for a failure to re-register after
+	for _, r := range registrars {
+		r.halt()
+	}
+	g.batcher.stop()
+
+	var wg sync.WaitGroup
+	for _, r := range registrars {
+		wg.Add(1)
+		go func(r *Registrar) {
+			defer wg.Done()
+			r.Stop(ctx)
+		}(r)
+	}
+	wg.Wait()
+
+	if err := g.client.Close(); err != nil {
+		logger(g.config).Error("failed to close shared registry client connection", "error", err)
+	}
+	logger(g.config).Info("registrar group stopped", "registrars", len(registrars))
+}
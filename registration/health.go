@@ -0,0 +1,86 @@
+package registration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+// returns a health check that succeeds when a GET request to url is answered with a 2xx status
+// a nil client uses http.DefaultClient
+func HTTPHealthCheck(url string, client *http.Client) func(ctx context.Context) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("registration: failed to create health check request for %s: %w", url, err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("registration: health check request to %s failed: %w", url, err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("registration: health check at %s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// runs the configured health check, if any
+func (r *Registrar) runHealthCheck(ctx context.Context) error {
+	if r.config.HealthCheck == nil {
+		return nil
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
+	defer cancel()
+	return r.config.HealthCheck(checkCtx)
+}
+
+// runs the health check ahead of a heartbeat, moving the instance out of the registry when it starts failing and back in once it passes
+// returns true if the instance is healthy and registered, i.e. a heartbeat should be sent
+func (r *Registrar) checkHealth(ctx context.Context) bool {
+	err := r.runHealthCheck(ctx)
+
+	switch {
+	case err != nil && !r.unhealthy:
+		r.logger.Warn("health check failed, deregistering instance", "error", err)
+		r.recordError("health_check", err)
+		deregistrationCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
+		if deregisterErr := r.client.Deregister(deregistrationCtx, r.instance.ID); deregisterErr != nil {
+			// the registry drops the instance on its own once its lease runs out without heartbeats
+			r.logger.Error("deregistration of unhealthy instance failed", "error", deregisterErr)
+			r.recordError(registry.OpDeregister, deregisterErr)
+		}
+		cancel()
+		r.unhealthy = true
+		r.setState(StateUnhealthy)
+		return false
+	case err != nil:
+		r.logger.Debug("health check still failing", "error", err)
+		return false
+	case r.unhealthy:
+		r.logger.Info("health check passing again, registering instance")
+		r.unhealthy = false
+		r.setState(StateRegistering)
+		if registrationErr := r.registerWithRetry(ctx); registrationErr != nil {
+			r.logger.Error("registration after recovering from failed health check failed", "error", registrationErr)
+			r.recordError(registry.OpRegister, registrationErr)
+			r.setState(StateUnregistered)
+		} else {
+			r.logger.Info("service registered")
+			r.setState(StateRegistered)
+		}
+		// the fresh registration stands in for this interval's heartbeat
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,77 @@
+package registration
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+// returns a random delay within the first heartbeat interval, spreading out instances that start at the same time
+func heartbeatPhase(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(interval)))
+}
+
+// returns the delay before the next heartbeat: the interval with jitter applied, or longer if the registry asked to wait
+func (r *Registrar) nextHeartbeatDelay(interval time.Duration) time.Duration {
+	delay := interval
+	if jitter := r.config.HeartbeatJitter; jitter > 0 {
+		delay = time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	if r.retryAfter > delay {
+		delay = r.retryAfter
+	}
+	r.retryAfter = 0
+	return delay
+}
+
+// adjusts the heartbeat slowdown to the outcome of a heartbeat when AdaptiveHeartbeat is enabled
+// returns true if the registry signalled overload, in which case the heartbeat interval has been stretched
+func (r *Registrar) adaptHeartbeat(err error) bool {
+	if !r.config.AdaptiveHeartbeat {
+		return false
+	}
+
+	if err == nil {
+		// speeds back up gradually, so a registry that has just recovered is not hit at full rate by every instance at once
+		if r.slowdown > 1 {
+			r.slowdown = max(r.slowdown/2, 1)
+		}
+		return false
+	}
+	if !isOverload(err) {
+		return false
+	}
+
+	limit := float64(r.config.MaxHeartbeatInterval) / float64(r.config.HeartbeatInterval)
+	r.slowdown = min(max(r.slowdown, 1)*2, limit)
+	r.retryAfter = registry.RetryAfter(err)
+	return true
+}
+
+// reports whether a heartbeat failed because the registry is overloaded, throttling or unavailable, rather than because of the instance
+// errors produced by an open circuit breaker are excluded since the breaker already pauses heartbeats
+func isOverload(err error) bool {
+	if errors.Is(err, registry.ErrThrottled) {
+		return true
+	}
+	return errors.Is(err, registry.ErrUnavailable) && !errors.Is(err, registry.ErrCircuitOpen)
+}
+
+// stretches the interval by the current slowdown, up to MaxHeartbeatInterval and short enough for a granted lease to be renewed in time
+func (r *Registrar) slowedInterval(interval time.Duration) time.Duration {
+	limit := r.config.MaxHeartbeatInterval
+	if r.lease.TTLSeconds > 0 {
+		limit = min(limit, time.Duration(float64(r.lease.TTL())*(1-r.config.HeartbeatJitter)))
+	}
+
+	slowed := time.Duration(float64(interval) * r.slowdown)
+	if slowed > limit {
+		slowed = limit
+	}
+	return max(slowed, interval)
+}
@@ -0,0 +1,124 @@
+package registration
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+func TestHeartbeatPhaseStaysWithinInterval(t *testing.T) {
+	interval := 10 * time.Second
+	seen := map[time.Duration]bool{}
+	for range 1000 {
+		phase := heartbeatPhase(interval)
+		if phase < 0 || phase >= interval {
+			t.Fatalf("phase %v outside [0, %v)", phase, interval)
+		}
+		seen[phase] = true
+	}
+	if len(seen) < 900 {
+		t.Fatalf("expected phases to be spread out, got only %d distinct values", len(seen))
+	}
+	if phase := heartbeatPhase(0); phase != 0 {
+		t.Fatalf("expected no phase for a zero interval, got %v", phase)
+	}
+}
+
+func TestNextHeartbeatDelayAppliesJitter(t *testing.T) {
+	r := &Registrar{config: &Config{HeartbeatInterval: 10 * time.Second, HeartbeatJitter: 0.2}}
+	interval := 10 * time.Second
+	var below, above bool
+	for range 1000 {
+		delay := r.nextHeartbeatDelay(interval)
+		if delay < 8*time.Second || delay > 12*time.Second {
+			t.Fatalf("delay %v outside the 20%% jitter band around %v", delay, interval)
+		}
+		below = below || delay < interval
+		above = above || delay > interval
+	}
+	if !below || !above {
+		t.Fatal("expected jitter to both shorten and lengthen intervals")
+	}
+
+	r.config.HeartbeatJitter = 0
+	if delay := r.nextHeartbeatDelay(interval); delay != interval {
+		t.Fatalf("expected no jitter when disabled, got %v", delay)
+	}
+}
+
+func TestNextHeartbeatDelayHonorsRetryAfterOnce(t *testing.T) {
+	r := &Registrar{config: &Config{HeartbeatInterval: time.Second}, retryAfter: 30 * time.Second}
+	if delay := r.nextHeartbeatDelay(time.Second); delay != 30*time.Second {
+		t.Fatalf("expected the registry's requested delay, got %v", delay)
+	}
+	if delay := r.nextHeartbeatDelay(time.Second); delay != time.Second {
+		t.Fatalf("expected the requested delay to apply only once, got %v", delay)
+	}
+}
+
+func TestAdaptiveHeartbeatSlowsDownAndRecovers(t *testing.T) {
+	cfg := &Config{HeartbeatInterval: time.Second, AdaptiveHeartbeat: true, MaxHeartbeatInterval: 5 * time.Second}
+	r := &Registrar{config: cfg, slowdown: 1}
+	throttled := &registry.Error{Kind: registry.ErrThrottled, RetryAfter: 3 * time.Second, Err: errors.New("slow down")}
+
+	if !r.adaptHeartbeat(throttled) {
+		t.Fatal("expected throttling to be treated as overload")
+	}
+	if got := r.heartbeatInterval(); got != 2*time.Second {
+		t.Fatalf("expected the interval to double, got %v", got)
+	}
+	if r.retryAfter != 3*time.Second {
+		t.Fatalf("expected the registry's Retry-After to be kept, got %v", r.retryAfter)
+	}
+
+	unavailable := &registry.Error{Kind: registry.ErrUnavailable, Err: errors.New("down")}
+	for range 5 {
+		r.adaptHeartbeat(unavailable)
+	}
+	if got := r.heartbeatInterval(); got != 5*time.Second {
+		t.Fatalf("expected the interval to be capped at MaxHeartbeatInterval, got %v", got)
+	}
+
+	// a granted lease caps the interval further so that it is renewed before expiring
+	r.lease = api.Lease{TTLSeconds: 4}
+	if got := r.heartbeatInterval(); got != 4*time.Second {
+		t.Fatalf("expected the interval to be capped by the lease TTL, got %v", got)
+	}
+	r.lease = api.Lease{}
+
+	r.adaptHeartbeat(nil)
+	if got := r.heartbeatInterval(); got != 2500*time.Millisecond {
+		t.Fatalf("expected a success to halve the slowdown, got %v", got)
+	}
+	for range 5 {
+		r.adaptHeartbeat(nil)
+	}
+	if got := r.heartbeatInterval(); got != time.Second {
+		t.Fatalf("expected the interval to return to normal, got %v", got)
+	}
+}
+
+func TestAdaptiveHeartbeatIgnoresOtherFailures(t *testing.T) {
+	cfg := &Config{HeartbeatInterval: time.Second, AdaptiveHeartbeat: true, MaxHeartbeatInterval: 5 * time.Second}
+	r := &Registrar{config: cfg, slowdown: 1}
+
+	for _, err := range []error{
+		&registry.Error{Kind: registry.ErrNotFound, Err: errors.New("unknown")},
+		&registry.Error{Kind: registry.ErrUnavailable, Err: registry.ErrCircuitOpen},
+	} {
+		if r.adaptHeartbeat(err) {
+			t.Fatalf("expected %v not to be treated as overload", err)
+		}
+	}
+	if got := r.heartbeatInterval(); got != time.Second {
+		t.Fatalf("expected the interval to stay unchanged, got %v", got)
+	}
+
+	cfg.AdaptiveHeartbeat = false
+	if r.adaptHeartbeat(&registry.Error{Kind: registry.ErrThrottled, Err: errors.New("slow down")}) {
+		t.Fatal("expected overload to be ignored when AdaptiveHeartbeat is disabled")
+	}
+}
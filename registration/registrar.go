@@ -2,14 +2,18 @@ package registration
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/lokeshllkumar/flux/api"
 	"github.com/lokeshllkumar/flux/metrics"
 	"github.com/lokeshllkumar/flux/registry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // config for the registrar
@@ -20,8 +24,38 @@ type Config struct {
 	CallTimeout       time.Duration
 	MaxRetries        int
 	RetryDelay        time.Duration
+	// how long a Group waits to collect heartbeats from its registrars before sending them as one batch
+	HeartbeatBatchWindow time.Duration
+	// fraction of a registry-granted lease TTL after which the lease is renewed; HeartbeatInterval applies when no lease is granted
+	// 0 renews after a third of the TTL
+	LeaseRenewFraction float64
+	// fraction by which each heartbeat interval is randomly lengthened or shortened, so instances started together drift apart; 0 disables jitter
+	HeartbeatJitter float64
+	// slows heartbeats down while the registry signals overload instead of re-registering, and speeds them back up once it recovers
+	AdaptiveHeartbeat bool
+	// upper bound on the interval between heartbeats slowed down by AdaptiveHeartbeat; a granted lease caps it further so that it does not expire
+	MaxHeartbeatInterval time.Duration
+	// guards registry calls with a circuit breaker when set; heartbeats pause while the breaker is open
+	CircuitBreaker *registry.BreakerConfig
+	// checks the instance's own health before registering it and before every heartbeat; a failing instance is deregistered
+	// and registered again once the check passes. Runs with CallTimeout; see HTTPHealthCheck
+	HealthCheck func(ctx context.Context) error
+	// limits the rate of registry calls; registry.DefaultLimiter(), shared by every registrar in the process, is used when nil
+	// registry.NewLimiter(0, 0) disables rate limiting, leaving calls held back only while the registry is throttling
+	RateLimiter *registry.Limiter
+	// wrap the registry client, the first being outermost; tracing and metrics are always applied innermost and the circuit breaker sits outside all of them
+	Middlewares []registry.Middleware
+	// provides the tracer for registry calls and registrar lifecycle spans; the global provider is used when nil
+	TracerProvider trace.TracerProvider
+	// receives the registrar's structured logs; slog.Default() is used when nil
+	Logger *slog.Logger
+	// receives the registrar's and registry client's metrics; metrics.Default() is used when nil
+	Metrics *metrics.Metrics
 }
 
+// fraction of a lease TTL after which it is renewed when the config leaves LeaseRenewFraction unset
+const defaultLeaseRenewFraction = 1.0 / 3
+
 // returns a new Config with defaults
 func NewDefaultConfig() *Config {
 	return &Config{
@@ -29,6 +63,10 @@ func NewDefaultConfig() *Config {
 		CallTimeout: 5 * time.Second,
 		MaxRetries: 5,
 		RetryDelay: 1 * time.Second,
+		HeartbeatBatchWindow: 500 * time.Millisecond,
+		LeaseRenewFraction: defaultLeaseRenewFraction,
+		HeartbeatJitter: 0.1,
+		MaxHeartbeatInterval: 1 * time.Minute,
 	}
 }
 
@@ -36,67 +74,216 @@ func NewDefaultConfig() *Config {
 type Registrar struct {
 	instance api.ServiceInstance
 	client registry.Client
+	logger *slog.Logger
+	metrics *metrics.Metrics
+	tracer trace.Tracer
+	breaker *registry.CircuitBreaker // wraps client when a circuit breaker is configured
 	config *Config
+	batcher *heartbeatBatcher // set when the registrar belongs to a Group sharing its client
+	lease api.Lease // lease most recently granted or renewed by the registry
+	intervalOverride time.Duration // heartbeat interval requested by the registry, takes precedence over the lease
+	slowdown float64 // factor by which AdaptiveHeartbeat has stretched the heartbeat interval, 1 when the registry is healthy
+	retryAfter time.Duration // minimum wait before the next heartbeat, as asked for by an overloaded registry
+	drained bool // set once the registry has asked the instance to drain and it has deregistered
+	unhealthy bool // set while the instance is deregistered because its health check is failing
+	heartbeatFailures int // heartbeats failed in a row
+	lastHeartbeat time.Time // time of the last successful heartbeat
+	state State
+	recentErrors []StatusError
+	statusMu sync.Mutex // guards the fields reported by Status, which are otherwise only written by the registrar's own goroutines
 	wg sync.WaitGroup
 	stopHeartbeat chan struct{}
+	stopOnce sync.Once
 }
 
 // creates a new Registrar instance
 func NewRegistrar(instance api.ServiceInstance, cfg *Config) (*Registrar, error) {
-	if cfg == nil {
-		return nil, fmt.Errorf("registration: config cannot be nil")
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
 	}
-	if cfg.RegistryURL == "" {
-		return nil, fmt.Errorf("registration: RegistryURL must be provided in the config")
+
+	client, breaker, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newRegistrar(instance, client, breaker, cfg), nil
+}
+
+// creates a new Registrar around a registry client created by the caller, e.g. for a backend that is not registered with the registry package
+// the client is wrapped in the configured middlewares and circuit breaker like any other, RegistryURL and RegistryType are optional and only
+// label its metrics and spans, and the registrar closes the client when it stops
+func NewRegistrarWithClient(instance api.ServiceInstance, client registry.Client, cfg *Config) (*Registrar, error) {
+	if client == nil {
+		return nil, fmt.Errorf("registration: client cannot be nil")
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	backend := cfg.RegistryType
+	if backend == "" {
+		backend = "custom"
+	}
+	wrapped, breaker, err := wrapClient(client, backend, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newRegistrar(instance, wrapped, breaker, cfg), nil
+}
+
+// assembles a Registrar around a client already wrapped by wrapClient
+func newRegistrar(instance api.ServiceInstance, client registry.Client, breaker *registry.CircuitBreaker, cfg *Config) *Registrar {
+	return &Registrar{
+		instance: instance,
+		client: client,
+		logger: instanceLogger(cfg, instance),
+		metrics: metricsFor(cfg),
+		tracer: tracerProvider(cfg).Tracer(tracerName),
+		breaker: breaker,
+		config: cfg,
+		stopHeartbeat: make(chan struct{}),
+	}
+}
+
+// checks that the config holds usable values
+func validateConfig(cfg *Config) error {
+	if cfg == nil {
+		return fmt.Errorf("registration: config cannot be nil")
 	}
 	if cfg.HeartbeatInterval <= 0 {
-		return nil, fmt.Errorf("registration: HeartbeatInterval must be a positive duration")
+		return fmt.Errorf("registration: HeartbeatInterval must be a positive duration")
 	}
 	if cfg.CallTimeout <= 0 {
-		return nil, fmt.Errorf("registration: CallTimeout must be a positive duration")
+		return fmt.Errorf("registration: CallTimeout must be a positive duration")
 	}
 	if cfg.MaxRetries < 0 {
-		return nil, fmt.Errorf("registration: MaxRetries must be non-negative")
+		return fmt.Errorf("registration: MaxRetries must be non-negative")
 	}
 	if cfg.RetryDelay < 0 {
-		return nil, fmt.Errorf("registration: RetryDelay must be non-negative")
+		return fmt.Errorf("registration: RetryDelay must be non-negative")
+	}
+	if cfg.HeartbeatBatchWindow < 0 {
+		return fmt.Errorf("registration: HeartbeatBatchWindow must be non-negative")
+	}
+	if cfg.LeaseRenewFraction < 0 || cfg.LeaseRenewFraction > 1 {
+		return fmt.Errorf("registration: LeaseRenewFraction must be in the range [0, 1]")
 	}
+	if cfg.HeartbeatJitter < 0 || cfg.HeartbeatJitter >= 1 {
+		return fmt.Errorf("registration: HeartbeatJitter must be in the range [0, 1)")
+	}
+	if cfg.AdaptiveHeartbeat && cfg.MaxHeartbeatInterval < cfg.HeartbeatInterval {
+		return fmt.Errorf("registration: MaxHeartbeatInterval must not be shorter than HeartbeatInterval when AdaptiveHeartbeat is enabled")
+	}
+	return nil
+}
 
-	var client registry.Client
-	var err error
+// returns the Logger set in the config, falling back to the default logger
+func logger(cfg *Config) *slog.Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return slog.Default()
+}
 
-	switch cfg.RegistryType {
-	case "http":
-		client = registry.NewHTTPClient(cfg.RegistryURL, cfg.CallTimeout)
-	
-	case "grpc":
-		client, err = registry.NewGRPCClient(cfg.RegistryURL, cfg.CallTimeout)
-		if err != nil {
-			return nil, fmt.Errorf("registration: failed to create gRPC registry client: %w", err)
+// returns the Metrics set in the config, falling back to the default metrics
+func metricsFor(cfg *Config) *metrics.Metrics {
+	if cfg.Metrics != nil {
+		return cfg.Metrics
+	}
+	return metrics.Default()
+}
+
+// returns the Limiter set in the config, falling back to the process-wide limiter
+func rateLimiter(cfg *Config) *registry.Limiter {
+	if cfg.RateLimiter != nil {
+		return cfg.RateLimiter
+	}
+	return registry.DefaultLimiter()
+}
+
+// returns a logger whose records carry the fields identifying the instance
+func instanceLogger(cfg *Config, instance api.ServiceInstance) *slog.Logger {
+	return logger(cfg).With("service", instance.ServiceName, "instance_id", instance.ID)
+}
+
+// creates the registry client selected by the config's RegistryType, or by the scheme of its RegistryURL when RegistryType is empty,
+// wrapped in the configured middlewares and circuit breaker
+func newClient(cfg *Config) (registry.Client, *registry.CircuitBreaker, error) {
+	if cfg.RegistryURL == "" {
+		return nil, nil, fmt.Errorf("registration: RegistryURL must be provided in the config")
+	}
+	backend := cfg.RegistryType
+	if backend == "" {
+		var ok bool
+		if backend, ok = registry.BackendForURL(cfg.RegistryURL); !ok {
+			return nil, nil, fmt.Errorf("registration: RegistryType is empty and the scheme of RegistryURL '%s' selects no backend. Must be one of %s", cfg.RegistryURL, strings.Join(registry.Backends(), ", "))
 		}
-	default:
-		return nil, fmt.Errorf("registration: unsupported registry client type'%s'. Must be 'http' or 'grpc'", cfg.RegistryType)
 	}
 
-	return &Registrar{
-		instance: instance,
-		client: client,
-		config: cfg,
-		stopHeartbeat: make(chan struct{}),
-	}, nil
+	client, err := registry.NewClient(backend, cfg.RegistryURL, cfg.CallTimeout, registry.WithTracerProvider(tracerProvider(cfg)), registry.WithLogger(logger(cfg)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("registration: failed to create %s registry client: %w", backend, err)
+	}
+	return wrapClient(client, backend, cfg)
+}
+
+// wraps a registry client in the configured middlewares and circuit breaker; backend labels the client's spans and metrics
+func wrapClient(client registry.Client, backend string, cfg *Config) (registry.Client, *registry.CircuitBreaker, error) {
+	tp := tracerProvider(cfg)
+	if cfg.RegistryURL != "" {
+		metricsFor(cfg).RegistryEndpointInfo.WithLabelValues(backend, cfg.RegistryURL).Set(1)
+	}
+
+	// the rate limiter sits inside user middlewares so that retries are limited too, and outside tracing so that spans do not include time spent waiting
+	// metrics sit closest to the client so that they record every call actually made to the registry, within the call's span
+	middlewares := append(append([]registry.Middleware(nil), cfg.Middlewares...),
+		registry.RateLimit(rateLimiter(cfg), registry.WithMetrics(metricsFor(cfg)), registry.WithLogger(logger(cfg))),
+		registry.Tracing(registry.OpenTelemetrySpans(tp, backend)),
+		registry.Metrics(metricsFor(cfg), backend),
+	)
+	client = registry.Chain(client, middlewares...)
+
+	if cfg.CircuitBreaker == nil {
+		return client, nil, nil
+	}
+	name := cfg.RegistryURL
+	if name == "" {
+		name = backend
+	}
+	breaker, err := registry.NewCircuitBreaker(client, cfg.CircuitBreaker, name, registry.WithMetrics(metricsFor(cfg)))
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("registration: failed to create circuit breaker: %w", err)
+	}
+	return breaker, breaker, nil
 }
 
 // initiates the auto-registration process
 // performs initial registration and starts a gorouting to perform periodic heartbeats
 func (r *Registrar) Start(ctx context.Context) {
-	log.Printf("Registration: Attempting initial registration for service '%s' (ID: %s)...", r.instance.ServiceName, r.instance.ID)
-	err := r.registerWithRetry(ctx)
+	// the span only covers initial registration, ctx itself is kept for the heartbeat loop that outlives it
+	startCtx, span := r.startSpan(ctx, "registrar.start")
+	if err := r.runHealthCheck(startCtx); err != nil {
+		endSpan(span, err)
+		r.logger.Warn("instance unhealthy, deferring registration until its health check passes", "error", err)
+		r.unhealthy = true
+		r.setState(StateUnhealthy)
+		r.wg.Add(1)
+		go r.runHeartbeatLoop(ctx)
+		return
+	}
+
+	r.logger.Info("attempting initial registration")
+	r.setState(StateRegistering)
+	err := r.registerWithRetry(startCtx)
+	endSpan(span, err)
 	if err != nil {
-		log.Printf("Registration: Initial registration for '%s' (ID: %s) failed after retries: %v", r.instance.ServiceName, r.instance.ID, err)
-		metrics.RegistrarStateGauge.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(0)
+		r.logger.Error("initial registration failed after retries", "error", err)
+		r.recordError(registry.OpRegister, err)
+		r.setState(StateUnregistered)
 	} else {
-		log.Printf("Registration: Service '%s' (ID: %s) successfully registered", r.instance.ServiceName, r.instance.ID)
-		metrics.RegistrarStateGauge.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(1)
+		r.logger.Info("service registered")
+		r.setState(StateRegistered)
 	}
 
 	r.wg.Add(1)
@@ -106,82 +293,348 @@ func (r *Registrar) Start(ctx context.Context) {
 // sends periodic heartbeats to the service registry for health checks and attempts re-registration of the service in the event of a heartbeat failure
 func (r *Registrar) runHeartbeatLoop(ctx context.Context) {
 	defer r.wg.Done()
-	ticker := time.NewTicker(r.config.HeartbeatInterval)
-	defer ticker.Stop()
+	interval := r.heartbeatInterval()
+	// instances started by the same deploy begin at a random point of their first interval rather than in lockstep
+	timer := time.NewTimer(heartbeatPhase(interval))
+	defer timer.Stop()
+
+	// registries reachable over a long-lived connection may push commands to the instance
+	source, _ := registry.CommandSourceOf(r.client)
+	var commands <-chan registry.Command
+	paused := false
 
 	for {
+		// deregistering, e.g. while the instance fails its health check, ends the subscription, so it is renewed every time round
+		if source != nil {
+			commands = source.Commands(r.instance.ID)
+		}
+		fired := false
 		select {
-		case <- ticker.C:
-			heartbeatCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
-			err := r.client.SendHeartbeat(heartbeatCtx, r.instance.ID)
-			cancel()
-
-			if err != nil {
-				log.Printf("Heartbeat failed for '%s' (ID: %s): %v. Attempting to re-register...", r.instance.ServiceName, r.instance.ID, err)
-				registrationErr := r.registerWithRetry(ctx)
+		case <- timer.C:
+			fired = true
+			// while the registry is failing, heartbeats and re-registrations would only add to its load
+			if r.breaker != nil && r.breaker.State() == registry.BreakerOpen {
+				if !paused {
+					r.logger.Warn("circuit breaker open, pausing heartbeats")
+					paused = true
+				}
+				break
+			}
+			if paused {
+				r.logger.Info("circuit breaker no longer open, resuming heartbeats")
+				paused = false
+			}
+
+			// an instance failing its own health check is kept out of the registry rather than heartbeating
+			if !r.checkHealth(ctx) {
+				break
+			}
+
+			heartbeatCtx, span := r.startSpan(ctx, "registrar.heartbeat")
+			lease, err := r.sendHeartbeat(heartbeatCtx)
+
+			r.recordHeartbeat(err)
+			overloaded := r.adaptHeartbeat(err)
+			if errors.Is(err, registry.ErrCircuitOpen) {
+				r.logger.Warn("heartbeat rejected by circuit breaker")
+			} else if overloaded {
+				// re-registering would only add to the registry's load; the lease is renewed once it recovers
+				r.recordError(registry.OpSendHeartbeat, err)
+				r.logger.Warn("registry overloaded, slowing heartbeats", "interval", r.heartbeatInterval(), "error", err)
+			} else if err != nil && r.stopping() {
+				// the heartbeat was cut short by Stop, which deregisters the instance instead
+				r.logger.Debug("heartbeat interrupted by shutdown", "error", err)
+				endSpan(span, err)
+				return
+			} else if err != nil {
+				r.recordError(registry.OpSendHeartbeat, err)
+				switch {
+				case errors.Is(err, registry.ErrNotFound):
+					r.logger.Warn("registry does not know the instance, it may have lost its state; re-registering immediately")
+				case errors.Is(err, registry.ErrLeaseExpired):
+					r.logger.Warn("lease expired, re-registering immediately", "lease_id", r.lease.ID)
+				default:
+					r.logger.Warn("heartbeat failed, attempting to re-register", "error", err)
+				}
+				registrationErr := r.reregister(heartbeatCtx, err)
 				if registrationErr != nil {
-					log.Printf("Re-registration after heartbeat failure failed for '%s' (ID %s): %v", r.instance.ServiceName, r.instance.ID, err)
-					metrics.RegistrarStateGauge.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(0)
+					r.logger.Error("re-registration after heartbeat failure failed", "error", registrationErr)
+					r.recordError(registry.OpRegister, registrationErr)
+					r.setState(StateUnregistered)
 				} else {
-					log.Printf("Service '%s' (ID: %s) successfully re-registered after heartbeat failure", r.instance.ServiceName, r.instance.ID)
-					metrics.RegistrarStateGauge.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(1)
+					r.logger.Info("service re-registered after heartbeat failure")
+					r.metrics.ReregistrationsTotal.WithLabelValues(r.instance.ID, r.instance.ServiceName).Inc()
+					r.setState(StateRegistered)
 				}
 			} else {
-				log.Printf("Heartbeat sent for service'%s' (ID: %s)", r.instance.ServiceName, r.instance.ID)
-				metrics.RegistrarStateGauge.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(1)
+				r.renewLease(lease)
+				r.logger.Debug("heartbeat sent")
+				r.setState(StateRegistered)
+			}
+			endSpan(span, err)
+		case cmd := <- commands:
+			if r.handleCommand(ctx, cmd) {
+				return
 			}
 		case <- r.stopHeartbeat:
-			log.Printf("Heartbeat loop for '%s' stopped", r.instance.ID)
+			r.logger.Debug("heartbeat loop stopped")
 			return
 		case <- ctx.Done():
-			log.Printf("Heartbeat loop for '%s' stopped due to context cancellation", r.instance.ServiceName)
+			r.logger.Info("heartbeat loop stopped due to context cancellation")
+			return
+		}
+
+		// follows the TTL granted by the registry, which may change on renewal, re-registration, by command or under overload
+		next := r.heartbeatInterval()
+		if fired || next != interval {
+			timer.Reset(r.nextHeartbeatDelay(next))
+		}
+		if next != interval {
+			interval = next
+			r.logger.Info("heartbeat interval adjusted", "interval", interval)
 		}
 	}
 }
 
-func (r *Registrar) registerWithRetry(ctx context.Context) error {
-	for i := 0; i < r.config.MaxRetries; i++ {
-		// fresh context used for each retry
-		callCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
-		err := r.client.Register(callCtx, r.instance)
+// carries out a command pushed by the registry; returns true if the heartbeat loop should end
+func (r *Registrar) handleCommand(ctx context.Context, cmd registry.Command) bool {
+	ctx, span := r.startSpan(ctx, "registrar.command", attribute.String("flux.registry.command", cmd.Type.String()))
+	defer span.End()
+
+	r.logger.Info("received command from registry", "command", cmd.Type.String())
+
+	switch cmd.Type {
+	case registry.CommandReregister:
+		// an unhealthy instance is registered again once its health check passes, not at the registry's request
+		if r.unhealthy {
+			r.logger.Info("ignoring re-registration request while instance is unhealthy")
+			break
+		}
+		if err := r.registerWithRetry(ctx); err != nil {
+			r.logger.Error("re-registration requested by registry failed", "error", err)
+			r.recordError(registry.OpRegister, err)
+			r.setState(StateUnregistered)
+		} else {
+			r.metrics.ReregistrationsTotal.WithLabelValues(r.instance.ID, r.instance.ServiceName).Inc()
+			r.setState(StateRegistered)
+		}
+	case registry.CommandDrain:
+		deregistrationCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
+		err := r.client.Deregister(deregistrationCtx, r.instance.ID)
 		cancel()
+		if err != nil {
+			r.logger.Error("deregistration while draining failed", "error", err)
+			r.recordError(registry.OpDeregister, err)
+		}
+		r.drained = true
+		r.setState(StateDrained)
+		r.logger.Info("service drained, heartbeats stopped")
+		return true
+	case registry.CommandChangeInterval:
+		r.intervalOverride = cmd.Interval
+	}
+	return false
+}
+
+// tracks consecutive heartbeat failures and the time of the last successful heartbeat
+func (r *Registrar) recordHeartbeat(err error) {
+	r.statusMu.Lock()
+	if err != nil {
+		r.heartbeatFailures++
+	} else {
+		r.heartbeatFailures = 0
+		r.lastHeartbeat = time.Now()
+	}
+	failures := r.heartbeatFailures
+	r.statusMu.Unlock()
+
+	if err == nil {
+		r.metrics.HeartbeatAgeSeconds.Touch(r.instance.ID, r.instance.ServiceName)
+	}
+	r.metrics.HeartbeatConsecutiveFailures.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(float64(failures))
+}
+
+// returns the interval between heartbeats, as requested by the registry or derived from the lease TTL when it grants one,
+// and stretched while AdaptiveHeartbeat has slowed heartbeats down
+func (r *Registrar) heartbeatInterval() time.Duration {
+	interval := r.config.HeartbeatInterval
+	if r.intervalOverride > 0 {
+		interval = r.intervalOverride
+	} else if r.lease.TTLSeconds > 0 {
+		interval = time.Duration(float64(r.lease.TTL()) * r.leaseRenewFraction())
+	}
+	if r.slowdown > 1 {
+		interval = r.slowedInterval(interval)
+	}
+	return interval
+}
+
+// returns the configured LeaseRenewFraction, or the default when it is unset
+func (r *Registrar) leaseRenewFraction() float64 {
+	if r.config.LeaseRenewFraction > 0 {
+		return r.config.LeaseRenewFraction
+	}
+	return defaultLeaseRenewFraction
+}
+
+// records a lease renewed by a heartbeat; renewals may omit the lease ID or TTL, in which case the current values are kept
+func (r *Registrar) renewLease(lease api.Lease) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	if lease.ID != "" {
+		r.lease.ID = lease.ID
+	}
+	if lease.TTLSeconds > 0 {
+		r.lease.TTLSeconds = lease.TTLSeconds
+	}
+}
 
+// sends a single heartbeat, coalescing it with those of other registrars when the registrar belongs to a Group
+func (r *Registrar) sendHeartbeat(ctx context.Context) (api.Lease, error) {
+	if r.batcher != nil {
+		return r.batcher.heartbeat(ctx, r.instance.ID)
+	}
+
+	heartbeatCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
+	defer cancel()
+	return r.client.SendHeartbeat(heartbeatCtx, r.instance.ID)
+}
+
+// re-registers the instance after a failed heartbeat
+// an instance the registry has forgotten or whose lease expired is re-registered at once, since the registry itself is reachable;
+// any other failure may be a connectivity problem and goes through the backoff path
+func (r *Registrar) reregister(ctx context.Context, heartbeatErr error) error {
+	if errors.Is(heartbeatErr, registry.ErrNotFound) || errors.Is(heartbeatErr, registry.ErrLeaseExpired) {
+		r.statusMu.Lock()
+		r.lease = api.Lease{}
+		r.statusMu.Unlock()
+		err := r.register(ctx)
+		if err == nil || !registry.IsRetryable(err) {
+			return err
+		}
+		r.logger.Warn("immediate re-registration failed, falling back to retries with backoff", "error", err)
+	}
+	return r.registerWithRetry(ctx)
+}
+
+// makes a single registration attempt and records the lease granted by the registry
+func (r *Registrar) register(ctx context.Context) error {
+	callCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
+	defer cancel()
+
+	lease, err := r.client.Register(callCtx, r.instance)
+	if err != nil {
+		return err
+	}
+	r.statusMu.Lock()
+	r.lease = lease
+	r.statusMu.Unlock()
+	return nil
+}
+
+// registers the instance, retrying with exponential backoff for as long as the registry's errors are retryable
+func (r *Registrar) registerWithRetry(ctx context.Context) (err error) {
+	ctx, span := r.startSpan(ctx, "registrar.register")
+	defer func() { endSpan(span, err) }()
+
+	attempts := 0
+	defer func() {
+		status := "success"
+		if err != nil {
+			status = "failure"
+		}
+		r.metrics.RegistrationAttempts.WithLabelValues(r.instance.ServiceName, status).Observe(float64(attempts))
+	}()
+
+	var lastErr error
+	for i := 0; i < r.config.MaxRetries; i++ {
+		attempts++
+		// fresh context used for each retry
+		err := r.register(ctx)
 		if err == nil {
 			return nil
 		}
+		lastErr = err
 
-		log.Printf("Registration attempt %d/%d failed for '%s' (ID: %s): %v. Retrying in %v...",
-					i + 1, r.config.MaxRetries, r.instance.ServiceName, r.instance.ID, err, r.config.RetryDelay * (time.Duration(1 << i))) // exponentially increasing wait time to not overwhelm the service registry
+		// the heartbeat loop picks registration back up once the circuit breaker lets calls through again
+		if errors.Is(err, registry.ErrCircuitOpen) {
+			return fmt.Errorf("registration: stopped retrying registration of service '%s' (ID: %s): %w", r.instance.ServiceName, r.instance.ID, err)
+		}
+		// requests rejected by the registry fail the same way on every attempt
+		if !registry.IsRetryable(err) {
+			return fmt.Errorf("registration: registry rejected registration of service '%s' (ID: %s): %w", r.instance.ServiceName, r.instance.ID, err)
+		}
+
+		delay := r.config.RetryDelay * time.Duration(1 << i) // exponentially increasing wait time to not overwhelm the service registry
+		// the registry's own estimate of when it can take requests again takes precedence over a shorter backoff
+		if retryAfter := registry.RetryAfter(err); retryAfter > delay {
+			delay = retryAfter
+		}
+
+		r.logger.Warn("registration attempt failed, retrying",
+					"operation", registry.OpRegister, "attempt", i + 1, "max_attempts", r.config.MaxRetries, "retry_in", delay, "error", err)
 		
 		select {
-		case <- time.After(r.config.RetryDelay * time.Duration(1 << i)):
+		case <- time.After(delay):
 			// next retry
 		case <- ctx.Done():
 			return fmt.Errorf("registration: aborted retry for '%s' due to context cancellation: %w", r.instance.ServiceName, ctx.Err())
 		}
 	}
-	return fmt.Errorf("registration: failed to regsiter service '%s' (ID: %s) after %d retries", r.instance.ServiceName, r.instance.ID, r.config.MaxRetries)
+	if lastErr == nil {
+		return fmt.Errorf("registration: failed to regsiter service '%s' (ID: %s) after %d retries", r.instance.ServiceName, r.instance.ID, r.config.MaxRetries)
+	}
+	return fmt.Errorf("registration: failed to regsiter service '%s' (ID: %s) after %d retries: %w", r.instance.ServiceName, r.instance.ID, r.config.MaxRetries, lastErr)
+}
+
+// signals the heartbeat loop to stop without waiting for it
+func (r *Registrar) halt() {
+	r.stopOnce.Do(func() { close(r.stopHeartbeat) })
+}
+
+// reports whether Stop has been called
+func (r *Registrar) stopping() bool {
+	select {
+	case <- r.stopHeartbeat:
+		return true
+	default:
+		return false
+	}
 }
 
 // initiates the graceful deregistering of the service and stops ongoing heartbeats
 func (r *Registrar) Stop(ctx context.Context) {
-	log.Printf("Registration: Initiating graceful shutdown for service '%s' (ID : %s)...", r.instance.ServiceName, r.instance.ID)
+	ctx, span := r.startSpan(ctx, "registrar.stop")
+	defer span.End()
 
-	close(r.stopHeartbeat)
+	r.logger.Info("initiating graceful shutdown")
+
+	r.halt()
 	r.wg.Wait()
 
 	deregistrationContext, cancel:= context.WithTimeout(ctx, r.config.CallTimeout)
 	defer cancel()
 
-	if err := r.client.Deregister(deregistrationContext, r.instance.ID); err != nil {
-		log.Printf("Registration: Deregistration failed for '%s' (ID: %s): %v", r.instance.ServiceName, r.instance.ID, err)
+	// a drained or unhealthy instance has already deregistered itself, one never started was never registered
+	if r.drained {
+		r.logger.Info("service already deregistered after draining")
+	} else if r.unhealthy {
+		r.logger.Info("service already deregistered after failing its health check")
+	} else if r.Status().State == StateIdle {
+		r.logger.Info("registrar was never started, nothing to deregister")
+	} else if err := r.client.Deregister(deregistrationContext, r.instance.ID); err != nil {
+		r.logger.Error("deregistration failed", "error", err)
+		r.recordError(registry.OpDeregister, err)
 	} else {
-		log.Printf("Registration: Service '%s' (ID: %s) successfully deregistered", r.instance.ServiceName, r.instance.ID)
+		r.logger.Info("service deregistered")
 	}
 
-	if err := r.client.Close(); err != nil {
-		log.Printf("Registration: Failed to close registry client connection: %v", err)
+	// a Group's shared client is closed by the Group itself
+	if r.batcher == nil {
+		if err := r.client.Close(); err != nil {
+			r.logger.Error("failed to close registry client connection", "error", err)
+		}
 	}
-	metrics.RegistrarStateGauge.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(0)
-	log.Println("Registration: Registrar stopped")
+	r.setState(StateStopped)
+	r.logger.Info("registrar stopped")
 }
\ No newline at end of file
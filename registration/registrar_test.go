@@ -0,0 +1,274 @@
+package registration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+)
+
+func TestValidateConfigDefaultsUnsetLeaseRenewFraction(t *testing.T) {
+	cfg := &Config{
+		RegistryURL:       "http://localhost:8080",
+		HeartbeatInterval: 10 * time.Second,
+		CallTimeout:       time.Second,
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("expected a config literal leaving LeaseRenewFraction unset to be valid, got %v", err)
+	}
+
+	r := &Registrar{config: cfg, lease: api.Lease{TTLSeconds: 30}}
+	if got := r.heartbeatInterval(); got != 10*time.Second {
+		t.Fatalf("expected a third of the 30s lease, got %v", got)
+	}
+
+	cfg.LeaseRenewFraction = 0.5
+	if got := r.heartbeatInterval(); got != 15*time.Second {
+		t.Fatalf("expected half of the 30s lease, got %v", got)
+	}
+
+	for _, fraction := range []float64{-0.1, 1.5} {
+		cfg.LeaseRenewFraction = fraction
+		if err := validateConfig(cfg); err == nil {
+			t.Fatalf("expected LeaseRenewFraction %v to be rejected", fraction)
+		}
+	}
+}
+
+func newTestRegistrar(t *testing.T, client *fakeClient, cfg *Config) *Registrar {
+	t.Helper()
+	r, err := NewRegistrarWithClient(api.ServiceInstance{ID: "i1", ServiceName: "svc"}, client, cfg)
+	if err != nil {
+		t.Fatalf("failed to create registrar: %v", err)
+	}
+	return r
+}
+
+func TestRegisterWithRetryStopsOnPermanentError(t *testing.T) {
+	client := &fakeClient{
+		register: func(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+			return api.Lease{}, &registry.Error{Kind: registry.ErrInvalid, Err: errors.New("bad request")}
+		},
+	}
+	cfg := NewDefaultConfig()
+	cfg.RetryDelay = time.Millisecond
+	r := newTestRegistrar(t, client, cfg)
+
+	err := r.registerWithRetry(context.Background())
+	if !errors.Is(err, registry.ErrInvalid) {
+		t.Fatalf("expected the registry's rejection to be returned, got %v", err)
+	}
+	if calls := client.recorded(); len(calls) != 1 {
+		t.Fatalf("expected a single registration attempt, got %v", calls)
+	}
+}
+
+func TestRegisterWithRetryHonorsRetryAfter(t *testing.T) {
+	attempts := 0
+	client := &fakeClient{
+		register: func(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+			attempts++
+			if attempts == 1 {
+				return api.Lease{}, &registry.Error{Kind: registry.ErrUnavailable, RetryAfter: 100 * time.Millisecond, Err: errors.New("down")}
+			}
+			return api.Lease{}, nil
+		},
+	}
+	cfg := NewDefaultConfig()
+	cfg.RetryDelay = time.Millisecond
+	r := newTestRegistrar(t, client, cfg)
+
+	start := time.Now()
+	if err := r.registerWithRetry(context.Background()); err != nil {
+		t.Fatalf("expected the second attempt to succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the registry's Retry-After to be waited out, retried after %v", elapsed)
+	}
+}
+
+func TestStopWithoutStartDoesNotDeregister(t *testing.T) {
+	client := &fakeClient{}
+	r := newTestRegistrar(t, client, NewDefaultConfig())
+
+	r.Stop(context.Background())
+	if calls := client.recorded(); slices.Contains(calls, "deregister") {
+		t.Fatalf("expected a registrar that was never started not to deregister, got %v", calls)
+	}
+	if state := r.Status().State; state != StateStopped {
+		t.Fatalf("expected state %s, got %s", StateStopped, state)
+	}
+}
+
+func TestNewRegistrarWithClientUsesGivenClient(t *testing.T) {
+	client := &fakeClient{}
+	r := newTestRegistrar(t, client, NewDefaultConfig())
+
+	r.Start(context.Background())
+	if !r.Ready() {
+		t.Fatalf("expected the registrar to be registered, got state %s", r.Status().State)
+	}
+	r.Stop(context.Background())
+	if calls := client.recorded(); !slices.Equal(calls, []string{"register", "deregister", "close"}) {
+		t.Fatalf("expected the registrar to register, deregister and close through the given client, got %v", calls)
+	}
+
+	if _, err := NewRegistrarWithClient(api.ServiceInstance{ID: "i1"}, nil, NewDefaultConfig()); err == nil {
+		t.Fatal("expected a nil client to be rejected")
+	}
+}
+
+// numbers the backends registered by tests, which cannot be unregistered, so that repeated runs pick fresh names
+var testBackends atomic.Int64
+
+func TestNewRegistrarPrefersRegistryTypeOverScheme(t *testing.T) {
+	client := &fakeClient{}
+	backend := fmt.Sprintf("test-backend-%d", testBackends.Add(1))
+	var gotURL string
+	registry.RegisterBackend(backend, func(registryURL string, timeout time.Duration, opts ...registry.Option) (registry.Client, error) {
+		gotURL = registryURL
+		return client, nil
+	})
+
+	cfg := NewDefaultConfig()
+	cfg.RegistryURL = "http://localhost:8080"
+	cfg.RegistryType = backend
+	r, err := NewRegistrar(api.ServiceInstance{ID: "i1", ServiceName: "svc"}, cfg)
+	if err != nil {
+		t.Fatalf("failed to create registrar: %v", err)
+	}
+	if gotURL != cfg.RegistryURL {
+		t.Fatalf("expected the %s backend to be created for %s, got %q", backend, cfg.RegistryURL, gotURL)
+	}
+
+	r.Start(context.Background())
+	r.Stop(context.Background())
+	if calls := client.recorded(); !slices.Contains(calls, "register") {
+		t.Fatalf("expected the registration to go through the %s backend rather than http, got %v", backend, calls)
+	}
+
+	cfg.RegistryType = ""
+	cfg.RegistryURL = "zookeeper://localhost:2181"
+	if _, err := NewRegistrar(api.ServiceInstance{ID: "i1", ServiceName: "svc"}, cfg); err == nil {
+		t.Fatal("expected a URL whose scheme selects no backend to be rejected")
+	}
+}
+
+// records when the registrar registers and heartbeats, failing the first heartbeat with heartbeatErr and the registration
+// that follows it once with registerErr when set
+type reregistrationClient struct {
+	*fakeClient
+	mu         sync.Mutex
+	registers  []time.Time
+	heartbeats []time.Time
+}
+
+func newReregistrationClient(heartbeatErr, registerErr error) *reregistrationClient {
+	c := &reregistrationClient{}
+	c.fakeClient = &fakeClient{
+		register: func(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.registers = append(c.registers, time.Now())
+			if len(c.registers) == 2 && registerErr != nil {
+				return api.Lease{}, registerErr
+			}
+			return api.Lease{}, nil
+		},
+		sendHeartbeat: func(ctx context.Context, instanceID string) (api.Lease, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.heartbeats = append(c.heartbeats, time.Now())
+			if len(c.heartbeats) == 1 {
+				return api.Lease{}, heartbeatErr
+			}
+			return api.Lease{}, nil
+		},
+	}
+	return c
+}
+
+// waits until the client has seen at least the given numbers of registrations and heartbeats, returning their times
+func (c *reregistrationClient) waitFor(t *testing.T, registers, heartbeats int) ([]time.Time, []time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		gotRegisters, gotHeartbeats := slices.Clone(c.registers), slices.Clone(c.heartbeats)
+		c.mu.Unlock()
+		if len(gotRegisters) >= registers && len(gotHeartbeats) >= heartbeats {
+			return gotRegisters, gotHeartbeats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d registrations and %d heartbeats, got %d and %d", registers, heartbeats, len(gotRegisters), len(gotHeartbeats))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHeartbeatOfUnknownInstanceReregistersImmediately(t *testing.T) {
+	tests := []struct {
+		name string
+		kind error
+	}{
+		{name: "not found", kind: registry.ErrNotFound},
+		{name: "lease expired", kind: registry.ErrLeaseExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newReregistrationClient(&registry.Error{Kind: tt.kind, Err: errors.New("unknown instance")}, nil)
+			cfg := NewDefaultConfig()
+			cfg.HeartbeatInterval = 50 * time.Millisecond
+			cfg.HeartbeatJitter = 0
+			cfg.RetryDelay = time.Second
+			// the limiter shared by the process would space out registrations once earlier tests have used up its burst
+			cfg.RateLimiter = registry.NewLimiter(0, 0)
+			r := newTestRegistrar(t, client.fakeClient, cfg)
+			r.Start(context.Background())
+			defer r.Stop(context.Background())
+
+			registers, heartbeats := client.waitFor(t, 2, 3)
+			if gap := registers[1].Sub(heartbeats[0]); gap > 100*time.Millisecond {
+				t.Fatalf("expected the instance to be registered again right after the failed heartbeat, took %v", gap)
+			}
+			// the loop goes straight back to heartbeating at its interval rather than stalling in a backoff
+			if gap := heartbeats[1].Sub(registers[1]); gap > cfg.RetryDelay/2 {
+				t.Fatalf("expected heartbeats to resume at their interval after re-registering, took %v", gap)
+			}
+			if len(registers) != 2 {
+				t.Fatalf("expected a single re-registration, got %d registrations", len(registers))
+			}
+			if state := r.Status().State; state != StateRegistered {
+				t.Fatalf("expected state %s, got %s", StateRegistered, state)
+			}
+		})
+	}
+}
+
+func TestHeartbeatConnectivityFailureReregistersWithBackoff(t *testing.T) {
+	unavailable := &registry.Error{Kind: registry.ErrUnavailable, Err: errors.New("connection refused")}
+	client := newReregistrationClient(unavailable, unavailable)
+	cfg := NewDefaultConfig()
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	cfg.HeartbeatJitter = 0
+	cfg.RetryDelay = 200 * time.Millisecond
+	cfg.RateLimiter = registry.NewLimiter(0, 0)
+	r := newTestRegistrar(t, client.fakeClient, cfg)
+	r.Start(context.Background())
+	defer r.Stop(context.Background())
+
+	registers, _ := client.waitFor(t, 3, 1)
+	if gap := registers[2].Sub(registers[1]); gap < cfg.RetryDelay {
+		t.Fatalf("expected the failed re-registration to be retried after a backoff of %v, retried after %v", cfg.RetryDelay, gap)
+	}
+	if state := r.Status().State; state != StateRegistered {
+		t.Fatalf("expected state %s, got %s", StateRegistered, state)
+	}
+}
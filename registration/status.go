@@ -0,0 +1,122 @@
+package registration
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// number of recent errors kept in a registrar's status
+const maxRecentErrors = 10
+
+// lifecycle state of a registrar
+type State int
+
+const (
+	// created but not yet started
+	StateIdle State = iota
+	// registering the instance with the registry
+	StateRegistering
+	// registered and renewing its registration with heartbeats
+	StateRegistered
+	// not registered, either because registration failed or because the registry lost the instance and re-registration has not succeeded yet
+	StateUnregistered
+	// deregistered at the registry's request, heartbeats have stopped
+	StateDrained
+	// stopped and deregistered
+	StateStopped
+	// deregistered because the instance's health check is failing, registered again once it passes
+	StateUnhealthy
+)
+
+// returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRegistering:
+		return "registering"
+	case StateRegistered:
+		return "registered"
+	case StateUnregistered:
+		return "unregistered"
+	case StateDrained:
+		return "drained"
+	case StateStopped:
+		return "stopped"
+	case StateUnhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
+// encodes the state by name
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// an error encountered by a registrar while talking to the registry
+type StatusError struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Error     string    `json:"error"`
+}
+
+// snapshot of a registrar's current state
+type Status struct {
+	Instance                     api.ServiceInstance `json:"instance"`
+	State                        State               `json:"state"`
+	Lease                        api.Lease           `json:"lease"`
+	LastHeartbeat                time.Time           `json:"lastHeartbeat,omitempty"`
+	ConsecutiveHeartbeatFailures int                 `json:"consecutiveHeartbeatFailures"`
+	// most recent errors, oldest first
+	RecentErrors []StatusError `json:"recentErrors"`
+}
+
+// returns a snapshot of the registrar's current state
+func (r *Registrar) Status() Status {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	return Status{
+		Instance:                     r.instance,
+		State:                        r.state,
+		Lease:                        r.lease,
+		LastHeartbeat:                r.lastHeartbeat,
+		ConsecutiveHeartbeatFailures: r.heartbeatFailures,
+		RecentErrors:                 append([]StatusError{}, r.recentErrors...),
+	}
+}
+
+// reports whether the instance is currently registered with the registry
+func (r *Registrar) Ready() bool {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	return r.state == StateRegistered
+}
+
+// moves the registrar to the given state and updates the state gauge
+func (r *Registrar) setState(state State) {
+	r.statusMu.Lock()
+	r.state = state
+	r.statusMu.Unlock()
+
+	value := 0.0
+	if state == StateRegistered {
+		value = 1
+	}
+	r.metrics.RegistrarState.WithLabelValues(r.instance.ID, r.instance.ServiceName).Set(value)
+}
+
+// keeps an error from a registry operation in the registrar's recent errors
+func (r *Registrar) recordError(operation string, err error) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	r.recentErrors = append(r.recentErrors, StatusError{Time: time.Now(), Operation: operation, Error: err.Error()})
+	if len(r.recentErrors) > maxRecentErrors {
+		r.recentErrors = r.recentErrors[len(r.recentErrors)-maxRecentErrors:]
+	}
+}
@@ -0,0 +1,40 @@
+package registration
+
+import (
+	"context"
+
+	"github.com/lokeshllkumar/flux/registry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation name of the tracer used for registrar lifecycle spans
+const tracerName = "github.com/lokeshllkumar/flux/registration"
+
+// returns the TracerProvider set in the config, falling back to the global provider
+func tracerProvider(cfg *Config) trace.TracerProvider {
+	if cfg.TracerProvider != nil {
+		return cfg.TracerProvider
+	}
+	return otel.GetTracerProvider()
+}
+
+// starts a span for a step of the registrar's lifecycle, tagged with the instance it manages
+func (r *Registrar) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		registry.AttrServiceName.String(r.instance.ServiceName),
+		registry.AttrInstanceID.String(r.instance.ID),
+	)
+	return r.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// ends a lifecycle span, marking it as failed if the step returned an error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,111 @@
+package registration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/registry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return tp, exporter
+}
+
+// returns the ended spans with the given name
+func spansNamed(exporter *tracetest.InMemoryExporter, name string) []tracetest.SpanStub {
+	var spans []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func hasAttr(span tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegistrarLifecycleSpans(t *testing.T) {
+	tp, exporter := newTestTracerProvider(t)
+	heartbeats := make(chan struct{}, 10)
+	client := &fakeClient{
+		sendHeartbeat: func(ctx context.Context, instanceID string) (api.Lease, error) {
+			heartbeats <- struct{}{}
+			return api.Lease{}, nil
+		},
+	}
+	cfg := NewDefaultConfig()
+	cfg.TracerProvider = tp
+	cfg.HeartbeatInterval = 10 * time.Millisecond
+	r := newTestRegistrar(t, client, cfg)
+
+	r.Start(context.Background())
+	<-heartbeats
+	r.Stop(context.Background())
+
+	instanceAttrs := []attribute.KeyValue{registry.AttrServiceName.String("svc"), registry.AttrInstanceID.String("i1")}
+	for _, name := range []string{"registrar.start", "registrar.register", "registrar.heartbeat", "registrar.stop"} {
+		spans := spansNamed(exporter, name)
+		if len(spans) == 0 {
+			t.Fatalf("expected a %s span", name)
+		}
+		for _, kv := range instanceAttrs {
+			if !hasAttr(spans[0], kv) {
+				t.Fatalf("expected %s span to carry %s=%s, got %v", name, kv.Key, kv.Value.AsString(), spans[0].Attributes)
+			}
+		}
+	}
+
+	// registry calls made by the registrar are traced as children of its lifecycle spans
+	register := spansNamed(exporter, "registrar.register")[0]
+	calls := spansNamed(exporter, "registry.register")
+	if len(calls) != 1 || calls[0].Parent.SpanID() != register.SpanContext.SpanID() {
+		t.Fatalf("expected the registry.register span to be a child of registrar.register, got %+v", calls)
+	}
+	heartbeat := spansNamed(exporter, "registrar.heartbeat")[0]
+	calls = spansNamed(exporter, "registry.send_heartbeat")
+	if len(calls) == 0 || calls[0].Parent.SpanID() != heartbeat.SpanContext.SpanID() {
+		t.Fatal("expected the registry.send_heartbeat span to be a child of registrar.heartbeat")
+	}
+}
+
+func TestRegistrarSpanRecordsFailure(t *testing.T) {
+	tp, exporter := newTestTracerProvider(t)
+	client := &fakeClient{
+		register: func(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+			return api.Lease{}, &registry.Error{Kind: registry.ErrInvalid, Err: errors.New("bad instance")}
+		},
+	}
+	cfg := NewDefaultConfig()
+	cfg.TracerProvider = tp
+	r := newTestRegistrar(t, client, cfg)
+
+	if err := r.registerWithRetry(context.Background()); err == nil {
+		t.Fatal("expected registration to fail")
+	}
+	spans := spansNamed(exporter, "registrar.register")
+	if len(spans) != 1 || spans[0].Status.Code != codes.Error {
+		t.Fatalf("expected a failed registrar.register span, got %+v", spans)
+	}
+	calls := spansNamed(exporter, "registry.register")
+	if len(calls) != 1 || calls[0].Status.Code != codes.Error || calls[0].Status.Description != "bad instance" {
+		t.Fatalf("expected a failed registry.register span, got %+v", calls)
+	}
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// creates a Client for the registry at registryURL; the URL is passed as configured, scheme included,
+// so factories selected by scheme strip or translate it as the underlying client requires
+type BackendFactory func(registryURL string, timeout time.Duration, opts ...Option) (Client, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{}
+)
+
+// the backends shipped with flux, registered under the names accepted as registration.Config.RegistryType and as URL schemes
+func init() {
+	RegisterBackend("http", httpBackend)
+	RegisterBackend("https", httpBackend)
+	RegisterBackend("grpc", func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		return NewGRPCClient(strings.TrimPrefix(registryURL, "grpc://"), timeout, opts...)
+	})
+	RegisterBackend("consul", func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		if rest, ok := strings.CutPrefix(registryURL, "consul://"); ok {
+			registryURL = "http://" + rest
+		}
+		return NewConsulClient(registryURL, timeout, opts...), nil
+	})
+	RegisterBackend("etcd", NewEtcdClient)
+	RegisterBackend("dns", func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		return NewDNSClient(strings.Trim(strings.TrimPrefix(registryURL, "dns://"), "/"), nil, opts...), nil
+	})
+	RegisterBackend("file", func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		return NewFileClient(strings.TrimPrefix(registryURL, "file://"), 0, opts...)
+	})
+	RegisterBackend("gossip", func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		cfg, err := parseGossipURL(registryURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewGossipClient(cfg, opts...)
+	})
+}
+
+func httpBackend(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+	return NewHTTPClient(registryURL, timeout, opts...), nil
+}
+
+// makes a backend available under name, both as an explicit backend name and as the scheme of registry URLs
+// intended to be called from the init function of the package implementing the backend; panics if name is empty,
+// factory is nil or a backend is already registered under name
+func RegisterBackend(name string, factory BackendFactory) {
+	if name == "" {
+		panic("registry: RegisterBackend called with an empty name")
+	}
+	if factory == nil {
+		panic("registry: RegisterBackend called with a nil factory for " + name)
+	}
+
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[name]; ok {
+		panic("registry: RegisterBackend called twice for " + name)
+	}
+	backends[name] = factory
+}
+
+// returns the names of the registered backends, sorted
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// returns the name of the backend selected by the scheme of registryURL, e.g. "consul" for consul://localhost:8500
+// reports false when the URL has no scheme or no backend is registered for it
+func BackendForURL(registryURL string) (string, bool) {
+	u, err := url.Parse(registryURL)
+	if err != nil || u.Scheme == "" {
+		return "", false
+	}
+
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	if _, ok := backends[u.Scheme]; !ok {
+		return "", false
+	}
+	return u.Scheme, true
+}
+
+// creates a Client for the registry at registryURL using the named backend, or the backend selected by the URL's scheme when name is empty
+func NewClient(name, registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+	if name == "" {
+		var ok bool
+		if name, ok = BackendForURL(registryURL); !ok {
+			return nil, fmt.Errorf("registry: no backend given and none registered for the scheme of %q, registered backends: %s", registryURL, strings.Join(Backends(), ", "))
+		}
+	}
+
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("registry: unknown backend %q, registered backends: %s", name, strings.Join(Backends(), ", "))
+	}
+	return factory(registryURL, timeout, opts...)
+}
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// numbers the backends registered by tests, which cannot be unregistered, so that repeated runs pick fresh names
+var testBackends atomic.Int64
+
+func TestNewClientSelectsBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		registryURL string
+		want        string // type of the client created, empty when creation must fail
+	}{
+		{name: "http scheme", registryURL: "http://localhost:8080", want: "*registry.httpClient"},
+		{name: "grpc scheme", registryURL: "grpc://localhost:9090", want: "*registry.grpcClient"},
+		{name: "consul scheme", registryURL: "consul://localhost:8500", want: "*registry.consulClient"},
+		{name: "unknown scheme", registryURL: "zookeeper://localhost:2181"},
+		{name: "no scheme", registryURL: "localhost:8080"},
+		{name: "explicit backend overrides scheme", backend: "consul", registryURL: "http://localhost:8500", want: "*registry.consulClient"},
+		{name: "unknown explicit backend", backend: "zookeeper", registryURL: "http://localhost:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.backend, tt.registryURL, time.Second)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected no backend to be found, got %T", client)
+				}
+				if !strings.Contains(err.Error(), "registered backends: ") {
+					t.Fatalf("expected the error to list the registered backends, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			defer client.Close()
+			if got := fmt.Sprintf("%T", client); got != tt.want {
+				t.Fatalf("expected a %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewClientTranslatesBackendSchemes(t *testing.T) {
+	client, err := NewClient("", "consul://localhost:8500", time.Second)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if agentURL := client.(*consulClient).agentURL; agentURL != "http://localhost:8500" {
+		t.Fatalf("expected the consul scheme to be translated to http, got %s", agentURL)
+	}
+
+	client, err = NewClient("", "grpc://localhost:9090", time.Second)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+	if address := client.(*grpcClient).registryAddress; address != "localhost:9090" {
+		t.Fatalf("expected the grpc scheme to be stripped, got %s", address)
+	}
+}
+
+func TestRegisterBackendMakesThirdPartyBackendAvailable(t *testing.T) {
+	fake := &fakeClient{}
+	var gotURL string
+	var gotTimeout time.Duration
+	name := fmt.Sprintf("test-third-party-%d", testBackends.Add(1))
+	registryURL := name + "://registry.internal:7000"
+	RegisterBackend(name, func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		gotURL, gotTimeout = registryURL, timeout
+		return fake, nil
+	})
+
+	if selected, ok := BackendForURL(registryURL); !ok || selected != name {
+		t.Fatalf("expected the backend to be selected by its scheme, got %q, %v", selected, ok)
+	}
+	if !slices.Contains(Backends(), name) {
+		t.Fatalf("expected the backend to be listed, got %v", Backends())
+	}
+
+	client, err := NewClient("", registryURL, 3*time.Second)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if client != fake {
+		t.Fatalf("expected the factory's client, got %T", client)
+	}
+	if gotURL != registryURL || gotTimeout != 3*time.Second {
+		t.Fatalf("expected the factory to be given the URL as configured and the timeout, got %q, %v", gotURL, gotTimeout)
+	}
+}
+
+func TestRegisterBackendRejectsInvalidRegistrations(t *testing.T) {
+	factory := func(registryURL string, timeout time.Duration, opts ...Option) (Client, error) {
+		return &fakeClient{}, nil
+	}
+	tests := []struct {
+		name        string
+		backendName string
+		factory     BackendFactory
+	}{
+		{name: "duplicate", backendName: "http", factory: factory},
+		{name: "empty name", backendName: "", factory: factory},
+		{name: "nil factory", backendName: "test-nil-factory", factory: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected RegisterBackend to panic")
+				}
+			}()
+			RegisterBackend(tt.backendName, tt.factory)
+		})
+	}
+
+	// the backend registered first is kept
+	client, err := NewClient("http", "http://localhost:8080", time.Second)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, ok := client.(*httpClient); !ok {
+		t.Fatalf("expected the built-in http backend to be kept, got %T", client)
+	}
+}
@@ -0,0 +1,244 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/metrics"
+)
+
+// returned, classified as ErrUnavailable, for calls rejected while the circuit breaker is open
+var ErrCircuitOpen = errors.New("registry: circuit breaker open")
+
+// state of a circuit breaker
+type BreakerState int
+
+const (
+	// calls flow through to the registry
+	BreakerClosed BreakerState = iota
+	// calls are rejected without reaching the registry
+	BreakerOpen
+	// a limited number of probe calls are let through to test whether the registry has recovered
+	BreakerHalfOpen
+)
+
+// returns a readable name for the breaker state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// config for a circuit breaker
+type BreakerConfig struct {
+	// consecutive failed calls after which the breaker opens
+	FailureThreshold int
+	// how long the breaker stays open before letting probe calls through
+	OpenTimeout time.Duration
+	// probe calls let through while half-open; this many must succeed for the breaker to close again
+	HalfOpenMaxCalls int
+}
+
+// returns a new BreakerConfig with defaults
+func NewDefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenMaxCalls: 1,
+	}
+}
+
+// wraps a Client, rejecting calls while the registry is failing so that an outage is not made worse by retries
+// only failures that suggest the registry is unhealthy count against it; requests it rejected outright do not
+type CircuitBreaker struct {
+	client  Client
+	config  BreakerConfig
+	name    string
+	metrics *metrics.Metrics
+
+	mu                sync.Mutex
+	state             BreakerState
+	failures          int
+	openedAt          time.Time
+	halfOpenCalls     int
+	halfOpenSuccesses int
+}
+
+// creates a new CircuitBreaker around the client; the name labels the breaker's state metric
+func NewCircuitBreaker(client Client, cfg *BreakerConfig, name string, opts ...Option) (*CircuitBreaker, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("circuit_breaker: config cannot be nil")
+	}
+	if cfg.FailureThreshold <= 0 {
+		return nil, fmt.Errorf("circuit_breaker: FailureThreshold must be positive")
+	}
+	if cfg.OpenTimeout <= 0 {
+		return nil, fmt.Errorf("circuit_breaker: OpenTimeout must be a positive duration")
+	}
+	if cfg.HalfOpenMaxCalls <= 0 {
+		return nil, fmt.Errorf("circuit_breaker: HalfOpenMaxCalls must be positive")
+	}
+
+	b := &CircuitBreaker{
+		client:  client,
+		config:  *cfg,
+		name:    name,
+		metrics: newClientOptions(opts).metrics,
+	}
+	b.metrics.RegistryCircuitBreakerState.WithLabelValues(name).Set(float64(BreakerClosed))
+	return b, nil
+}
+
+// returns the breaker's current state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance()
+	return b.state
+}
+
+// returns the client wrapped by the breaker
+func (b *CircuitBreaker) Unwrap() Client {
+	return b.client
+}
+
+// moves an open breaker to half-open once its timeout has elapsed; must be called with mu held
+func (b *CircuitBreaker) advance() {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+}
+
+// changes the breaker's state and resets the counters of the state being entered; must be called with mu held
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	b.failures = 0
+	b.halfOpenCalls = 0
+	b.halfOpenSuccesses = 0
+	if state == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+	b.metrics.RegistryCircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
+
+// decides whether a call may go through to the registry
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance()
+	switch b.state {
+	case BreakerOpen:
+		return &Error{Kind: ErrUnavailable, RetryAfter: b.config.OpenTimeout - time.Since(b.openedAt), Err: ErrCircuitOpen}
+	case BreakerHalfOpen:
+		if b.halfOpenCalls >= b.config.HalfOpenMaxCalls {
+			return &Error{Kind: ErrUnavailable, Err: ErrCircuitOpen}
+		}
+		b.halfOpenCalls++
+	}
+	return nil
+}
+
+// records the outcome of a call that went through to the registry
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// cancelled calls say nothing about the registry's health
+	if errors.Is(err, context.Canceled) {
+		if b.state == BreakerHalfOpen && b.halfOpenCalls > 0 {
+			b.halfOpenCalls--
+		}
+		return
+	}
+	failed := IsRetryable(err)
+
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.setState(BreakerOpen)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.config.HalfOpenMaxCalls {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+func (b *CircuitBreaker) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	if err := b.allow(); err != nil {
+		return api.Lease{}, err
+	}
+	lease, err := b.client.Register(ctx, instance)
+	b.record(err)
+	return lease, err
+}
+
+func (b *CircuitBreaker) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	if err := b.allow(); err != nil {
+		return api.Lease{}, err
+	}
+	lease, err := b.client.SendHeartbeat(ctx, instanceID)
+	b.record(err)
+	return lease, err
+}
+
+func (b *CircuitBreaker) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	results, err := b.client.SendHeartbeats(ctx, instanceIDs)
+	b.record(err)
+	return results, err
+}
+
+// deregistration is never rejected: an instance shutting down during an outage would otherwise stay registered until its
+// lease runs out, so it gets a single best-effort call. Only while the breaker is closed does its outcome count, so that it
+// takes up none of the probe calls of a half-open breaker
+func (b *CircuitBreaker) Deregister(ctx context.Context, instanceID string) error {
+	b.mu.Lock()
+	b.advance()
+	closed := b.state == BreakerClosed
+	b.mu.Unlock()
+
+	err := b.client.Deregister(ctx, instanceID)
+	if closed {
+		b.record(err)
+	}
+	return err
+}
+
+func (b *CircuitBreaker) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	instances, err := b.client.GetHealthyServices(ctx, serviceName)
+	b.record(err)
+	return instances, err
+}
+
+func (b *CircuitBreaker) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+var errRegistryDown = &Error{Kind: ErrUnavailable, Err: errors.New("registry down")}
+
+func newTestBreaker(t *testing.T, client Client, threshold, halfOpenCalls int, openTimeout time.Duration) *CircuitBreaker {
+	t.Helper()
+	b, err := NewCircuitBreaker(client, &BreakerConfig{FailureThreshold: threshold, OpenTimeout: openTimeout, HalfOpenMaxCalls: halfOpenCalls}, t.Name())
+	if err != nil {
+		t.Fatalf("failed to create circuit breaker: %v", err)
+	}
+	return b
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	client := &fakeClient{err: errRegistryDown}
+	b := newTestBreaker(t, client, 3, 1, time.Hour)
+	ctx := context.Background()
+
+	for i := range 3 {
+		if b.State() != BreakerClosed {
+			t.Fatalf("expected the breaker to stay closed after %d failures", i)
+		}
+		b.SendHeartbeat(ctx, "i1")
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected the breaker to open after 3 failures, got %s", b.State())
+	}
+
+	_, err := b.SendHeartbeat(ctx, "i1")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected an open breaker to reject calls with ErrCircuitOpen classified as ErrUnavailable, got %v", err)
+	}
+	if n := client.count(OpSendHeartbeat); n != 3 {
+		t.Fatalf("expected the rejected call not to reach the registry, got %d calls", n)
+	}
+}
+
+func TestBreakerSuccessResetsFailureCount(t *testing.T) {
+	client := &fakeClient{err: errRegistryDown}
+	b := newTestBreaker(t, client, 3, 1, time.Hour)
+	ctx := context.Background()
+
+	b.SendHeartbeat(ctx, "i1")
+	b.SendHeartbeat(ctx, "i1")
+	client.setErr(nil)
+	b.SendHeartbeat(ctx, "i1")
+	client.setErr(errRegistryDown)
+	b.SendHeartbeat(ctx, "i1")
+	b.SendHeartbeat(ctx, "i1")
+
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected failures interrupted by a success not to open the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerIgnoresPermanentAndCancelledErrors(t *testing.T) {
+	client := &fakeClient{err: &Error{Kind: ErrInvalid, Err: errors.New("bad request")}}
+	b := newTestBreaker(t, client, 2, 1, time.Hour)
+	ctx := context.Background()
+
+	for range 5 {
+		b.Register(ctx, api.ServiceInstance{ID: "i1"})
+	}
+	client.setErr(context.Canceled)
+	for range 5 {
+		b.Register(ctx, api.ServiceInstance{ID: "i1"})
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected requests the registry rejected and cancelled calls not to open the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerHalfOpenProbesCloseOrReopen(t *testing.T) {
+	client := &fakeClient{err: errRegistryDown}
+	b := newTestBreaker(t, client, 1, 2, 20*time.Millisecond)
+	ctx := context.Background()
+
+	b.SendHeartbeat(ctx, "i1")
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected the breaker to open, got %s", b.State())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected the breaker to be half-open after its timeout, got %s", b.State())
+	}
+
+	// a failed probe opens the breaker again
+	b.SendHeartbeat(ctx, "i1")
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	client.setErr(nil)
+	if _, err := b.SendHeartbeat(ctx, "i1"); err != nil {
+		t.Fatalf("expected the first probe through, got %v", err)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected the breaker to stay half-open until 2 probes succeed, got %s", b.State())
+	}
+	if _, err := b.SendHeartbeat(ctx, "i1"); err != nil {
+		t.Fatalf("expected the second probe through, got %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected 2 successful probes to close the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerLimitsHalfOpenProbes(t *testing.T) {
+	block := make(chan struct{})
+	client := &blockingClient{fakeClient: &fakeClient{}, block: block}
+	b := newTestBreaker(t, client, 1, 1, 10*time.Millisecond)
+	ctx := context.Background()
+
+	client.fakeClient.setErr(errRegistryDown)
+	b.SendHeartbeat(ctx, "i1")
+	time.Sleep(20 * time.Millisecond)
+	client.fakeClient.setErr(nil)
+
+	done := make(chan struct{})
+	go func() {
+		client.blocking.Store(true)
+		b.SendHeartbeat(ctx, "i1")
+		close(done)
+	}()
+	for client.fakeClient.count(OpSendHeartbeat) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := b.SendHeartbeat(ctx, "i2"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected a second call while the probe is in flight to be rejected, got %v", err)
+	}
+	close(block)
+	<-done
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected the successful probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerLetsDeregisterThroughWhileOpen(t *testing.T) {
+	client := &fakeClient{err: errRegistryDown}
+	b := newTestBreaker(t, client, 1, 1, time.Hour)
+	ctx := context.Background()
+
+	b.SendHeartbeat(ctx, "i1")
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected the breaker to open, got %s", b.State())
+	}
+
+	client.setErr(nil)
+	if err := b.Deregister(ctx, "i1"); err != nil {
+		t.Fatalf("expected deregistration to go through an open breaker, got %v", err)
+	}
+	if n := client.count(OpDeregister); n != 1 {
+		t.Fatalf("expected 1 deregistration to reach the registry, got %d", n)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected deregistration not to change the state of an open breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerDeregisterTakesNoHalfOpenProbe(t *testing.T) {
+	client := &fakeClient{err: errRegistryDown}
+	b := newTestBreaker(t, client, 1, 1, 10*time.Millisecond)
+	ctx := context.Background()
+
+	b.SendHeartbeat(ctx, "i1")
+	time.Sleep(20 * time.Millisecond)
+	b.Deregister(ctx, "i1")
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected a failed deregistration not to reopen a half-open breaker, got %s", b.State())
+	}
+
+	client.setErr(nil)
+	if _, err := b.SendHeartbeat(ctx, "i2"); err != nil {
+		t.Fatalf("expected the probe to be let through after a deregistration, got %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected the probe to close the breaker, got %s", b.State())
+	}
+}
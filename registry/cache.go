@@ -0,0 +1,176 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// version of the discovery cache file format; files written in any other version are ignored
+const discoveryCacheVersion = 1
+
+// contents of the discovery cache file
+type discoveryCacheFile struct {
+	Version  int                              `json:"version"`
+	Services map[string]discoveryCacheService `json:"services"`
+}
+
+// last-known instances of a service and when the registry reported them
+type discoveryCacheService struct {
+	UpdatedAt time.Time             `json:"updatedAt"`
+	Instances []api.ServiceInstance `json:"instances"`
+}
+
+// keeps the last-known instances of every discovered service in memory and in a file
+type discoveryCache struct {
+	path   string
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	services map[string]discoveryCacheService
+}
+
+// returns a Middleware persisting the instances returned by GetHealthyServices to the file at path, so that a service started
+// while the registry is unreachable still finds its dependencies
+// the file is loaded when the middleware is created and serves as a bootstrap snapshot: a GetHealthyServices call failing with a
+// retryable error, i.e. because the registry is unavailable or throttling, returns the last-known instances of the service instead
+// of the error. The file is rewritten atomically whenever a service's instances change; a missing, corrupt or incompatible file
+// is logged and ignored
+func DiscoveryCache(path string, opts ...Option) Middleware {
+	o := newClientOptions(opts)
+	cache := &discoveryCache{
+		path:     path,
+		logger:   o.logger.With("cache", path),
+		services: map[string]discoveryCacheService{},
+	}
+	cache.load()
+
+	return func(next Client) Client {
+		return &discoveryCacheClient{Client: next, cache: cache}
+	}
+}
+
+// reads the cache file, leaving the cache empty if it cannot be used
+func (c *discoveryCache) load() {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Warn("failed to read discovery cache, starting without it", "error", err)
+		}
+		return
+	}
+
+	var file discoveryCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		c.logger.Warn("discovery cache is corrupt, starting without it", "error", err)
+		return
+	}
+	if file.Version != discoveryCacheVersion {
+		c.logger.Warn("discovery cache was written in an unsupported format version, starting without it", "version", file.Version, "supported_version", discoveryCacheVersion)
+		return
+	}
+	for name, service := range file.Services {
+		c.services[name] = service
+	}
+	c.logger.Debug("loaded discovery cache", "services", len(c.services))
+}
+
+// records the instances the registry returned for a service, rewriting the file if they changed
+func (c *discoveryCache) store(serviceName string, instances []api.ServiceInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, ok := c.services[serviceName]
+	c.services[serviceName] = discoveryCacheService{UpdatedAt: time.Now().UTC(), Instances: slices.Clone(instances)}
+	if ok && slices.Equal(previous.Instances, instances) {
+		// only the timestamp moved on, which is not worth a write on every discovery call
+		return
+	}
+	if err := c.write(); err != nil {
+		c.logger.Warn("failed to write discovery cache", "error", err)
+	}
+}
+
+// returns the last-known instances of a service and when the registry reported them
+func (c *discoveryCache) lookup(serviceName string) (discoveryCacheService, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	service, ok := c.services[serviceName]
+	service.Instances = slices.Clone(service.Instances)
+	return service, ok
+}
+
+// writes the cache to a temporary file in the same directory and renames it over the cache file,
+// so that readers, including a later process, never see a partially written file; the caller holds mu
+func (c *discoveryCache) write() error {
+	data, err := json.MarshalIndent(discoveryCacheFile{Version: discoveryCacheVersion, Services: c.services}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("registry: failed to marshal discovery cache: %w", err)
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("registry: failed to create discovery cache directory %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("registry: failed to create temporary discovery cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("registry: failed to write temporary discovery cache file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("registry: failed to sync temporary discovery cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("registry: failed to close temporary discovery cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("registry: failed to replace discovery cache file: %w", err)
+	}
+	return nil
+}
+
+// serves discovery calls from the cache while the registry is unreachable
+type discoveryCacheClient struct {
+	Client
+	cache *discoveryCache
+}
+
+func (c *discoveryCacheClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	instances, err := c.Client.GetHealthyServices(ctx, serviceName)
+	if err == nil {
+		c.cache.store(serviceName, instances)
+		return instances, nil
+	}
+	if !IsRetryable(err) {
+		return nil, err
+	}
+
+	cached, ok := c.cache.lookup(serviceName)
+	if !ok {
+		return nil, err
+	}
+	c.cache.logger.Warn("registry unreachable, serving last-known instances from the discovery cache",
+		"service", serviceName, "instances", len(cached.Instances), "age", time.Since(cached.UpdatedAt).Round(time.Second).String(), "error", err)
+	return cached.Instances, nil
+}
+
+// returns the client wrapped by the middleware
+func (c *discoveryCacheClient) Unwrap() Client {
+	return c.Client
+}
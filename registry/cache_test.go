@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+var cachedInstances = []api.ServiceInstance{
+	{ID: "billing-1", ServiceName: "billing", Host: "10.0.0.7", Port: 8000},
+	{ID: "billing-2", ServiceName: "billing", Host: "10.0.0.8", Port: 8000},
+}
+
+// reads the discovery cache file at path
+func readCacheFile(t *testing.T, path string) discoveryCacheFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read discovery cache: %v", err)
+	}
+	var file discoveryCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("failed to decode discovery cache %s: %v", data, err)
+	}
+	return file
+}
+
+func TestDiscoveryCachePersistsAndServesInstancesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache", "discovery.json")
+
+	client := DiscoveryCache(path)(&fakeClient{instances: cachedInstances})
+	if _, err := client.GetHealthyServices(ctx, "billing"); err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	file := readCacheFile(t, path)
+	if file.Version != discoveryCacheVersion || !slices.Equal(file.Services["billing"].Instances, cachedInstances) || file.Services["billing"].UpdatedAt.IsZero() {
+		t.Fatalf("expected the instances to be persisted, got %+v", file)
+	}
+
+	// a later process starting while the registry is down bootstraps from the file
+	unavailable := &fakeClient{err: &Error{Kind: ErrUnavailable, Err: errors.New("connection refused")}}
+	restarted := DiscoveryCache(path)(unavailable)
+	instances, err := restarted.GetHealthyServices(ctx, "billing")
+	if err != nil {
+		t.Fatalf("expected the cached instances to be served, got %v", err)
+	}
+	if !slices.Equal(instances, cachedInstances) {
+		t.Fatalf("expected %+v, got %+v", cachedInstances, instances)
+	}
+	if unavailable.count(OpGetHealthyServices) != 1 {
+		t.Fatal("expected the registry to be asked before falling back to the cache")
+	}
+
+	if _, err := restarted.GetHealthyServices(ctx, "search"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected the registry's error for a service missing from the cache, got %v", err)
+	}
+}
+
+func TestDiscoveryCacheReturnsNonRetryableErrors(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "discovery.json")
+	backend := &fakeClient{instances: cachedInstances}
+	client := DiscoveryCache(path)(backend)
+	if _, err := client.GetHealthyServices(ctx, "billing"); err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+
+	backend.setErr(&Error{Kind: ErrUnauthorized, Err: errors.New("forbidden")})
+	if instances, err := client.GetHealthyServices(ctx, "billing"); !errors.Is(err, ErrUnauthorized) || instances != nil {
+		t.Fatalf("expected a rejected request to be returned rather than served from the cache, got %+v, %v", instances, err)
+	}
+
+	backend.setErr(&Error{Kind: ErrThrottled, Err: errors.New("slow down")})
+	if instances, err := client.GetHealthyServices(ctx, "billing"); err != nil || !slices.Equal(instances, cachedInstances) {
+		t.Fatalf("expected throttling to be served from the cache, got %+v, %v", instances, err)
+	}
+}
+
+func TestDiscoveryCacheIgnoresUnusableFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "corrupt", contents: `{"version": 1, "services": {`},
+		{name: "unsupported version", contents: `{"version": 2, "services": {"billing": {"instances": [{"id": "billing-1", "serviceName": "billing"}]}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "discovery.json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o644); err != nil {
+				t.Fatalf("failed to write discovery cache: %v", err)
+			}
+
+			backend := &fakeClient{err: &Error{Kind: ErrUnavailable, Err: errors.New("connection refused")}}
+			client := DiscoveryCache(path)(backend)
+			if _, err := client.GetHealthyServices(ctx, "billing"); !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("expected the unusable file to be ignored, got %v", err)
+			}
+
+			// the next successful call replaces it
+			backend.setErr(nil)
+			backend.instances = cachedInstances
+			if _, err := client.GetHealthyServices(ctx, "billing"); err != nil {
+				t.Fatalf("get healthy services failed: %v", err)
+			}
+			if file := readCacheFile(t, path); file.Version != discoveryCacheVersion || len(file.Services["billing"].Instances) != 2 {
+				t.Fatalf("expected the file to be rewritten, got %+v", file)
+			}
+		})
+	}
+}
+
+func TestDiscoveryCacheWritesAtomicallyAndOnlyOnChange(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "discovery.json")
+	backend := &fakeClient{instances: cachedInstances}
+	client := DiscoveryCache(path)(backend)
+
+	if _, err := client.GetHealthyServices(ctx, "billing"); err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to list %s: %v", dir, err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "discovery.json" {
+		t.Fatalf("expected only the cache file, temporary files included, got %v", entries)
+	}
+
+	// unchanged instances are not written again
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("failed to remove discovery cache: %v", err)
+	}
+	if _, err := client.GetHealthyServices(ctx, "billing"); err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected unchanged instances not to rewrite the cache, got %v", err)
+	}
+
+	backend.mu.Lock()
+	backend.instances = cachedInstances[:1]
+	backend.mu.Unlock()
+	if _, err := client.GetHealthyServices(ctx, "billing"); err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	if file := readCacheFile(t, path); !slices.Equal(file.Services["billing"].Instances, cachedInstances[:1]) {
+		t.Fatalf("expected the changed instances to be written, got %+v", file)
+	}
+}
@@ -6,8 +6,9 @@ import (
 )
 
 type Client interface {
-	Register(ctx context.Context, instance api.ServiceInstance) error
-	SendHeartbeat(ctx context.Context, instanceID string) error
+	Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error)
+	SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error)
+	SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error)
 	Deregister(ctx context.Context, instanceID string) error
 	GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error)
 	Close() error
@@ -0,0 +1,58 @@
+package registry
+
+import "time"
+
+// kind of command a service registry can push to a registered instance
+type CommandType int
+
+const (
+	// asks the instance to register itself again
+	CommandReregister CommandType = iota + 1
+	// asks the instance to deregister and stop heartbeating, taking it out of rotation
+	CommandDrain
+	// asks the instance to heartbeat at a different interval
+	CommandChangeInterval
+)
+
+// returns a readable name for the command type
+func (t CommandType) String() string {
+	switch t {
+	case CommandReregister:
+		return "reregister"
+	case CommandDrain:
+		return "drain"
+	case CommandChangeInterval:
+		return "change_interval"
+	default:
+		return "unknown"
+	}
+}
+
+// command pushed by the service registry to a specific instance
+type Command struct {
+	Type       CommandType
+	InstanceID string
+	// new heartbeat interval, only set for CommandChangeInterval
+	Interval time.Duration
+}
+
+// implemented by clients whose registry can push commands to instances over a long-lived connection
+type CommandSource interface {
+	// returns the channel on which commands for the instance are delivered
+	Commands(instanceID string) <-chan Command
+}
+
+// returns the CommandSource behind a client, looking through clients that wrap others such as CircuitBreaker
+func CommandSourceOf(client Client) (CommandSource, bool) {
+	for client != nil {
+		if source, ok := client.(CommandSource); ok {
+			return source, true
+		}
+		wrapper, ok := client.(interface{ Unwrap() Client })
+		if !ok {
+			break
+		}
+		client = wrapper.Unwrap()
+	}
+	return nil, false
+}
@@ -0,0 +1,240 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// TTL of the check registered with each instance; heartbeats mark the check as passing
+const DefaultConsulCheckTTL = 30 * time.Second
+
+// how long an instance's check may stay critical before Consul removes the instance, Consul's minimum
+const consulDeregisterCriticalAfter = time.Minute
+
+// service metadata keys carrying the instance fields Consul has no place for
+const (
+	consulMetaURL        = "flux_url"
+	consulMetaHealthPath = "flux_health_path"
+)
+
+// implementing the Client interface on top of a Consul agent's HTTP API
+// instances are registered as agent services with a TTL check, heartbeats pass the check, and healthy instances are those whose checks all pass
+type consulClient struct {
+	agentURL   string
+	token      string
+	checkTTL   time.Duration
+	httpClient *http.Client
+}
+
+// service definition accepted by /v1/agent/service/register
+type consulServiceRegistration struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   consulCheck       `json:"Check"`
+}
+
+type consulCheck struct {
+	CheckID                        string `json:"CheckID"`
+	Name                           string `json:"Name"`
+	TTL                            string `json:"TTL"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+// entry returned by /v1/health/service/:service
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string            `json:"ID"`
+		Service string            `json:"Service"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+// creates a new consulClient talking to the Consul agent at agentURL, e.g. http://localhost:8500
+// the ACL token is read from CONSUL_HTTP_TOKEN, as with Consul's own tooling
+func NewConsulClient(agentURL string, timeout time.Duration, opts ...Option) Client {
+	o := newClientOptions(opts)
+	return &consulClient{
+		agentURL: strings.TrimSuffix(agentURL, "/"),
+		token:    os.Getenv("CONSUL_HTTP_TOKEN"),
+		checkTTL: DefaultConsulCheckTTL,
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: newTracingTransport(http.DefaultTransport, o),
+		},
+	}
+}
+
+// returns the ID of the TTL check registered along with an instance
+func consulCheckID(instanceID string) string {
+	return "service:" + instanceID
+}
+
+// registers the instance as an agent service with a TTL check; the returned lease is the check and its TTL
+func (c *consulClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	registration := consulServiceRegistration{
+		ID:      instance.ID,
+		Name:    instance.ServiceName,
+		Address: instance.Host,
+		Port:    instance.Port,
+		Meta:    map[string]string{},
+		Check: consulCheck{
+			CheckID:                        consulCheckID(instance.ID),
+			Name:                           "flux heartbeat",
+			TTL:                            c.checkTTL.String(),
+			DeregisterCriticalServiceAfter: consulDeregisterCriticalAfter.String(),
+		},
+	}
+	if instance.URL != "" {
+		registration.Meta[consulMetaURL] = instance.URL
+	}
+	if instance.HealthPath != "" {
+		registration.Meta[consulMetaHealthPath] = instance.HealthPath
+	}
+
+	payload, err := json.Marshal(registration)
+	if err != nil {
+		return api.Lease{}, fmt.Errorf("consul_client: failed to marshal service registration: %w", err)
+	}
+	if _, err := c.do(ctx, http.MethodPut, "/v1/agent/service/register", payload, "registration"); err != nil {
+		return api.Lease{}, err
+	}
+
+	// a freshly registered TTL check starts out critical, so it is passed straight away for the instance to show up as healthy
+	return c.SendHeartbeat(ctx, instance.ID)
+}
+
+// marks the instance's TTL check as passing
+func (c *consulClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	checkID := consulCheckID(instanceID)
+	if _, err := c.do(ctx, http.MethodPut, "/v1/agent/check/pass/"+url.PathEscape(checkID), nil, "heartbeat"); err != nil {
+		return api.Lease{}, err
+	}
+	return api.Lease{ID: checkID, TTLSeconds: int64(c.checkTTL / time.Second)}, nil
+}
+
+// passes the TTL checks of several instances; Consul has no batch endpoint, so each check is passed in turn
+// instances unknown to the agent are reported as not registered, any other failure fails the whole call
+func (c *consulClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		lease, err := c.SendHeartbeat(ctx, instanceID)
+		switch {
+		case err == nil:
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, Success: true, TTLSeconds: lease.TTLSeconds})
+		case errors.Is(err, ErrNotFound):
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, NotRegistered: true, Message: err.Error()})
+		default:
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// removes the instance and its check from the agent
+func (c *consulClient) Deregister(ctx context.Context, instanceID string) error {
+	_, err := c.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(instanceID), nil, "deregistration")
+	return err
+}
+
+// queries Consul's health API for instances of the service whose checks are all passing
+func (c *consulClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	body, err := c.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(serviceName)+"?passing=true", nil, "get_healthy_services")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []consulServiceEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("consul_client: failed to decode get_healthy_services response for %s: %w", serviceName, err)
+	}
+
+	instances := make([]api.ServiceInstance, 0, len(entries))
+	for _, entry := range entries {
+		// services registered without an address are reachable at their node's
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		instances = append(instances, api.ServiceInstance{
+			ID:          entry.Service.ID,
+			ServiceName: entry.Service.Service,
+			Host:        host,
+			Port:        entry.Service.Port,
+			URL:         entry.Service.Meta[consulMetaURL],
+			HealthPath:  entry.Service.Meta[consulMetaHealthPath],
+		})
+	}
+	return instances, nil
+}
+
+// sends a request to the Consul agent and returns the response body of a 200 response
+func (c *consulClient) do(ctx context.Context, method, path string, payload []byte, operation string) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.agentURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("consul_client: failed to create %s request: %w", operation, err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("consul_client: %s request aborted due to context: %w", operation, ctx.Err())
+		}
+		return nil, httpTransportError(fmt.Errorf("consul_client: failed to send %s request to %s: %w", operation, c.agentURL, err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, httpTransportError(fmt.Errorf("consul_client: failed to read %s response: %w", operation, err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("consul_client: %s failed, consul returned non-200 status: %d, body: %s", operation, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		// older Consul versions report an unknown check or service as an internal error
+		if resp.StatusCode == http.StatusInternalServerError && consulUnknownTarget(respBody) {
+			return nil, &Error{Kind: ErrNotFound, Err: err}
+		}
+		return nil, httpStatusError(resp, err)
+	}
+	return respBody, nil
+}
+
+// reports whether a Consul error body complains about an unknown check or service
+func consulUnknownTarget(body []byte) bool {
+	message := strings.ToLower(string(body))
+	return strings.Contains(message, "unknown check") || strings.Contains(message, "unknown service")
+}
+
+// closes idle connections to the agent
+func (c *consulClient) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
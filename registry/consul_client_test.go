@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// request received by the fake Consul agent
+type consulRequest struct {
+	method string
+	path   string
+	query  string
+	token  string
+	body   []byte
+}
+
+// Consul agent answering every request with the response set for its path, 200 and an empty body by default
+type fakeConsulAgent struct {
+	*httptest.Server
+	mu        sync.Mutex
+	requests  []consulRequest
+	responses map[string]func(w http.ResponseWriter)
+}
+
+func newFakeConsulAgent(t *testing.T) *fakeConsulAgent {
+	t.Helper()
+	a := &fakeConsulAgent{responses: map[string]func(w http.ResponseWriter){}}
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		a.mu.Lock()
+		a.requests = append(a.requests, consulRequest{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery, token: r.Header.Get("X-Consul-Token"), body: body})
+		respond := a.responses[r.URL.Path]
+		a.mu.Unlock()
+		if respond != nil {
+			respond(w)
+		}
+	}))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *fakeConsulAgent) respond(path string, respond func(w http.ResponseWriter)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.responses[path] = respond
+}
+
+func (a *fakeConsulAgent) received() []consulRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]consulRequest(nil), a.requests...)
+}
+
+func TestConsulClientRegistersServiceWithTTLCheck(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_TOKEN", "secret")
+	agent := newFakeConsulAgent(t)
+	client := NewConsulClient(agent.URL+"/", time.Second)
+
+	lease, err := client.Register(context.Background(), api.ServiceInstance{
+		ID:          "billing-1",
+		ServiceName: "billing",
+		Host:        "10.0.0.7",
+		Port:        8000,
+		URL:         "http://10.0.0.7:8000",
+		HealthPath:  "/health",
+	})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if want := (api.Lease{ID: "service:billing-1", TTLSeconds: 30}); lease != want {
+		t.Fatalf("expected lease %+v, got %+v", want, lease)
+	}
+
+	requests := agent.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected a registration followed by a check pass, got %+v", requests)
+	}
+	register, pass := requests[0], requests[1]
+	if register.method != http.MethodPut || register.path != "/v1/agent/service/register" {
+		t.Fatalf("expected PUT /v1/agent/service/register, got %s %s", register.method, register.path)
+	}
+	if register.token != "secret" {
+		t.Fatalf("expected the ACL token to be sent, got %q", register.token)
+	}
+
+	var registration consulServiceRegistration
+	if err := json.Unmarshal(register.body, &registration); err != nil {
+		t.Fatalf("failed to decode registration payload %s: %v", register.body, err)
+	}
+	want := consulServiceRegistration{
+		ID:      "billing-1",
+		Name:    "billing",
+		Address: "10.0.0.7",
+		Port:    8000,
+		Meta:    map[string]string{consulMetaURL: "http://10.0.0.7:8000", consulMetaHealthPath: "/health"},
+		Check: consulCheck{
+			CheckID:                        "service:billing-1",
+			Name:                           "flux heartbeat",
+			TTL:                            "30s",
+			DeregisterCriticalServiceAfter: "1m0s",
+		},
+	}
+	if registration.ID != want.ID || registration.Name != want.Name || registration.Address != want.Address || registration.Port != want.Port ||
+		registration.Check != want.Check || len(registration.Meta) != len(want.Meta) ||
+		registration.Meta[consulMetaURL] != want.Meta[consulMetaURL] || registration.Meta[consulMetaHealthPath] != want.Meta[consulMetaHealthPath] {
+		t.Fatalf("expected registration %+v, got %+v", want, registration)
+	}
+
+	if pass.method != http.MethodPut || pass.path != "/v1/agent/check/pass/service:billing-1" || len(pass.body) != 0 {
+		t.Fatalf("expected an empty PUT /v1/agent/check/pass/service:billing-1, got %s %s %q", pass.method, pass.path, pass.body)
+	}
+}
+
+func TestConsulClientHeartbeatsPassChecks(t *testing.T) {
+	agent := newFakeConsulAgent(t)
+	agent.respond("/v1/agent/check/pass/service:gone", func(w http.ResponseWriter) {
+		http.Error(w, `Unknown check ID "service:gone"`, http.StatusInternalServerError)
+	})
+	client := NewConsulClient(agent.URL, time.Second)
+
+	results, err := client.SendHeartbeats(context.Background(), []string{"i1", "gone", "i2"})
+	if err != nil {
+		t.Fatalf("heartbeats failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected a result per instance, got %+v", results)
+	}
+	if !results[0].Success || results[0].TTLSeconds != 30 || !results[2].Success {
+		t.Fatalf("expected known instances to succeed, got %+v", results)
+	}
+	if results[1].Success || !results[1].NotRegistered {
+		t.Fatalf("expected the unknown check to be reported as not registered, got %+v", results[1])
+	}
+
+	var paths []string
+	for _, r := range agent.received() {
+		if r.method != http.MethodPut {
+			t.Fatalf("expected checks to be passed with PUT, got %s %s", r.method, r.path)
+		}
+		paths = append(paths, r.path)
+	}
+	want := "/v1/agent/check/pass/service:i1 /v1/agent/check/pass/service:gone /v1/agent/check/pass/service:i2"
+	if got := strings.Join(paths, " "); got != want {
+		t.Fatalf("expected calls %s, got %s", want, got)
+	}
+
+	if _, err := client.SendHeartbeat(context.Background(), "gone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected an unknown check to be classified as not found, got %v", err)
+	}
+}
+
+func TestConsulClientDeregistersService(t *testing.T) {
+	agent := newFakeConsulAgent(t)
+	client := NewConsulClient(agent.URL, time.Second)
+
+	if err := client.Deregister(context.Background(), "billing-1"); err != nil {
+		t.Fatalf("deregister failed: %v", err)
+	}
+	requests := agent.received()
+	if len(requests) != 1 || requests[0].method != http.MethodPut || requests[0].path != "/v1/agent/service/deregister/billing-1" {
+		t.Fatalf("expected PUT /v1/agent/service/deregister/billing-1, got %+v", requests)
+	}
+
+	agent.respond("/v1/agent/service/deregister/billing-1", func(w http.ResponseWriter) {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	})
+	if err := client.Deregister(context.Background(), "billing-1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected a rejected token to be classified as unauthorized, got %v", err)
+	}
+}
+
+func TestConsulClientQueriesPassingInstances(t *testing.T) {
+	agent := newFakeConsulAgent(t)
+	agent.respond("/v1/health/service/billing", func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"ID": "billing-1", "Service": "billing", "Address": "10.0.0.7", "Port": 8000,
+				"Meta": {"flux_url": "http://10.0.0.7:8000", "flux_health_path": "/health"}}},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"ID": "billing-2", "Service": "billing", "Port": 8001}}
+		]`)
+	})
+	client := NewConsulClient(agent.URL, time.Second)
+
+	instances, err := client.GetHealthyServices(context.Background(), "billing")
+	if err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	want := []api.ServiceInstance{
+		{ID: "billing-1", ServiceName: "billing", Host: "10.0.0.7", Port: 8000, URL: "http://10.0.0.7:8000", HealthPath: "/health"},
+		{ID: "billing-2", ServiceName: "billing", Host: "10.0.0.2", Port: 8001},
+	}
+	if len(instances) != len(want) || instances[0] != want[0] || instances[1] != want[1] {
+		t.Fatalf("expected instances %+v, got %+v", want, instances)
+	}
+
+	requests := agent.received()
+	if len(requests) != 1 || requests[0].method != http.MethodGet || requests[0].query != "passing=true" {
+		t.Fatalf("expected GET /v1/health/service/billing?passing=true, got %+v", requests)
+	}
+}
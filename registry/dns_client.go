@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// looks up DNS SRV records; implemented by *net.Resolver
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// read-only Client discovering instances through DNS SRV records, for environments without a registry
+// the instances of a service are the targets of the _<service>._tcp.<domain> SRV records; instances are published
+// through DNS rather than by the client, so Register, SendHeartbeat(s) and Deregister return ErrUnsupported
+type dnsClient struct {
+	domain   string
+	resolver SRVResolver
+}
+
+// creates a new dnsClient resolving services under domain, e.g. "service.consul" or "svc.cluster.local"
+// a nil resolver uses net.DefaultResolver
+func NewDNSClient(domain string, resolver SRVResolver, opts ...Option) Client {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &dnsClient{
+		domain:   strings.TrimSuffix(domain, "."),
+		resolver: resolver,
+	}
+}
+
+func (c *dnsClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	return api.Lease{}, unsupported("dns_client", OpRegister)
+}
+
+func (c *dnsClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	return api.Lease{}, unsupported("dns_client", OpSendHeartbeat)
+}
+
+func (c *dnsClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	return nil, unsupported("dns_client", OpSendHeartbeats)
+}
+
+func (c *dnsClient) Deregister(ctx context.Context, instanceID string) error {
+	return unsupported("dns_client", OpDeregister)
+}
+
+// looks up the SRV records of the service; every target is reported as a healthy instance, in the order given by their priority and weight
+// a name with no records yields no instances
+func (c *dnsClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	_, records, err := c.resolver.LookupSRV(ctx, serviceName, "tcp", c.domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return []api.ServiceInstance{}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("dns_client: SRV lookup aborted due to context for %s: %w", serviceName, ctx.Err())
+		}
+		return nil, &Error{Kind: ErrUnavailable, Err: fmt.Errorf("dns_client: SRV lookup for _%s._tcp.%s failed: %w", serviceName, c.domain, err)}
+	}
+
+	instances := make([]api.ServiceInstance, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		port := int(record.Port)
+		instances = append(instances, api.ServiceInstance{
+			ID:          net.JoinHostPort(host, strconv.Itoa(port)),
+			ServiceName: serviceName,
+			Host:        host,
+			Port:        port,
+		})
+	}
+	return instances, nil
+}
+
+// nothing to close, lookups do not hold connections
+func (c *dnsClient) Close() error {
+	return nil
+}
+
+// returns the error reported by read-only backends for operations that would modify the registry
+func unsupported(backend, operation string) error {
+	return &Error{Kind: ErrUnsupported, Err: fmt.Errorf("%s: %s is not supported by this read-only discovery backend", backend, operation)}
+}
@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// SRVResolver answering with fixed records or a fixed error, recording the names it was asked for
+type fakeResolver struct {
+	records []*net.SRV
+	err     error
+	lookups []string
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups = append(r.lookups, "_"+service+"._"+proto+"."+name)
+	return "", r.records, r.err
+}
+
+func TestDNSClientMapsSRVRecordsToInstances(t *testing.T) {
+	resolver := &fakeResolver{records: []*net.SRV{
+		{Target: "billing-0.billing.svc.cluster.local.", Port: 8000, Priority: 10, Weight: 50},
+		{Target: "10.0.0.8", Port: 8001, Priority: 20, Weight: 10},
+	}}
+	client := NewDNSClient("svc.cluster.local.", resolver)
+
+	instances, err := client.GetHealthyServices(context.Background(), "billing")
+	if err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	want := []api.ServiceInstance{
+		{ID: "billing-0.billing.svc.cluster.local:8000", ServiceName: "billing", Host: "billing-0.billing.svc.cluster.local", Port: 8000},
+		{ID: "10.0.0.8:8001", ServiceName: "billing", Host: "10.0.0.8", Port: 8001},
+	}
+	if len(instances) != len(want) || instances[0] != want[0] || instances[1] != want[1] {
+		t.Fatalf("expected instances %+v, got %+v", want, instances)
+	}
+	if len(resolver.lookups) != 1 || resolver.lookups[0] != "_billing._tcp.svc.cluster.local" {
+		t.Fatalf("expected a lookup of _billing._tcp.svc.cluster.local, got %v", resolver.lookups)
+	}
+}
+
+func TestDNSClientLookupErrors(t *testing.T) {
+	client := NewDNSClient("example.com", &fakeResolver{err: &net.DNSError{Err: "no such host", Name: "_billing._tcp.example.com", IsNotFound: true}})
+	instances, err := client.GetHealthyServices(context.Background(), "billing")
+	if err != nil || instances == nil || len(instances) != 0 {
+		t.Fatalf("expected a name without records to yield no instances, got %+v, %v", instances, err)
+	}
+
+	client = NewDNSClient("example.com", &fakeResolver{err: &net.DNSError{Err: "server misbehaving", Name: "_billing._tcp.example.com", IsTemporary: true}})
+	if _, err := client.GetHealthyServices(context.Background(), "billing"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected a failed lookup to be classified as unavailable, got %v", err)
+	}
+}
+
+// checks that every operation modifying the registry is rejected as unsupported
+func assertReadOnly(t *testing.T, client Client) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("register: expected ErrUnsupported, got %v", err)
+	}
+	if _, err := client.SendHeartbeat(ctx, "i1"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("heartbeat: expected ErrUnsupported, got %v", err)
+	}
+	if _, err := client.SendHeartbeats(ctx, []string{"i1"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("heartbeats: expected ErrUnsupported, got %v", err)
+	}
+	if err := client.Deregister(ctx, "i1"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("deregister: expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestDNSClientIsReadOnly(t *testing.T) {
+	assertReadOnly(t, NewDNSClient("example.com", &fakeResolver{}))
+}
@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sentinel errors classifying registry failures; match them with errors.Is
+var (
+	// returned when the registry does not know the requested instance or service
+	ErrNotFound = errors.New("registry: not found")
+	// returned when the request conflicts with the registry's current state
+	ErrConflict = errors.New("registry: conflict")
+	// returned when the registry rejects the client's credentials or permissions
+	ErrUnauthorized = errors.New("registry: unauthorized")
+	// returned when the registry cannot be reached or is temporarily unable to serve requests
+	ErrUnavailable = errors.New("registry: unavailable")
+	// returned when the registry rejects the call because the client exceeded its rate limit; RetryAfter gives the delay it asked for
+	ErrThrottled = errors.New("registry: throttled")
+	// returned when the registry rejects the request as malformed
+	ErrInvalid = errors.New("registry: invalid request")
+	// returned when the registry reports that the instance's lease has expired and it must register again
+	ErrLeaseExpired = errors.New("registry: lease expired")
+	// returned by read-only discovery backends, such as DNS or a static file, for operations that would modify the registry
+	ErrUnsupported = errors.New("registry: operation not supported")
+)
+
+// error returned by registry clients, carrying the failure's classification alongside the underlying error
+type Error struct {
+	// one of the sentinel errors, nil when the failure could not be classified
+	Kind error
+	// delay requested by the registry before the call is retried, zero if none was given
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// exposes both the classification and the underlying error to errors.Is and errors.As
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// reports whether a failed registry call is worth retrying
+// requests the registry rejected outright will fail the same way again; connectivity failures and unclassified errors may not
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, ErrInvalid), errors.Is(err, ErrUnauthorized), errors.Is(err, ErrConflict), errors.Is(err, ErrNotFound), errors.Is(err, ErrUnsupported):
+		return false
+	default:
+		return true
+	}
+}
+
+// returns the delay the registry asked for before the call is retried, or zero if it gave none
+func RetryAfter(err error) time.Duration {
+	var registryErr *Error
+	if errors.As(err, &registryErr) {
+		return registryErr.RetryAfter
+	}
+	return 0
+}
+
+// classifies an error caused by a non-success HTTP response from the registry
+func httpStatusError(resp *http.Response, err error) error {
+	return &Error{
+		Kind:       httpStatusKind(resp.StatusCode),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Err:        err,
+	}
+}
+
+// maps an HTTP status code onto a sentinel error
+func httpStatusKind(code int) error {
+	switch {
+	case code == http.StatusBadRequest, code == http.StatusUnprocessableEntity:
+		return ErrInvalid
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return ErrUnauthorized
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusConflict:
+		return ErrConflict
+	case code == http.StatusGone:
+		return ErrLeaseExpired
+	case code == http.StatusTooManyRequests:
+		return ErrThrottled
+	case code >= http.StatusInternalServerError:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+// parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// classifies an error caused by a failed HTTP round trip to the registry
+func httpTransportError(err error) error {
+	return &Error{Kind: ErrUnavailable, Err: err}
+}
+
+// classifies an error caused by a failed gRPC call, using the status code and any RetryInfo detail sent by the registry
+func grpcStatusError(rpcErr error, err error) error {
+	st, ok := status.FromError(rpcErr)
+	if !ok {
+		return &Error{Err: err}
+	}
+
+	registryErr := &Error{Kind: grpcCodeKind(st.Code()), Err: err}
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok && retryInfo.GetRetryDelay() != nil {
+			registryErr.RetryAfter = retryInfo.GetRetryDelay().AsDuration()
+		}
+	}
+	return registryErr
+}
+
+// maps a gRPC status code onto a sentinel error
+func grpcCodeKind(code codes.Code) error {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return ErrInvalid
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return ErrUnauthorized
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return ErrConflict
+	case codes.ResourceExhausted:
+		return ErrThrottled
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
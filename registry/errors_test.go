@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestHTTPStatusClassification(t *testing.T) {
+	tests := []struct {
+		status    int
+		kind      error
+		retryable bool
+	}{
+		{http.StatusBadRequest, ErrInvalid, false},
+		{http.StatusUnprocessableEntity, ErrInvalid, false},
+		{http.StatusUnauthorized, ErrUnauthorized, false},
+		{http.StatusForbidden, ErrUnauthorized, false},
+		{http.StatusNotFound, ErrNotFound, false},
+		{http.StatusConflict, ErrConflict, false},
+		{http.StatusGone, ErrLeaseExpired, true},
+		{http.StatusTooManyRequests, ErrThrottled, true},
+		{http.StatusInternalServerError, ErrUnavailable, true},
+		{http.StatusServiceUnavailable, ErrUnavailable, true},
+		{http.StatusTeapot, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			_, err := NewHTTPClient(srv.URL, time.Second).Register(context.Background(), api.ServiceInstance{ID: "i1", ServiceName: "svc"})
+			if err == nil {
+				t.Fatal("expected registration to fail")
+			}
+			var registryErr *Error
+			if !errors.As(err, &registryErr) || registryErr.Kind != tt.kind {
+				t.Fatalf("expected kind %v, got %v", tt.kind, err)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Fatalf("expected errors.Is(err, %v)", tt.kind)
+			}
+			if IsRetryable(err) != tt.retryable {
+				t.Fatalf("expected IsRetryable %v for status %d", tt.retryable, tt.status)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportFailureIsUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	_, err := NewHTTPClient(srv.URL, time.Second).SendHeartbeat(context.Background(), "i1")
+	if !errors.Is(err, ErrUnavailable) || !IsRetryable(err) {
+		t.Fatalf("expected an unreachable registry to be a retryable ErrUnavailable, got %v", err)
+	}
+}
+
+func TestHTTPRetryAfterHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{header: "7", min: 7 * time.Second, max: 7 * time.Second},
+		{header: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 50 * time.Second, max: time.Minute},
+		{header: "soon"},
+		{header: "-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", tt.header)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			_, err := NewHTTPClient(srv.URL, time.Second).SendHeartbeat(context.Background(), "i1")
+			if got := RetryAfter(err); got < tt.min || got > tt.max {
+				t.Fatalf("expected Retry-After %q to give a delay in [%v, %v], got %v", tt.header, tt.min, tt.max, got)
+			}
+		})
+	}
+}
+
+func TestGRPCStatusClassification(t *testing.T) {
+	tests := []struct {
+		code      codes.Code
+		kind      error
+		retryable bool
+	}{
+		{codes.InvalidArgument, ErrInvalid, false},
+		{codes.OutOfRange, ErrInvalid, false},
+		{codes.Unauthenticated, ErrUnauthorized, false},
+		{codes.PermissionDenied, ErrUnauthorized, false},
+		{codes.NotFound, ErrNotFound, false},
+		{codes.AlreadyExists, ErrConflict, false},
+		{codes.Aborted, ErrConflict, false},
+		{codes.ResourceExhausted, ErrThrottled, true},
+		{codes.Unavailable, ErrUnavailable, true},
+		{codes.DeadlineExceeded, ErrUnavailable, true},
+		{codes.Internal, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			rpcErr := status.Error(tt.code, "failed")
+			err := grpcStatusError(rpcErr, fmt.Errorf("grpc_client: call failed: %w", rpcErr))
+
+			var registryErr *Error
+			if !errors.As(err, &registryErr) || registryErr.Kind != tt.kind {
+				t.Fatalf("expected kind %v, got %v", tt.kind, err)
+			}
+			if IsRetryable(err) != tt.retryable {
+				t.Fatalf("expected IsRetryable %v for %s", tt.retryable, tt.code)
+			}
+		})
+	}
+}
+
+func TestGRPCRetryInfoDetail(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)})
+	if err != nil {
+		t.Fatalf("failed to attach retry info: %v", err)
+	}
+	classified := grpcStatusError(st.Err(), st.Err())
+	if !errors.Is(classified, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", classified)
+	}
+	if got := RetryAfter(classified); got != 3*time.Second {
+		t.Fatalf("expected the RetryInfo delay of 3s, got %v", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", fmt.Errorf("aborted: %w", context.Canceled), false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"unclassified", errors.New("boom"), true},
+		{"unsupported", &Error{Kind: ErrUnsupported, Err: errors.New("read-only")}, false},
+		{"wrapped invalid", fmt.Errorf("outer: %w", &Error{Kind: ErrInvalid, Err: errors.New("bad")}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Fatalf("expected IsRetryable %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryMiddlewareHonorsRetryability(t *testing.T) {
+	client := &fakeClient{err: &Error{Kind: ErrInvalid, Err: errors.New("bad")}}
+	retrying := Retry(&RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond})(client)
+
+	retrying.Register(context.Background(), api.ServiceInstance{ID: "i1"})
+	if n := client.count(OpRegister); n != 1 {
+		t.Fatalf("expected a permanent error not to be retried, got %d attempts", n)
+	}
+
+	client.setErr(&Error{Kind: ErrUnavailable, RetryAfter: 50 * time.Millisecond, Err: errors.New("down")})
+	start := time.Now()
+	retrying.SendHeartbeat(context.Background(), "i1")
+	if n := client.count(OpSendHeartbeat); n != 3 {
+		t.Fatalf("expected a retryable error to be attempted 3 times, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the registry's Retry-After to be waited out between attempts, took %v", elapsed)
+	}
+}
@@ -0,0 +1,269 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// TTL of the lease each instance's key is attached to; heartbeats keep the lease alive
+const DefaultEtcdLeaseTTL = 30 * time.Second
+
+// prefix under which instances are stored, as <prefix><service name>/<instance ID>
+const EtcdKeyPrefix = "/flux/services/"
+
+// prefix of the index from instance IDs to the keys instances are stored under, as <prefix><instance ID>
+// each index key holds the instance's key and is attached to the same lease, so that an instance is found without knowing its service name
+const EtcdIndexPrefix = "/flux/instances/"
+
+// implementing the Client interface on top of etcd
+// each instance is stored as JSON under its own key attached to a lease: heartbeats keep the lease alive,
+// and a lease that runs out deletes the key, so every key under a service's prefix belongs to a live instance
+// an index key per instance, attached to the same lease, leads from the instance ID to its key
+type etcdClient struct {
+	client   *clientv3.Client
+	leaseTTL time.Duration
+	mu       sync.Mutex
+	// keys and leases of the instances registered through this client, so that heartbeats need not look them up
+	instances map[string]etcdRegistration
+}
+
+// key and lease of a registered instance
+type etcdRegistration struct {
+	key     string
+	leaseID clientv3.LeaseID
+}
+
+// creates a new etcdClient for the comma-separated etcd endpoints, e.g. "http://etcd-0:2379,http://etcd-1:2379"
+// an etcd:// scheme is accepted in place of http://
+func NewEtcdClient(endpoints string, timeout time.Duration, opts ...Option) (Client, error) {
+	o := newClientOptions(opts)
+
+	var urls []string
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(endpoint, "etcd://"); ok {
+			endpoint = "http://" + rest
+		}
+		urls = append(urls, endpoint)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("etcd_client: no etcd endpoints given")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   urls,
+		DialTimeout: timeout,
+		// flux logs through slog, etcd's own zap logging would only duplicate failures already reported as errors
+		Logger: zap.NewNop(),
+		DialOptions: []grpc.DialOption{
+			grpc.WithChainUnaryInterceptor(tracingUnaryInterceptor(o)),
+			grpc.WithChainStreamInterceptor(tracingStreamInterceptor(o)),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("etcd_client: failed to create etcd client for %s: %w", endpoints, err)
+	}
+
+	return &etcdClient{
+		client:    client,
+		leaseTTL:  DefaultEtcdLeaseTTL,
+		instances: map[string]etcdRegistration{},
+	}, nil
+}
+
+// returns the key an instance is stored under
+func etcdKey(serviceName, instanceID string) string {
+	return EtcdKeyPrefix + serviceName + "/" + instanceID
+}
+
+// returns the index key pointing to an instance's key
+func etcdIndexKey(instanceID string) string {
+	return EtcdIndexPrefix + instanceID
+}
+
+// writes the instance under its key and its index key, both attached to a newly granted lease; the lease of an earlier registration of the
+// instance is revoked
+func (c *etcdClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	value, err := json.Marshal(instance)
+	if err != nil {
+		return api.Lease{}, fmt.Errorf("etcd_client: failed to marshal instance: %w", err)
+	}
+
+	grant, err := c.client.Grant(ctx, int64(c.leaseTTL/time.Second))
+	if err != nil {
+		return api.Lease{}, etcdError(err, fmt.Errorf("etcd_client: failed to grant lease for instance %s: %w", instance.ID, err))
+	}
+
+	key := etcdKey(instance.ServiceName, instance.ID)
+	indexKey := etcdIndexKey(instance.ID)
+	// the index is read before it is overwritten, so that an earlier registration is found even if it was made by another process
+	resp, err := c.client.Txn(ctx).Then(
+		clientv3.OpGet(indexKey),
+		clientv3.OpPut(key, string(value), clientv3.WithLease(grant.ID)),
+		clientv3.OpPut(indexKey, key, clientv3.WithLease(grant.ID)),
+	).Commit()
+	if err != nil {
+		// the unused lease expires on its own, revoking it merely tidies up sooner
+		c.client.Revoke(context.WithoutCancel(ctx), grant.ID)
+		return api.Lease{}, etcdError(err, fmt.Errorf("etcd_client: failed to write key %s: %w", key, err))
+	}
+
+	c.mu.Lock()
+	c.instances[instance.ID] = etcdRegistration{key: key, leaseID: grant.ID}
+	c.mu.Unlock()
+	if previous := resp.Responses[0].GetResponseRange().Kvs; len(previous) > 0 && clientv3.LeaseID(previous[0].Lease) != grant.ID {
+		// the keys now belong to the new lease, revoking the old one only drops a key left behind under another service name
+		c.client.Revoke(context.WithoutCancel(ctx), clientv3.LeaseID(previous[0].Lease))
+	}
+
+	return api.Lease{ID: etcdLeaseID(grant.ID), TTLSeconds: grant.TTL}, nil
+}
+
+// renews the lease of the instance's key once
+func (c *etcdClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	registration, err := c.lookup(ctx, instanceID)
+	if err != nil {
+		return api.Lease{}, err
+	}
+
+	resp, err := c.client.KeepAliveOnce(ctx, registration.leaseID)
+	if err != nil {
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			c.forget(instanceID, registration.leaseID)
+		}
+		return api.Lease{}, etcdError(err, fmt.Errorf("etcd_client: failed to renew lease of instance %s: %w", instanceID, err))
+	}
+	return api.Lease{ID: etcdLeaseID(resp.ID), TTLSeconds: resp.TTL}, nil
+}
+
+// renews the leases of several instances; etcd has no batch keepalive, so each lease is renewed in turn
+// instances etcd does not know or whose leases expired are reported as such, any other failure fails the whole call
+func (c *etcdClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		lease, err := c.SendHeartbeat(ctx, instanceID)
+		switch {
+		case err == nil:
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, Success: true, TTLSeconds: lease.TTLSeconds})
+		case errors.Is(err, ErrNotFound):
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, NotRegistered: true, Message: err.Error()})
+		case errors.Is(err, ErrLeaseExpired):
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, LeaseExpired: true, Message: err.Error()})
+		default:
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// revokes the lease of the instance's keys, deleting the keys along with it
+func (c *etcdClient) Deregister(ctx context.Context, instanceID string) error {
+	registration, err := c.lookup(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.client.Revoke(ctx, registration.leaseID); err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return etcdError(err, fmt.Errorf("etcd_client: failed to revoke lease of instance %s: %w", instanceID, err))
+	}
+	// keys whose lease already ran out are gone as well, deleting them covers keys written without a lease
+	if _, err := c.client.Txn(ctx).Then(clientv3.OpDelete(registration.key), clientv3.OpDelete(etcdIndexKey(instanceID))).Commit(); err != nil {
+		return etcdError(err, fmt.Errorf("etcd_client: failed to delete key %s: %w", registration.key, err))
+	}
+	c.forget(instanceID, registration.leaseID)
+	return nil
+}
+
+// lists the instances stored under the service's prefix; every one of them holds a live lease
+func (c *etcdClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	resp, err := c.client.Get(ctx, EtcdKeyPrefix+serviceName+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, etcdError(err, fmt.Errorf("etcd_client: failed to list instances of %s: %w", serviceName, err))
+	}
+
+	instances := make([]api.ServiceInstance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var instance api.ServiceInstance
+		if err := json.Unmarshal(kv.Value, &instance); err != nil {
+			return nil, fmt.Errorf("etcd_client: failed to decode instance stored under %s: %w", kv.Key, err)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// returns the key and lease of an instance, reading the index for instances registered by other clients, e.g. before a restart
+func (c *etcdClient) lookup(ctx context.Context, instanceID string) (etcdRegistration, error) {
+	c.mu.Lock()
+	registration, ok := c.instances[instanceID]
+	c.mu.Unlock()
+	if ok {
+		return registration, nil
+	}
+
+	resp, err := c.client.Get(ctx, etcdIndexKey(instanceID))
+	if err != nil {
+		return etcdRegistration{}, etcdError(err, fmt.Errorf("etcd_client: failed to look up instance %s: %w", instanceID, err))
+	}
+	if len(resp.Kvs) == 0 {
+		return etcdRegistration{}, &Error{Kind: ErrNotFound, Err: fmt.Errorf("etcd_client: instance %s is not registered", instanceID)}
+	}
+	registration = etcdRegistration{key: string(resp.Kvs[0].Value), leaseID: clientv3.LeaseID(resp.Kvs[0].Lease)}
+
+	c.mu.Lock()
+	if _, ok := c.instances[instanceID]; !ok {
+		c.instances[instanceID] = registration
+	}
+	c.mu.Unlock()
+	return registration, nil
+}
+
+// drops a registration that no longer holds, unless the instance has registered again since
+func (c *etcdClient) forget(instanceID string, leaseID clientv3.LeaseID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if registration, ok := c.instances[instanceID]; ok && registration.leaseID == leaseID {
+		delete(c.instances, instanceID)
+	}
+}
+
+// formats a lease ID the way etcdctl prints it
+func etcdLeaseID(id clientv3.LeaseID) string {
+	return strconv.FormatInt(int64(id), 16)
+}
+
+// classifies an error returned by the etcd client
+func etcdError(etcdErr error, err error) error {
+	var rpcErr rpctypes.EtcdError
+	switch {
+	case errors.Is(etcdErr, rpctypes.ErrLeaseNotFound):
+		return &Error{Kind: ErrLeaseExpired, Err: err}
+	case errors.As(etcdErr, &rpcErr):
+		return &Error{Kind: grpcCodeKind(rpcErr.Code()), Err: err}
+	case errors.Is(etcdErr, context.DeadlineExceeded):
+		// the etcd client keeps retrying unreachable endpoints until the call's deadline
+		return &Error{Kind: ErrUnavailable, Err: err}
+	default:
+		return grpcStatusError(etcdErr, err)
+	}
+}
+
+// closes the connections to etcd
+func (c *etcdClient) Close() error {
+	return c.client.Close()
+}
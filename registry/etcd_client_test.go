@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// returns a loopback URL on a port that was free a moment ago
+func freeLoopbackURL(t *testing.T) url.URL {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+// starts a single-member etcd server for the test and returns its client endpoint
+func startEtcd(t *testing.T) string {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeLoopbackURL(t), freeLoopbackURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("failed to start etcd: %v", err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd did not become ready in time")
+	}
+	return clientURL.String()
+}
+
+func newTestEtcdClient(t *testing.T, endpoint string) *etcdClient {
+	t.Helper()
+	client, err := NewEtcdClient(endpoint, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to create etcd client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client.(*etcdClient)
+}
+
+func TestEtcdClientRegistersInstanceWithIndex(t *testing.T) {
+	ctx := context.Background()
+	client := newTestEtcdClient(t, startEtcd(t))
+	instance := api.ServiceInstance{ID: "billing-1", ServiceName: "billing", Host: "10.0.0.7", Port: 8000}
+
+	lease, err := client.Register(ctx, instance)
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if lease.ID == "" || lease.TTLSeconds != int64(DefaultEtcdLeaseTTL/time.Second) {
+		t.Fatalf("expected a lease of %v, got %+v", DefaultEtcdLeaseTTL, lease)
+	}
+
+	instances, err := client.GetHealthyServices(ctx, "billing")
+	if err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	if len(instances) != 1 || instances[0] != instance {
+		t.Fatalf("expected %+v, got %+v", instance, instances)
+	}
+
+	key, err := client.client.Get(ctx, "/flux/services/billing/billing-1")
+	if err != nil || len(key.Kvs) != 1 {
+		t.Fatalf("expected the instance key to exist, got %v, %v", key, err)
+	}
+	index, err := client.client.Get(ctx, "/flux/instances/billing-1")
+	if err != nil || len(index.Kvs) != 1 {
+		t.Fatalf("expected the index key to exist, got %v, %v", index, err)
+	}
+	if string(index.Kvs[0].Value) != "/flux/services/billing/billing-1" || index.Kvs[0].Lease != key.Kvs[0].Lease {
+		t.Fatalf("expected the index to point at the instance key under the same lease, got %s under lease %x", index.Kvs[0].Value, index.Kvs[0].Lease)
+	}
+}
+
+func TestEtcdClientFindsInstancesRegisteredBeforeRestart(t *testing.T) {
+	ctx := context.Background()
+	endpoint := startEtcd(t)
+	instance := api.ServiceInstance{ID: "billing-1", ServiceName: "billing"}
+	if _, err := newTestEtcdClient(t, endpoint).Register(ctx, instance); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	// a new client knows nothing of the registration and has to find it through the index
+	restarted := newTestEtcdClient(t, endpoint)
+	if _, err := restarted.SendHeartbeat(ctx, "billing-1"); err != nil {
+		t.Fatalf("heartbeat after restart failed: %v", err)
+	}
+	if err := restarted.Deregister(ctx, "billing-1"); err != nil {
+		t.Fatalf("deregister after restart failed: %v", err)
+	}
+
+	for _, prefix := range []string{EtcdKeyPrefix, EtcdIndexPrefix} {
+		resp, err := restarted.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			t.Fatalf("failed to count keys under %s: %v", prefix, err)
+		}
+		if resp.Count != 0 {
+			t.Fatalf("expected no keys left under %s, got %d", prefix, resp.Count)
+		}
+	}
+	if _, err := restarted.SendHeartbeat(ctx, "billing-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a deregistered instance not to be found, got %v", err)
+	}
+}
+
+func TestEtcdClientRevokesEarlierRegistration(t *testing.T) {
+	ctx := context.Background()
+	endpoint := startEtcd(t)
+	if _, err := newTestEtcdClient(t, endpoint).Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "old"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	client := newTestEtcdClient(t, endpoint)
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "new"}); err != nil {
+		t.Fatalf("register under another service name failed: %v", err)
+	}
+
+	old, err := client.GetHealthyServices(ctx, "old")
+	if err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	if len(old) != 0 {
+		t.Fatalf("expected the earlier registration to be revoked, got %+v", old)
+	}
+	if current, err := client.GetHealthyServices(ctx, "new"); err != nil || len(current) != 1 {
+		t.Fatalf("expected the instance under its new service name, got %+v, %v", current, err)
+	}
+}
+
+func TestEtcdClientReportsExpiredLeases(t *testing.T) {
+	ctx := context.Background()
+	client := newTestEtcdClient(t, startEtcd(t))
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i2", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	// i2's lease runs out behind the client's back, leaving its cached registration stale
+	registration, err := client.lookup(ctx, "i2")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if _, err := client.client.Revoke(ctx, registration.leaseID); err != nil {
+		t.Fatalf("failed to revoke lease: %v", err)
+	}
+
+	results, err := client.SendHeartbeats(ctx, []string{"i1", "i2", "unknown"})
+	if err != nil {
+		t.Fatalf("heartbeats failed: %v", err)
+	}
+	if len(results) != 3 || !results[0].Success || !results[1].LeaseExpired || !results[2].NotRegistered {
+		t.Fatalf("expected success, lease expired and not registered, got %+v", results)
+	}
+	if _, err := client.SendHeartbeat(ctx, "i2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the expired registration to be forgotten, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// Client answering every call with err, or with success while err is nil, and counting the calls that reached it
+type fakeClient struct {
+	mu    sync.Mutex
+	err   error
+	lease api.Lease
+	// instances returned by GetHealthyServices
+	instances []api.ServiceInstance
+	calls     map[string]int
+}
+
+func (c *fakeClient) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *fakeClient) call(op string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	c.calls[op]++
+	return c.err
+}
+
+// returns the number of calls of the operation that reached the client
+func (c *fakeClient) count(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[op]
+}
+
+func (c *fakeClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	if err := c.call(OpRegister); err != nil {
+		return api.Lease{}, err
+	}
+	return c.lease, nil
+}
+
+func (c *fakeClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	if err := c.call(OpSendHeartbeat); err != nil {
+		return api.Lease{}, err
+	}
+	return c.lease, nil
+}
+
+func (c *fakeClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	if err := c.call(OpSendHeartbeats); err != nil {
+		return nil, err
+	}
+	results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		results = append(results, api.HeartbeatResult{InstanceID: instanceID, Success: true})
+	}
+	return results, nil
+}
+
+func (c *fakeClient) Deregister(ctx context.Context, instanceID string) error {
+	return c.call(OpDeregister)
+}
+
+func (c *fakeClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	if err := c.call(OpGetHealthyServices); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]api.ServiceInstance(nil), c.instances...), nil
+}
+
+func (c *fakeClient) Close() error {
+	return nil
+}
+
+// Client whose heartbeats block until block is closed while blocking is set
+type blockingClient struct {
+	*fakeClient
+	block    chan struct{}
+	blocking atomic.Bool
+}
+
+func (c *blockingClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	lease, err := c.fakeClient.SendHeartbeat(ctx, instanceID)
+	if c.blocking.Load() {
+		<-c.block
+	}
+	return lease, err
+}
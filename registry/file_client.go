@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"gopkg.in/yaml.v3"
+)
+
+// how often the file is checked for changes when no interval is given
+const DefaultFilePollInterval = 5 * time.Second
+
+// read-only Client discovering instances from a static JSON or YAML file holding a list of api.ServiceInstance,
+// for environments without a registry; the file is polled for changes and reloaded when it changes, keeping the last
+// valid contents when it becomes unreadable or invalid
+// instances are published by editing the file, so Register, SendHeartbeat(s) and Deregister return ErrUnsupported
+type fileClient struct {
+	path   string
+	logger *slog.Logger
+
+	mu        sync.RWMutex
+	contents  []byte
+	instances []api.ServiceInstance
+	// contents last rejected as invalid, so that a broken file is reported once rather than on every poll
+	rejected []byte
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// creates a new fileClient reading instances from path, YAML when it ends in .yaml or .yml and JSON otherwise
+// the file must exist and be valid when the client is created; a pollInterval of 0 uses DefaultFilePollInterval
+func NewFileClient(path string, pollInterval time.Duration, opts ...Option) (Client, error) {
+	o := newClientOptions(opts)
+	if pollInterval <= 0 {
+		pollInterval = DefaultFilePollInterval
+	}
+
+	c := &fileClient{
+		path:   path,
+		logger: o.logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	go c.watch(pollInterval)
+	return c, nil
+}
+
+func (c *fileClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	return api.Lease{}, unsupported("file_client", OpRegister)
+}
+
+func (c *fileClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	return api.Lease{}, unsupported("file_client", OpSendHeartbeat)
+}
+
+func (c *fileClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	return nil, unsupported("file_client", OpSendHeartbeats)
+}
+
+func (c *fileClient) Deregister(ctx context.Context, instanceID string) error {
+	return unsupported("file_client", OpDeregister)
+}
+
+// returns the instances of the service listed in the file; every listed instance is considered healthy
+func (c *fileClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	instances := []api.ServiceInstance{}
+	for _, instance := range c.instances {
+		if instance.ServiceName == serviceName {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// polls the file until the client is closed
+func (c *fileClient) watch(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			changed, err := c.reload()
+			if err != nil {
+				c.logger.Warn("failed to reload instances file, keeping the previous instances", "path", c.path, "error", err)
+				continue
+			}
+			if changed {
+				c.logger.Info("reloaded instances file", "path", c.path)
+			}
+		}
+	}
+}
+
+// reads and parses the file, replacing the instances if its contents changed; reports whether they did
+func (c *fileClient) reload() (bool, error) {
+	contents, err := os.ReadFile(c.path)
+	if err != nil {
+		return false, fmt.Errorf("file_client: failed to read %s: %w", c.path, err)
+	}
+
+	c.mu.RLock()
+	unchanged := (c.instances != nil && bytes.Equal(contents, c.contents)) || (c.rejected != nil && bytes.Equal(contents, c.rejected))
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	instances, err := parseInstances(c.path, contents)
+	if err != nil {
+		c.mu.Lock()
+		c.rejected = contents
+		c.mu.Unlock()
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.contents = contents
+	c.instances = instances
+	c.rejected = nil
+	c.mu.Unlock()
+	return true, nil
+}
+
+// decodes a list of instances from JSON, or from YAML for .yaml and .yml files
+func parseInstances(path string, contents []byte) ([]api.ServiceInstance, error) {
+	data := contents
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// api.ServiceInstance only carries json tags, so the YAML is converted to JSON to decode it under the same field names
+		var doc any
+		if err := yaml.Unmarshal(contents, &doc); err != nil {
+			return nil, fmt.Errorf("file_client: failed to parse %s as YAML: %w", path, err)
+		}
+		if doc == nil {
+			return []api.ServiceInstance{}, nil
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("file_client: failed to convert %s to JSON: %w", path, err)
+		}
+	}
+
+	instances := []api.ServiceInstance{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return instances, nil
+	}
+	if err := json.Unmarshal(data, &instances); err != nil {
+		return nil, fmt.Errorf("file_client: failed to decode instances from %s: %w", path, err)
+	}
+	for i, instance := range instances {
+		if instance.ID == "" || instance.ServiceName == "" {
+			return nil, fmt.Errorf("file_client: instance %d in %s must have an id and a serviceName", i, path)
+		}
+	}
+	return instances, nil
+}
+
+// stops polling the file
+func (c *fileClient) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+	return nil
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func newTestFileClient(t *testing.T, path string) Client {
+	t.Helper()
+	client, err := NewFileClient(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to create file client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// waits until the client reports the given instance IDs for the service
+func waitForInstances(t *testing.T, client Client, serviceName string, ids ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	var instances []api.ServiceInstance
+	for time.Now().Before(deadline) {
+		var err error
+		if instances, err = client.GetHealthyServices(context.Background(), serviceName); err != nil {
+			t.Fatalf("get healthy services failed: %v", err)
+		}
+		if slices.Equal(instanceIDs(instances), ids) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected instances %v of %s, got %+v", ids, serviceName, instances)
+}
+
+func instanceIDs(instances []api.ServiceInstance) []string {
+	ids := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		ids = append(ids, instance.ID)
+	}
+	return ids
+}
+
+func TestFileClientReloadsJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeFile(t, path, `[{"id": "billing-1", "serviceName": "billing", "host": "10.0.0.7", "port": 8000}]`)
+	client := newTestFileClient(t, path)
+
+	instances, err := client.GetHealthyServices(context.Background(), "billing")
+	if err != nil {
+		t.Fatalf("get healthy services failed: %v", err)
+	}
+	want := api.ServiceInstance{ID: "billing-1", ServiceName: "billing", Host: "10.0.0.7", Port: 8000}
+	if len(instances) != 1 || instances[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, instances)
+	}
+
+	writeFile(t, path, `[
+		{"id": "billing-1", "serviceName": "billing", "host": "10.0.0.7", "port": 8000},
+		{"id": "billing-2", "serviceName": "billing", "host": "10.0.0.8", "port": 8000},
+		{"id": "search-1", "serviceName": "search", "host": "10.0.0.9", "port": 9000}
+	]`)
+	waitForInstances(t, client, "billing", "billing-1", "billing-2")
+	waitForInstances(t, client, "search", "search-1")
+}
+
+func TestFileClientReloadsYAMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.yaml")
+	writeFile(t, path, "- id: billing-1\n  serviceName: billing\n  host: 10.0.0.7\n  port: 8000\n")
+	client := newTestFileClient(t, path)
+	waitForInstances(t, client, "billing", "billing-1")
+
+	writeFile(t, path, "- id: billing-2\n  serviceName: billing\n  url: http://10.0.0.8:8000\n  healthPath: /health\n")
+	waitForInstances(t, client, "billing", "billing-2")
+
+	instances, _ := client.GetHealthyServices(context.Background(), "billing")
+	want := api.ServiceInstance{ID: "billing-2", ServiceName: "billing", URL: "http://10.0.0.8:8000", HealthPath: "/health"}
+	if instances[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, instances[0])
+	}
+}
+
+func TestFileClientKeepsInstancesWhenFileBecomesInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeFile(t, path, `[{"id": "billing-1", "serviceName": "billing"}]`)
+	client := newTestFileClient(t, path)
+
+	writeFile(t, path, `[{"id": "billing-2"}]`)
+	time.Sleep(50 * time.Millisecond)
+	waitForInstances(t, client, "billing", "billing-1")
+
+	writeFile(t, path, `[{"id": "billing-3", "serviceName": "billing"}]`)
+	waitForInstances(t, client, "billing", "billing-3")
+}
+
+func TestFileClientRejectsInvalidFileOnCreation(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileClient(filepath.Join(dir, "missing.json"), time.Second); err == nil {
+		t.Fatal("expected a missing file to be rejected")
+	}
+	path := filepath.Join(dir, "instances.yml")
+	writeFile(t, path, "- id: billing-1\n")
+	if _, err := NewFileClient(path, time.Second); err == nil {
+		t.Fatal("expected an instance without a service name to be rejected")
+	}
+}
+
+func TestFileClientIsReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeFile(t, path, "[]")
+	assertReadOnly(t, newTestFileClient(t, path))
+}
@@ -0,0 +1,410 @@
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// default port gossip members listen on, for both UDP and TCP
+const DefaultGossipPort = 7946
+
+// how long Close waits for the departure of a member to be gossiped before shutting it down
+const gossipLeaveTimeout = 5 * time.Second
+
+// config for a member of a gossip cluster
+type GossipConfig struct {
+	// unique name of the member; the host name with a random suffix is used when empty
+	NodeName string
+	// address and port to listen on for gossip; a zero BindPort picks a free port
+	BindAddr string
+	BindPort int
+	// address and port other members reach this one at, when they differ from the bind address, e.g. behind NAT
+	AdvertiseAddr string
+	AdvertisePort int
+	// addresses of existing members to join; a member given none starts a new cluster
+	Seeds []string
+}
+
+// peer-to-peer Client for small clusters that do without a registry
+// every process runs a member of a gossip cluster, which detects failed members SWIM-style through memberlist. The instances
+// registered through a member are owned by it and sent to every other member whenever they change, as well as exchanged
+// during memberlist's periodic state syncs; GetHealthyServices is answered from the local view, and the instances of a
+// member that fails or leaves drop out of it. Liveness is the member's own, so registrations grant no lease and heartbeats
+// merely check that the instance is registered
+type gossipClient struct {
+	// set once the member has started, under mu
+	list   *memberlist.Memberlist
+	logger *slog.Logger
+	name   string
+
+	mu sync.Mutex
+	// instances registered through this member
+	local map[string]api.ServiceInstance
+	// version of the local instances, raised on every change; starting from the clock lets a restarted member supersede its earlier state
+	version uint64
+	// instances owned by other members, by member name
+	remote map[string]gossipNodeState
+	// members currently considered alive
+	alive map[string]bool
+}
+
+// instances owned by a member, as exchanged between members
+type gossipNodeState struct {
+	Node      string                `json:"node"`
+	Version   uint64                `json:"version"`
+	Instances []api.ServiceInstance `json:"instances"`
+}
+
+// creates a new gossipClient, starting a member of the gossip cluster and joining the seeds
+func NewGossipClient(cfg GossipConfig, opts ...Option) (Client, error) {
+	o := newClientOptions(opts)
+
+	name := cfg.NodeName
+	if name == "" {
+		var err error
+		if name, err = defaultGossipNodeName(); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &gossipClient{
+		logger:  o.logger.With("protocol", "gossip", "node", name),
+		name:    name,
+		local:   map[string]api.ServiceInstance{},
+		version: uint64(time.Now().UnixNano()),
+		remote:  map[string]gossipNodeState{},
+		alive:   map[string]bool{},
+	}
+
+	mc := memberlist.DefaultLANConfig()
+	mc.Name = name
+	if cfg.BindAddr != "" {
+		mc.BindAddr = cfg.BindAddr
+	}
+	mc.BindPort = cfg.BindPort
+	mc.AdvertiseAddr = cfg.AdvertiseAddr
+	mc.AdvertisePort = cfg.AdvertisePort
+	if cfg.AdvertisePort == 0 {
+		mc.AdvertisePort = cfg.BindPort
+	}
+	mc.Delegate = c
+	mc.Events = c
+	// memberlist logs through a standard logger, marking the level of each line with a prefix
+	mc.Logger = log.New(gossipLogWriter{logger: c.logger}, "", 0)
+
+	list, err := memberlist.Create(mc)
+	if err != nil {
+		return nil, fmt.Errorf("gossip_client: failed to start gossip member %s: %w", name, err)
+	}
+	c.mu.Lock()
+	c.list = list
+	c.mu.Unlock()
+
+	if len(cfg.Seeds) > 0 {
+		joined, err := list.Join(cfg.Seeds)
+		if err != nil {
+			list.Shutdown()
+			return nil, &Error{Kind: ErrUnavailable, Err: fmt.Errorf("gossip_client: failed to join any of %s: %w", strings.Join(cfg.Seeds, ", "), err)}
+		}
+		c.logger.Debug("joined gossip cluster", "contacted", joined)
+	}
+	return c, nil
+}
+
+// passes memberlist's log lines on to slog at the level named by their prefix, e.g. "[WARN] memberlist: ..."; lines without one are
+// logged at debug level, like memberlist's routine probe messages
+type gossipLogWriter struct {
+	logger *slog.Logger
+}
+
+// memberlist's level prefixes and the slog levels they map onto
+var gossipLogLevels = map[string]slog.Level{
+	"[TRACE]": slog.LevelDebug,
+	"[DEBUG]": slog.LevelDebug,
+	"[INFO]":  slog.LevelInfo,
+	"[WARN]":  slog.LevelWarn,
+	"[ERR]":   slog.LevelError,
+	"[ERROR]": slog.LevelError,
+}
+
+func (w gossipLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	level := slog.LevelDebug
+	if prefix, rest, ok := strings.Cut(line, " "); ok {
+		if l, known := gossipLogLevels[prefix]; known {
+			level, line = l, strings.TrimPrefix(rest, "memberlist: ")
+		}
+	}
+	w.logger.Log(context.Background(), level, line)
+	return len(p), nil
+}
+
+// parses a gossip:// URL into a GossipConfig: the host and port are the bind address, and the join query parameter
+// lists the comma-separated seeds, e.g. gossip://0.0.0.0:7946?join=10.0.0.2:7946,10.0.0.3:7946
+func parseGossipURL(registryURL string) (GossipConfig, error) {
+	u, err := url.Parse(registryURL)
+	if err != nil {
+		return GossipConfig{}, fmt.Errorf("gossip_client: invalid gossip URL %s: %w", registryURL, err)
+	}
+
+	cfg := GossipConfig{BindAddr: u.Hostname(), BindPort: DefaultGossipPort}
+	if port := u.Port(); port != "" {
+		if cfg.BindPort, err = strconv.Atoi(port); err != nil {
+			return GossipConfig{}, fmt.Errorf("gossip_client: invalid port in gossip URL %s: %w", registryURL, err)
+		}
+	}
+	for _, seed := range strings.Split(u.Query().Get("join"), ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			cfg.Seeds = append(cfg.Seeds, seed)
+		}
+	}
+	cfg.NodeName = u.Query().Get("name")
+	return cfg, nil
+}
+
+// returns the host name with a random suffix, so that several members may run on one host
+func defaultGossipNodeName() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "flux"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("gossip_client: failed to generate node name: %w", err)
+	}
+	return host + "-" + hex.EncodeToString(suffix), nil
+}
+
+// adds the instance to those owned by this member and sends them to the other members
+func (c *gossipClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	if instance.ID == "" || instance.ServiceName == "" {
+		return api.Lease{}, &Error{Kind: ErrInvalid, Err: fmt.Errorf("gossip_client: instance must have an id and a serviceName")}
+	}
+
+	c.mu.Lock()
+	c.local[instance.ID] = instance
+	state := c.changedLocked()
+	c.mu.Unlock()
+
+	c.announce(state)
+	return api.Lease{}, nil
+}
+
+// checks that the instance is registered through this member; the member's own liveness stands in for heartbeats
+func (c *gossipClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	c.mu.Lock()
+	_, ok := c.local[instanceID]
+	c.mu.Unlock()
+	if !ok {
+		return api.Lease{}, &Error{Kind: ErrNotFound, Err: fmt.Errorf("gossip_client: instance %s is not registered through this member", instanceID)}
+	}
+	return api.Lease{}, nil
+}
+
+func (c *gossipClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		if _, err := c.SendHeartbeat(ctx, instanceID); err != nil {
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, NotRegistered: true, Message: err.Error()})
+			continue
+		}
+		results = append(results, api.HeartbeatResult{InstanceID: instanceID, Success: true})
+	}
+	return results, nil
+}
+
+// removes the instance from those owned by this member and sends the remaining ones to the other members
+func (c *gossipClient) Deregister(ctx context.Context, instanceID string) error {
+	c.mu.Lock()
+	if _, ok := c.local[instanceID]; !ok {
+		c.mu.Unlock()
+		return &Error{Kind: ErrNotFound, Err: fmt.Errorf("gossip_client: instance %s is not registered through this member", instanceID)}
+	}
+	delete(c.local, instanceID)
+	state := c.changedLocked()
+	c.mu.Unlock()
+
+	c.announce(state)
+	return nil
+}
+
+// returns the instances of the service owned by this member and by the other members it considers alive, ordered by ID
+func (c *gossipClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instances := []api.ServiceInstance{}
+	for _, instance := range c.local {
+		if instance.ServiceName == serviceName {
+			instances = append(instances, instance)
+		}
+	}
+	for node, state := range c.remote {
+		if !c.alive[node] {
+			continue
+		}
+		for _, instance := range state.Instances {
+			if instance.ServiceName == serviceName {
+				instances = append(instances, instance)
+			}
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances, nil
+}
+
+// raises the version of the local instances and returns them; the caller holds mu
+func (c *gossipClient) changedLocked() gossipNodeState {
+	c.version++
+	return c.localStateLocked()
+}
+
+// returns the instances owned by this member; the caller holds mu
+func (c *gossipClient) localStateLocked() gossipNodeState {
+	state := gossipNodeState{Node: c.name, Version: c.version, Instances: make([]api.ServiceInstance, 0, len(c.local))}
+	for _, instance := range c.local {
+		state.Instances = append(state.Instances, instance)
+	}
+	return state
+}
+
+// sends the instances owned by this member to every other member in the background
+// members that miss the message, e.g. because they are unreachable for a moment, catch up in the next state sync
+func (c *gossipClient) announce(state gossipNodeState) {
+	msg, err := json.Marshal(state)
+	if err != nil {
+		c.logger.Warn("failed to encode gossip state", "error", err)
+		return
+	}
+	for _, member := range c.list.Members() {
+		if member.Name == c.name {
+			continue
+		}
+		go c.send(member, msg)
+	}
+}
+
+func (c *gossipClient) send(member *memberlist.Node, msg []byte) {
+	if err := c.list.SendReliable(member, msg); err != nil {
+		c.logger.Debug("failed to send gossip state", "member", member.Name, "error", err)
+	}
+}
+
+// records the instances owned by another member, unless they are older than those already known
+func (c *gossipClient) merge(buf []byte) {
+	var state gossipNodeState
+	if err := json.Unmarshal(buf, &state); err != nil {
+		c.logger.Warn("discarding malformed gossip state", "error", err)
+		return
+	}
+	if state.Node == "" || state.Node == c.name {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if known, ok := c.remote[state.Node]; ok && known.Version >= state.Version {
+		return
+	}
+	c.remote[state.Node] = state
+}
+
+// memberlist.Delegate
+
+// carries nothing, the instances do not fit memberlist's node metadata
+func (c *gossipClient) NodeMeta(limit int) []byte {
+	return nil
+}
+
+// receives the instances another member sent on changing them
+func (c *gossipClient) NotifyMsg(buf []byte) {
+	c.merge(buf)
+}
+
+// no broadcasts are queued, changes are sent to each member directly
+func (c *gossipClient) GetBroadcasts(overhead, limit int) [][]byte {
+	return nil
+}
+
+// returns the instances owned by this member for memberlist's periodic state sync
+func (c *gossipClient) LocalState(join bool) []byte {
+	c.mu.Lock()
+	state := c.localStateLocked()
+	c.mu.Unlock()
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		c.logger.Warn("failed to encode gossip state", "error", err)
+		return nil
+	}
+	return buf
+}
+
+// receives the instances owned by the member this one synced state with
+func (c *gossipClient) MergeRemoteState(buf []byte, join bool) {
+	if len(buf) > 0 {
+		c.merge(buf)
+	}
+}
+
+// memberlist.EventDelegate
+
+// marks the member alive and sends it this member's instances so that it need not wait for the next state sync
+func (c *gossipClient) NotifyJoin(node *memberlist.Node) {
+	if node.Name == c.name {
+		return
+	}
+	c.mu.Lock()
+	c.alive[node.Name] = true
+	state := c.localStateLocked()
+	list := c.list
+	c.mu.Unlock()
+	c.logger.Info("gossip member joined", "member", node.Name, "addr", net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(node.Port))))
+
+	if list == nil {
+		// still joining, the join's own state sync carries the instances
+		return
+	}
+	if msg, err := json.Marshal(state); err == nil {
+		go c.send(node, msg)
+	}
+}
+
+// drops the instances of a member that failed or left
+func (c *gossipClient) NotifyLeave(node *memberlist.Node) {
+	c.mu.Lock()
+	delete(c.alive, node.Name)
+	delete(c.remote, node.Name)
+	c.mu.Unlock()
+	c.logger.Info("gossip member left or failed", "member", node.Name)
+}
+
+func (c *gossipClient) NotifyUpdate(node *memberlist.Node) {}
+
+// announces that this member is leaving, so that its instances drop out of the other members' views at once, and stops it
+func (c *gossipClient) Close() error {
+	if err := c.list.Leave(gossipLeaveTimeout); err != nil && !errors.Is(err, net.ErrClosed) {
+		c.logger.Warn("failed to announce leaving the gossip cluster", "error", err)
+	}
+	if err := c.list.Shutdown(); err != nil {
+		return fmt.Errorf("gossip_client: failed to shut down gossip member: %w", err)
+	}
+	return nil
+}
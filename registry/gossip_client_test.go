@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// starts n gossip members on loopback ports picked by the system, every one after the first joining the first
+func startGossipCluster(t *testing.T, n int) []*gossipClient {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	members := make([]*gossipClient, 0, n)
+	var seeds []string
+	for i := range n {
+		client, err := NewGossipClient(GossipConfig{NodeName: fmt.Sprintf("node-%d", i), BindAddr: "127.0.0.1", Seeds: seeds}, WithLogger(logger))
+		if err != nil {
+			t.Fatalf("failed to start gossip member %d: %v", i, err)
+		}
+		member := client.(*gossipClient)
+		t.Cleanup(func() { member.list.Shutdown() })
+		members = append(members, member)
+		if seeds == nil {
+			seeds = []string{fmt.Sprintf("127.0.0.1:%d", member.list.LocalNode().Port)}
+		}
+	}
+	return members
+}
+
+// waits until every given member reports the given instance IDs of the service
+func waitForGossip(t *testing.T, members []*gossipClient, serviceName string, ids ...string) {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		converged := true
+		var last []string
+		for _, member := range members {
+			instances, err := member.GetHealthyServices(context.Background(), serviceName)
+			if err != nil {
+				t.Fatalf("get healthy services failed: %v", err)
+			}
+			last = last[:0]
+			for _, instance := range instances {
+				last = append(last, instance.ID)
+			}
+			if !slices.Equal(last, ids) {
+				converged = false
+				break
+			}
+		}
+		if converged {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected every member to report %v, one reports %v", ids, last)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestGossipClientConvergesAndDetectsFailedMembers(t *testing.T) {
+	ctx := context.Background()
+	members := startGossipCluster(t, 3)
+	for i, member := range members {
+		if _, err := member.Register(ctx, api.ServiceInstance{ID: fmt.Sprintf("billing-%d", i), ServiceName: "billing"}); err != nil {
+			t.Fatalf("register through member %d failed: %v", i, err)
+		}
+	}
+	waitForGossip(t, members, "billing", "billing-0", "billing-1", "billing-2")
+
+	if err := members[0].Deregister(ctx, "billing-0"); err != nil {
+		t.Fatalf("deregister failed: %v", err)
+	}
+	waitForGossip(t, members, "billing", "billing-1", "billing-2")
+
+	// a member that stops without leaving is found out by failure detection
+	if err := members[2].list.Shutdown(); err != nil {
+		t.Fatalf("failed to shut down member: %v", err)
+	}
+	waitForGossip(t, members[:2], "billing", "billing-1")
+}
+
+func TestGossipClientHeartbeatsCheckLocalRegistrations(t *testing.T) {
+	ctx := context.Background()
+	member := startGossipCluster(t, 1)[0]
+	if _, err := member.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	results, err := member.SendHeartbeats(ctx, []string{"i1", "i2"})
+	if err != nil {
+		t.Fatalf("heartbeats failed: %v", err)
+	}
+	if len(results) != 2 || !results[0].Success || !results[1].NotRegistered {
+		t.Fatalf("expected i1 to succeed and i2 to be reported as not registered, got %+v", results)
+	}
+	if _, err := member.Register(ctx, api.ServiceInstance{ID: "i3"}); err == nil {
+		t.Fatal("expected an instance without a service name to be rejected")
+	}
+}
+
+func TestGossipLogWriterMapsLevels(t *testing.T) {
+	tests := []struct {
+		line    string
+		level   slog.Level
+		message string
+	}{
+		{line: "[DEBUG] memberlist: Stream connection from=127.0.0.1:1234\n", level: slog.LevelDebug, message: "Stream connection from=127.0.0.1:1234"},
+		{line: "[INFO] memberlist: Suspect node-2 has failed, no acks received\n", level: slog.LevelInfo, message: "Suspect node-2 has failed, no acks received"},
+		{line: "[WARN] memberlist: Was able to connect to node-2 over TCP but UDP probes failed\n", level: slog.LevelWarn, message: "Was able to connect to node-2 over TCP but UDP probes failed"},
+		{line: "[ERR] memberlist: Failed to send ping: write: connection refused\n", level: slog.LevelError, message: "Failed to send ping: write: connection refused"},
+		{line: "[ERROR] memberlist: Failed to decode message\n", level: slog.LevelError, message: "Failed to decode message"},
+		{line: "no prefix at all\n", level: slog.LevelDebug, message: "no prefix at all"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writer := gossipLogWriter{logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+		if n, err := writer.Write([]byte(tt.line)); err != nil || n != len(tt.line) {
+			t.Fatalf("write of %q returned %d, %v", tt.line, n, err)
+		}
+
+		var record struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("failed to decode log record %s: %v", buf.Bytes(), err)
+		}
+		if record.Level != tt.level.String() || record.Msg != tt.message {
+			t.Errorf("%q: expected %s %q, got %s %q", strings.TrimSpace(tt.line), tt.level, tt.message, record.Level, record.Msg)
+		}
+	}
+}
@@ -2,13 +2,15 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lokeshllkumar/flux/api"
 	pb "github.com/lokeshllkumar/flux/gen"
-	"github.com/lokeshllkumar/flux/metrics"
-	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
@@ -19,14 +21,28 @@ type grpcClient struct {
 	registryAddress string
 	client          pb.ServiceRegistryClient
 	conn            *grpc.ClientConn
+	logger          *slog.Logger
+
+	// heartbeats prefer the KeepAlive stream and fall back to unary RPCs if the registry does not support it
+	keepAliveMu          sync.Mutex
+	keepAlive            *keepAliveStream
+	keepAliveSequence    atomic.Int64
+	keepAliveUnsupported atomic.Bool
+
+	commandsMu sync.Mutex
+	commands   map[string]chan Command
 }
 
 // creates a new instance of grpcClient
-func NewGRPCClient(registryAddress string, timeout time.Duration) (Client, error) {
+func NewGRPCClient(registryAddress string, timeout time.Duration, opts ...Option) (Client, error) {
+	o := newClientOptions(opts)
+
 	// establish gRPC connection
 	conn, err := grpc.NewClient(
 		registryAddress,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(tracingUnaryInterceptor(o)),
+		grpc.WithStreamInterceptor(tracingStreamInterceptor(o)),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("grpc_client: failed to create gRPC client connection for %s: %w", registryAddress, err)
@@ -38,6 +54,8 @@ func NewGRPCClient(registryAddress string, timeout time.Duration) (Client, error
 		registryAddress: registryAddress,
 		client:          client,
 		conn:            conn,
+		logger:          o.logger.With("protocol", "grpc", "registry", registryAddress),
+		commands:        make(map[string]chan Command),
 	}, nil
 }
 
@@ -48,37 +66,33 @@ func (c *grpcClient) ensureConnectionReady(ctx context.Context) error {
 		return nil
 	}
 
+	// connections created by grpc.NewClient stay idle until asked to connect
+	if state == connectivity.Idle {
+		c.conn.Connect()
+	}
+
 	// makes it wait until it reaches a ready state
 	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	// blocks until the state changes or the context is done
-	c.conn.WaitForStateChange(waitCtx, state)
+	// blocks until the connection is ready or the context is done, following intermediate state changes
+	for state != connectivity.Ready && c.conn.WaitForStateChange(waitCtx, state) {
+		state = c.conn.GetState()
+	}
 
 	if c.conn.GetState() != connectivity.Ready {
 		if ctx.Err() != nil {
 			return fmt.Errorf("grpc_client: connection to registry not ready, and original context cancelled: %w. Current state: %s", ctx.Err(), c.conn.GetState().String())
 		}
-		return fmt.Errorf("grpc_client: connection to service registry is not ready for RPC. Current state: %s", c.conn.GetState().String())
+		return &Error{Kind: ErrUnavailable, Err: fmt.Errorf("grpc_client: connection to service registry is not ready for RPC. Current state: %s", c.conn.GetState().String())}
 	}
 	return nil
 }
 
 // to register the service with the service registry
-func (c *grpcClient) Register(ctx context.Context, instance api.ServiceInstance) error {
-	opLabels := prometheus.Labels{"operation": "register", "protocol": "grpc"}
-	start := time.Now()
-	var status string
-
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
-
+func (c *grpcClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
 	if err := c.ensureConnectionReady(ctx); err != nil {
-		status = "failure"
-		return fmt.Errorf("grpc_client: connection not ready for registration: %w", err)
+		return api.Lease{}, fmt.Errorf("grpc_client: connection not ready for registration: %w", err)
 	}
 
 	grpcInstance := &pb.GrpcServiceInstance{
@@ -95,33 +109,26 @@ func (c *grpcClient) Register(ctx context.Context, instance api.ServiceInstance)
 	}
 	resp, err := c.client.RegisterService(ctx, req)
 	if err != nil {
-		status = "failure"
-		return fmt.Errorf("grpc_client: registration failed: %w", err)
+		return api.Lease{}, grpcStatusError(err, fmt.Errorf("grpc_client: registration failed: %w", err))
 	}
 	if !resp.GetSuccess() {
-		status = "failure"
-		return fmt.Errorf("grpc_client: registration failed, service registry response: %s", resp.GetMessage())
+		return api.Lease{}, fmt.Errorf("grpc_client: registration failed, service registry response: %s", resp.GetMessage())
 	}
 
-	status = "success"
-	return nil
+	return api.Lease{ID: resp.GetLeaseId(), TTLSeconds: resp.GetTtlSeconds()}, nil
 }
 
-// sends gRPC request to service registry to update its heartbeat
-func (c *grpcClient) SendHeartbeat(ctx context.Context, instanceID string) error {
-	opLabels := prometheus.Labels{"operation": "register", "protocol": "grpc"}
-	start := time.Now()
-	var status string
-
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
-
+// sends a heartbeat to the service registry over the KeepAlive stream, or a unary gRPC request when the stream is unavailable
+func (c *grpcClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
 	if err := c.ensureConnectionReady(ctx); err != nil {
-		status = "failure"
-		return fmt.Errorf("grpc_client: connection not ready for heartbeat: %w", err)
+		return api.Lease{}, fmt.Errorf("grpc_client: connection not ready for heartbeat: %w", err)
+	}
+
+	if !c.keepAliveUnsupported.Load() {
+		lease, err := c.sendKeepAlive(ctx, instanceID)
+		if !errors.Is(err, errKeepAliveUnavailable) {
+			return lease, err
+		}
 	}
 
 	req := &pb.SendHeartbeatRequest{
@@ -129,33 +136,55 @@ func (c *grpcClient) SendHeartbeat(ctx context.Context, instanceID string) error
 	}
 	resp, err := c.client.SendHeartbeat(ctx, req)
 	if err != nil {
-		status = "failure"
-		return fmt.Errorf("grpc_client: heartbeat failed for %s: %w", instanceID, err)
+		return api.Lease{}, grpcStatusError(err, fmt.Errorf("grpc_client: heartbeat failed for %s: %w", instanceID, err))
+	}
+	if resp.GetLeaseExpired() {
+		return api.Lease{}, fmt.Errorf("grpc_client: heartbeat rejected for %s: %w", instanceID, ErrLeaseExpired)
 	}
 	if !resp.GetSuccess() {
-		status = "failure"
-		return fmt.Errorf("grpc_client: heartbeat failed, registry response: %s", resp.GetMessage())
+		return api.Lease{}, fmt.Errorf("grpc_client: heartbeat failed, registry response: %s", resp.GetMessage())
 	}
 
-	status = "success"
-	return nil
+	return api.Lease{ID: resp.GetLeaseId(), TTLSeconds: resp.GetTtlSeconds()}, nil
 
 }
 
+// sends a single batched heartbeat for several instances to the service registry
+// a nil error means the RPC itself succeeded; each instance's outcome is reported in its own result
+func (c *grpcClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	if err := c.ensureConnectionReady(ctx); err != nil {
+		return nil, fmt.Errorf("grpc_client: connection not ready for batched heartbeat: %w", err)
+	}
+
+	req := &pb.SendHeartbeatsRequest{
+		InstanceIds: instanceIDs,
+	}
+	resp, err := c.client.SendHeartbeats(ctx, req)
+	if err != nil {
+		return nil, grpcStatusError(err, fmt.Errorf("grpc_client: batched heartbeat failed for %d instances: %w", len(instanceIDs), err))
+	}
+
+	results := make([]api.HeartbeatResult, 0, len(resp.GetResults()))
+	for _, grpcResult := range resp.GetResults() {
+		results = append(results, api.HeartbeatResult{
+			InstanceID:    grpcResult.GetInstanceId(),
+			Success:       grpcResult.GetSuccess(),
+			Message:       grpcResult.GetMessage(),
+			TTLSeconds:    grpcResult.GetTtlSeconds(),
+			LeaseExpired:  grpcResult.GetLeaseExpired(),
+			NotRegistered: grpcResult.GetNotRegistered(),
+		})
+	}
+
+	return results, nil
+}
+
 // to deregister the service from the service registry
 func (c *grpcClient) Deregister(ctx context.Context, instanceID string) error {
-	opLabels := prometheus.Labels{"operation": "register", "protocol": "grpc"}
-	start := time.Now()
-	var status string
-
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
+	// a deregistered instance has no use for commands, whether or not the registry is reached
+	c.unsubscribe(instanceID)
 
 	if err := c.ensureConnectionReady(ctx); err != nil {
-		status = "failure"
 		return fmt.Errorf("grpc_client: connection not ready for deregistration: %w", err)
 	}
 
@@ -164,39 +193,25 @@ func (c *grpcClient) Deregister(ctx context.Context, instanceID string) error {
 	}
 	resp, err := c.client.DeregisterService(ctx, req)
 	if err != nil {
-		status = "failure"
-		return fmt.Errorf("grpc_client: deregistration failed for %s: %w", instanceID, err)
+		return grpcStatusError(err, fmt.Errorf("grpc_client: deregistration failed for %s: %w", instanceID, err))
 	}
 	if !resp.GetSuccess() {
-		status = "failed"
 		return fmt.Errorf("grpc_client: deregistration failed, service registry response: %s", resp.GetMessage())
 	}
 
-	status = "success"
 	return nil
 }
 
 // queries the service registry for a lit of healthy instances of a service
 func (c *grpcClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
-	opLabels := prometheus.Labels{"operation": "get_healthy_services", "protocol": "grpc"}
-	start := time.Now()
-	var status string
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
-
 	if err := c.ensureConnectionReady(ctx); err != nil {
-		status = "failure"
 		return nil, fmt.Errorf("grpc_client: connection not ready for get_healthy_services: %w", err)
 	}
 
 	req := &pb.GetHealthyServicesRequest{InstanceName: serviceName}
 	resp, err := c.client.GetHealthyServices(ctx, req)
 	if err != nil {
-		status = "failure"
-		return nil, fmt.Errorf("grpc_client: failed to get healthy services for %s: %w", serviceName, err)
+		return nil, grpcStatusError(err, fmt.Errorf("grpc_client: failed to get healthy services for %s: %w", serviceName, err))
 	}
 
 	var instances []api.ServiceInstance
@@ -211,12 +226,22 @@ func (c *grpcClient) GetHealthyServices(ctx context.Context, serviceName string)
 		})
 	}
 
-	status = "success"
 	return instances, nil
 }
 
 // closes the gRPC client connection; use to release resources when the service is shutting down
 func (c *grpcClient) Close() error {
+	c.keepAliveMu.Lock()
+	if c.keepAlive != nil {
+		c.keepAlive.cancel()
+		c.keepAlive = nil
+	}
+	c.keepAliveMu.Unlock()
+
+	c.commandsMu.Lock()
+	clear(c.commands)
+	c.commandsMu.Unlock()
+
 	if c.conn != nil {
 		if c.conn.GetState() != connectivity.Shutdown {
 			return c.conn.Close()
@@ -0,0 +1,233 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	pb "github.com/lokeshllkumar/flux/gen"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// number of undelivered commands buffered per instance before further commands are dropped
+const commandBufferSize = 8
+
+// returned internally when a heartbeat cannot be sent over the KeepAlive stream and the unary RPC should be used instead
+var errKeepAliveUnavailable = errors.New("grpc_client: keepalive stream unavailable")
+
+// a single KeepAlive stream shared by every instance heartbeating through the client
+type keepAliveStream struct {
+	stream pb.ServiceRegistry_KeepAliveClient
+	cancel context.CancelFunc
+
+	sendMu sync.Mutex // serializes pings, as gRPC streams do not allow concurrent sends
+
+	mu      sync.Mutex
+	waiters map[int64]chan *pb.KeepAliveResponse
+
+	done chan struct{}
+	err  error // reason the stream ended, only read after done is closed
+}
+
+// registers interest in the acknowledgement of the ping with the given sequence number
+func (s *keepAliveStream) expect(sequence int64) chan *pb.KeepAliveResponse {
+	ack := make(chan *pb.KeepAliveResponse, 1)
+	s.mu.Lock()
+	s.waiters[sequence] = ack
+	s.mu.Unlock()
+	return ack
+}
+
+// removes interest in a ping's acknowledgement
+func (s *keepAliveStream) forget(sequence int64) {
+	s.mu.Lock()
+	delete(s.waiters, sequence)
+	s.mu.Unlock()
+}
+
+// hands an acknowledgement to the heartbeat waiting for it, if any
+func (s *keepAliveStream) deliver(resp *pb.KeepAliveResponse) {
+	s.mu.Lock()
+	ack, ok := s.waiters[resp.GetSequence()]
+	delete(s.waiters, resp.GetSequence())
+	s.mu.Unlock()
+
+	if ok {
+		ack <- resp
+	}
+}
+
+// returns the client's open KeepAlive stream, opening one if needed
+func (c *grpcClient) keepAliveStream() (*keepAliveStream, error) {
+	c.keepAliveMu.Lock()
+	defer c.keepAliveMu.Unlock()
+
+	if c.keepAlive != nil {
+		return c.keepAlive, nil
+	}
+
+	// the stream outlives any single heartbeat call, so it is bound to its own context
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stream, err := c.client.KeepAlive(streamCtx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("grpc_client: failed to open keepalive stream: %w", err)
+	}
+
+	s := &keepAliveStream{
+		stream:  stream,
+		cancel:  cancel,
+		waiters: make(map[int64]chan *pb.KeepAliveResponse),
+		done:    make(chan struct{}),
+	}
+	c.keepAlive = s
+	go c.receiveKeepAlive(s)
+
+	return s, nil
+}
+
+// reads acknowledgements and pushed commands off the stream until it ends
+func (c *grpcClient) receiveKeepAlive(s *keepAliveStream) {
+	for {
+		resp, err := s.stream.Recv()
+		if err != nil {
+			s.err = err
+			close(s.done)
+			c.dropKeepAlive(s)
+			return
+		}
+
+		if resp.GetCommand() != pb.KeepAliveCommand_NONE {
+			c.dispatchCommand(resp)
+		}
+		// unsolicited commands carry no sequence number
+		if resp.GetSequence() != 0 {
+			s.deliver(resp)
+		}
+	}
+}
+
+// discards a stream that has ended so that the next heartbeat opens a new one
+func (c *grpcClient) dropKeepAlive(s *keepAliveStream) {
+	c.keepAliveMu.Lock()
+	if c.keepAlive == s {
+		c.keepAlive = nil
+	}
+	c.keepAliveMu.Unlock()
+	s.cancel()
+}
+
+// sends a heartbeat as a ping over the KeepAlive stream and waits for its acknowledgement
+// returns errKeepAliveUnavailable when the stream cannot be used, in which case the caller falls back to the unary RPC
+func (c *grpcClient) sendKeepAlive(ctx context.Context, instanceID string) (api.Lease, error) {
+	s, err := c.keepAliveStream()
+	if err != nil {
+		return api.Lease{}, errKeepAliveUnavailable
+	}
+
+	sequence := c.keepAliveSequence.Add(1)
+	ack := s.expect(sequence)
+	defer s.forget(sequence)
+
+	s.sendMu.Lock()
+	err = s.stream.Send(&pb.KeepAlivePing{InstanceId: instanceID, Sequence: sequence})
+	s.sendMu.Unlock()
+
+	if err != nil {
+		// the real reason a send fails is reported by the receiving side of the stream
+		select {
+		case <-s.done:
+			c.checkKeepAliveSupport(s.err)
+		case <-ctx.Done():
+			return api.Lease{}, ctx.Err()
+		}
+		return api.Lease{}, errKeepAliveUnavailable
+	}
+
+	select {
+	case resp := <-ack:
+		if resp.GetNotRegistered() {
+			return api.Lease{}, fmt.Errorf("grpc_client: keepalive rejected for %s, instance is not registered: %w", instanceID, ErrNotFound)
+		}
+		if resp.GetLeaseExpired() {
+			return api.Lease{}, fmt.Errorf("grpc_client: keepalive rejected for %s: %w", instanceID, ErrLeaseExpired)
+		}
+		if !resp.GetSuccess() {
+			return api.Lease{}, fmt.Errorf("grpc_client: keepalive failed, registry response: %s", resp.GetMessage())
+		}
+		return api.Lease{TTLSeconds: resp.GetTtlSeconds()}, nil
+	case <-s.done:
+		c.checkKeepAliveSupport(s.err)
+		return api.Lease{}, errKeepAliveUnavailable
+	case <-ctx.Done():
+		return api.Lease{}, ctx.Err()
+	}
+}
+
+// stops using the KeepAlive stream for good if the registry does not implement it
+func (c *grpcClient) checkKeepAliveSupport(err error) {
+	if status.Code(err) == codes.Unimplemented && !c.keepAliveUnsupported.Swap(true) {
+		c.logger.Warn("registry does not support KeepAlive streams, falling back to unary heartbeats")
+	}
+}
+
+// returns the channel on which commands pushed by the registry for the instance are delivered
+// the instance is subscribed until it is deregistered through the client or the client is closed; commands for instances
+// nobody has subscribed are dropped
+func (c *grpcClient) Commands(instanceID string) <-chan Command {
+	c.commandsMu.Lock()
+	defer c.commandsMu.Unlock()
+
+	ch, ok := c.commands[instanceID]
+	if !ok {
+		ch = make(chan Command, commandBufferSize)
+		c.commands[instanceID] = ch
+	}
+	return ch
+}
+
+// removes the instance's subscription, dropping any commands still buffered for it
+func (c *grpcClient) unsubscribe(instanceID string) {
+	c.commandsMu.Lock()
+	delete(c.commands, instanceID)
+	c.commandsMu.Unlock()
+}
+
+// translates a command pushed over the stream and delivers it to the instance it targets
+func (c *grpcClient) dispatchCommand(resp *pb.KeepAliveResponse) {
+	cmd := Command{InstanceID: resp.GetInstanceId()}
+	switch resp.GetCommand() {
+	case pb.KeepAliveCommand_REREGISTER:
+		cmd.Type = CommandReregister
+	case pb.KeepAliveCommand_DRAIN:
+		cmd.Type = CommandDrain
+	case pb.KeepAliveCommand_CHANGE_INTERVAL:
+		if resp.GetIntervalSeconds() <= 0 {
+			c.logger.Warn("ignoring change_interval command with non-positive interval", "instance_id", cmd.InstanceID)
+			return
+		}
+		cmd.Type = CommandChangeInterval
+		cmd.Interval = time.Duration(resp.GetIntervalSeconds()) * time.Second
+	default:
+		c.logger.Warn("ignoring unknown keepalive command", "command", resp.GetCommand().String(), "instance_id", cmd.InstanceID)
+		return
+	}
+
+	c.commandsMu.Lock()
+	ch, ok := c.commands[cmd.InstanceID]
+	c.commandsMu.Unlock()
+	if !ok {
+		c.logger.Debug("dropping command for instance without subscriber", "command", cmd.Type.String(), "instance_id", cmd.InstanceID)
+		return
+	}
+
+	select {
+	case ch <- cmd:
+	default:
+		c.logger.Warn("dropping command, command buffer is full", "command", cmd.Type.String(), "instance_id", cmd.InstanceID)
+	}
+}
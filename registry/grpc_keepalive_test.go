@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/lokeshllkumar/flux/gen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestGRPCClient(t *testing.T) *grpcClient {
+	t.Helper()
+	// nothing listens on the address; the connection is only dialled by calls that need it
+	client, err := NewGRPCClient("127.0.0.1:1", time.Second)
+	if err != nil {
+		t.Fatalf("failed to create gRPC client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client.(*grpcClient)
+}
+
+func subscribers(c *grpcClient) int {
+	c.commandsMu.Lock()
+	defer c.commandsMu.Unlock()
+	return len(c.commands)
+}
+
+func TestGRPCClientDropsCommandsWithoutSubscriber(t *testing.T) {
+	c := newTestGRPCClient(t)
+
+	for i := range 100 {
+		c.dispatchCommand(&pb.KeepAliveResponse{InstanceId: string(rune('a' + i%26)), Command: pb.KeepAliveCommand_REREGISTER})
+	}
+	if n := subscribers(c); n != 0 {
+		t.Fatalf("expected commands for unsubscribed instances to be dropped, got %d entries", n)
+	}
+}
+
+func TestGRPCClientDeliversCommandsToSubscriber(t *testing.T) {
+	c := newTestGRPCClient(t)
+	commands := c.Commands("i1")
+
+	c.dispatchCommand(&pb.KeepAliveResponse{InstanceId: "i1", Command: pb.KeepAliveCommand_CHANGE_INTERVAL, IntervalSeconds: 7})
+	select {
+	case cmd := <-commands:
+		if cmd.Type != CommandChangeInterval || cmd.Interval != 7*time.Second {
+			t.Fatalf("unexpected command %+v", cmd)
+		}
+	default:
+		t.Fatal("expected the command to be delivered to the subscriber")
+	}
+	if again := c.Commands("i1"); again != commands {
+		t.Fatal("expected subscribing twice to return the same channel")
+	}
+}
+
+func TestGRPCClientUnsubscribesOnDeregisterAndClose(t *testing.T) {
+	c := newTestGRPCClient(t)
+	c.Commands("i1")
+	c.Commands("i2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// the registry is unreachable, the subscription ends regardless
+	c.Deregister(ctx, "i1")
+	if n := subscribers(c); n != 1 {
+		t.Fatalf("expected 1 subscriber after deregistering i1, got %d", n)
+	}
+
+	c.Close()
+	if n := subscribers(c); n != 0 {
+		t.Fatalf("expected no subscribers after close, got %d", n)
+	}
+}
+
+// registry predating KeepAlive streams, answering only unary heartbeats; KeepAlive fails like the generated stub but counts the attempts
+type unaryHeartbeatServer struct {
+	pb.UnimplementedServiceRegistryServer
+	keepAlives atomic.Int32
+	heartbeats atomic.Int32
+}
+
+func (s *unaryHeartbeatServer) KeepAlive(stream grpc.BidiStreamingServer[pb.KeepAlivePing, pb.KeepAliveResponse]) error {
+	s.keepAlives.Add(1)
+	return status.Error(codes.Unimplemented, "method KeepAlive not implemented")
+}
+
+func (s *unaryHeartbeatServer) SendHeartbeat(ctx context.Context, req *pb.SendHeartbeatRequest) (*pb.ServiceRegistryResponse, error) {
+	s.heartbeats.Add(1)
+	return &pb.ServiceRegistryResponse{Success: true, LeaseId: "lease-" + req.GetInstanceId(), TtlSeconds: 30}, nil
+}
+
+func TestGRPCClientFallsBackToUnaryHeartbeats(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	registry := &unaryHeartbeatServer{}
+	pb.RegisterServiceRegistryServer(srv, registry)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	client, err := NewGRPCClient(lis.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to create gRPC client: %v", err)
+	}
+	defer client.Close()
+
+	for range 3 {
+		lease, err := client.SendHeartbeat(context.Background(), "i1")
+		if err != nil {
+			t.Fatalf("expected the heartbeat to succeed over the unary RPC, got %v", err)
+		}
+		if lease.ID != "lease-i1" || lease.TTLSeconds != 30 {
+			t.Fatalf("expected the lease granted by the unary RPC, got %+v", lease)
+		}
+	}
+	if n := registry.heartbeats.Load(); n != 3 {
+		t.Fatalf("expected every heartbeat to be sent over the unary RPC, got %d", n)
+	}
+	// once the registry has said it does not implement the stream, it is not asked again
+	if n := registry.keepAlives.Load(); n != 1 {
+		t.Fatalf("expected a single attempt to open the KeepAlive stream, got %d", n)
+	}
+	if !client.(*grpcClient).keepAliveUnsupported.Load() {
+		t.Fatal("expected the client to remember that KeepAlive is unsupported")
+	}
+}
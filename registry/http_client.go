@@ -6,12 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/lokeshllkumar/flux/api"
-	"github.com/lokeshllkumar/flux/metrics"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
 // implementing the Client interface using HTTP
@@ -21,181 +21,176 @@ type httpClient struct {
 }
 
 // creates a new httpClient instance
-func NewHTTPClient(registryURL string, timeout time.Duration) Client {
+func NewHTTPClient(registryURL string, timeout time.Duration, opts ...Option) Client {
+	o := newClientOptions(opts)
 	return &httpClient{
 		registryURL: registryURL,
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: newTracingTransport(http.DefaultTransport, o),
 		},
 	}
 }
 
 // to register the service with the service registry
-func (c *httpClient) Register(ctx context.Context, instance api.ServiceInstance) error {
-	opLabels := prometheus.Labels{"operation": "register", "protocol": "grpc"}
-	start := time.Now()
-	var status string
-
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
-
+func (c *httpClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
 	payload, err := json.Marshal(instance)
 	if err != nil {
-		status = "failure"
-		return fmt.Errorf("http_client: failed to marshal instance: %w", err)
+		return api.Lease{}, fmt.Errorf("http_client: failed to marshal instance: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/v1/services/register", c.registryURL), bytes.NewBuffer(payload))
 	if err != nil {
-		status = "failure"
-		return fmt.Errorf("http_client: failed to create regsitration request: %w", err)
+		return api.Lease{}, fmt.Errorf("http_client: failed to create regsitration request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		// checking for context cancellation and timeout errors
-		status = "failure"
 		if ctx.Err() != nil {
-			return fmt.Errorf("http_client: registration request aborted due to context: %w", ctx.Err())
+			return api.Lease{}, fmt.Errorf("http_client: registration request aborted due to context: %w", ctx.Err())
 		}
-		return fmt.Errorf("http_client: failed to send registration request to %s: %w", c.registryURL, err)
+		return api.Lease{}, httpTransportError(fmt.Errorf("http_client: failed to send registration request to %s: %w", c.registryURL, err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		status = "failure"
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("http_client: registration failed, service registry returned non-201 status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
+		return api.Lease{}, httpStatusError(resp, fmt.Errorf("http_client: registration failed, service registry returned non-201 status code: %d, body: %s", resp.StatusCode, string(bodyBytes)))
 	}
 
-	status = "success"
-	return nil
+	return decodeLease(resp), nil
 }
 
 // to send a heartbeat to the service registry
-func (c *httpClient) SendHeartbeat(ctx context.Context, instanceID string) error {
-	opLabels := prometheus.Labels{"operation": "register", "protocol": "grpc"}
-	start := time.Now()
-	var status string
+func (c *httpClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/v1/services/heartbeat/%s", c.registryURL, instanceID), nil)
+	if err != nil {
+		return api.Lease{}, fmt.Errorf("http_client: failed to create heartbeat request: %w", err)
+	}
 
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return api.Lease{}, fmt.Errorf("http_client: heartbeat request aborted due to context: %w", ctx.Err())
+		}
+		return api.Lease{}, httpTransportError(fmt.Errorf("http_client: failed to send heartbeat to %s: %w", c.registryURL, err))
+	}
+	defer resp.Body.Close()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/v1/services/heartbeat/%s", c.registryURL, instanceID), nil)
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return api.Lease{}, httpStatusError(resp, fmt.Errorf("http_client: heartbeat failed, service registry returned non-200 status: %d, body: %s", resp.StatusCode, string(bodyBytes)))
+	}
+
+	return decodeLease(resp), nil
+}
+
+// sends a single batched heartbeat for several instances to the service registry
+// a nil error means the call itself succeeded; each instance's outcome is reported in its own result
+func (c *httpClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	payload, err := json.Marshal(api.HeartbeatsRequest{InstanceIDs: instanceIDs})
+	if err != nil {
+		return nil, fmt.Errorf("http_client: failed to marshal batched heartbeat: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/v1/services/heartbeats", c.registryURL), bytes.NewBuffer(payload))
 	if err != nil {
-		status = "failure"
-		return fmt.Errorf("http_client: failed to create heartbeat request: %w", err)
+		return nil, fmt.Errorf("http_client: failed to create batched heartbeat request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		status = "failure"
 		if ctx.Err() != nil {
-			return fmt.Errorf("http_client: heartbeat request aborted due to context: %w", ctx.Err())
+			return nil, fmt.Errorf("http_client: batched heartbeat request aborted due to context: %w", ctx.Err())
 		}
-		return fmt.Errorf("http_client: failed to send heartbeat to %s: %w", c.registryURL, err)
+		return nil, httpTransportError(fmt.Errorf("http_client: failed to send batched heartbeat to %s: %w", c.registryURL, err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		status = "failure"
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("http_client: heartbeat failed, service registry returned non-200 status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+		return nil, httpStatusError(resp, fmt.Errorf("http_client: batched heartbeat failed, service registry returned non-200 status: %d, body: %s", resp.StatusCode, string(bodyBytes)))
 	}
 
-	status = "success"
-	return nil
+	var body api.HeartbeatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("http_client: failed to decode batched heartbeat response: %w", err)
+	}
+
+	return body.Results, nil
 }
 
 // to deregister the service from the service registry
 func (c *httpClient) Deregister(ctx context.Context, instanceID string) error {
-	opLabels := prometheus.Labels{"operation": "register", "protocol": "grpc"}
-	start := time.Now()
-	var status string
-
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
-
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("%s/api/v1/services/deregister/%s", c.registryURL, instanceID), nil)
 	if err != nil {
-		status = "failure"
 		return fmt.Errorf("http_client: failed to create deregistration request: %w", err)
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		status = "failure"
 		if ctx.Err() != nil {
 			return fmt.Errorf("http_client: deregistration request aborted due to context: %w", ctx.Err())
 		}
-		return fmt.Errorf("http_client: failed to send deregistration request to %s: %w", c.registryURL, err)
+		return httpTransportError(fmt.Errorf("http_client: failed to send deregistration request to %s: %w", c.registryURL, err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		status = "failure"
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("http_client: deregistration failed, service registry returned non-204 status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+		return httpStatusError(resp, fmt.Errorf("http_client: deregistration failed, service registry returned non-204 status: %d, body: %s", resp.StatusCode, string(bodyBytes)))
 	}
 
-	status = "success"
 	return nil
 }
 
 // queries the service registry for a list of healthy instances of a specific service
 func (c *httpClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
-	opLabels := prometheus.Labels{"operation": "get_healthy_services", "protocol": "http"}
-	start := time.Now()
-	var status string
-	defer func() {
-		opLabels["status"] = status
-		metrics.RegistryCallDurationSeconds.With(opLabels).Observe(time.Since(start).Seconds())
-		metrics.RegistryCallsTotal.With(opLabels).Inc()
-	}()
-
 	url := fmt.Sprintf("%s/api/v1/services/%s/healthy", c.registryURL, serviceName)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		status = "failure"
 		return nil, fmt.Errorf("https_client: failed to create get_healthy_services request for %s: %w", serviceName, err)
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		status = "failure"
 		if ctx.Err() != nil {
 			return nil, fmt.Errorf("http_client: get_healthy_services request aborted due to context for %s: %w", serviceName, ctx.Err())
 		}
-		return nil, fmt.Errorf("http_client: failed to send get_healthy_services request for %s to %s: %w", serviceName, c.registryURL, err)
+		return nil, httpTransportError(fmt.Errorf("http_client: failed to send get_healthy_services request for %s to %s: %w", serviceName, c.registryURL, err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		status = "failure"
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("http_client: get_healthy_services, failed for %s, registry returned non-200 status: %d, body: %s", serviceName, resp.StatusCode, string(bodyBytes))
+		return nil, httpStatusError(resp, fmt.Errorf("http_client: get_healthy_services, failed for %s, registry returned non-200 status: %d, body: %s", serviceName, resp.StatusCode, string(bodyBytes)))
 	}
 
 	var instances []api.ServiceInstance
 	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
-		status = "failure"
 		return nil, fmt.Errorf("http_client: faield to decode get_healthy_services response for %s: %w", serviceName, err)
 	}
 
-	status = "success"
 	return instances, nil
 }
 
+// decodes the lease carried in a registration or heartbeat response body
+// registries that do not grant leases may reply with an empty or non-JSON body, such as "OK", which yields a zero lease
+func decodeLease(resp *http.Response) api.Lease {
+	var lease api.Lease
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return lease
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return api.Lease{}
+	}
+	return lease
+}
+
 // closes the connection; exists purely to implement the interface's Close() function
 func (c *httpClient) Close() error {
 	return nil
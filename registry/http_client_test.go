@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+func TestHTTPClientDecodesLeaseOnlyFromJSONBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        api.Lease
+	}{
+		{name: "json lease", contentType: "application/json", body: `{"leaseId":"l1","ttlSeconds":30}`, want: api.Lease{ID: "l1", TTLSeconds: 30}},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", body: `{"leaseId":"l2","ttlSeconds":15}`, want: api.Lease{ID: "l2", TTLSeconds: 15}},
+		{name: "plain text", contentType: "text/plain", body: "OK"},
+		{name: "no content type", body: "OK"},
+		{name: "empty json body", contentType: "application/json"},
+		{name: "malformed json", contentType: "application/json", body: "OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if r.URL.Path == "/api/v1/services/register" {
+					w.WriteHeader(http.StatusCreated)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			client := NewHTTPClient(srv.URL, time.Second)
+
+			lease, err := client.Register(context.Background(), api.ServiceInstance{ID: "i1", ServiceName: "svc"})
+			if err != nil {
+				t.Fatalf("register failed: %v", err)
+			}
+			if lease != tt.want {
+				t.Fatalf("register: expected lease %+v, got %+v", tt.want, lease)
+			}
+			lease, err = client.SendHeartbeat(context.Background(), "i1")
+			if err != nil {
+				t.Fatalf("heartbeat failed: %v", err)
+			}
+			if lease != tt.want {
+				t.Fatalf("heartbeat: expected lease %+v, got %+v", tt.want, lease)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// names of the registry operations, as seen by middleware and used in metric labels
+const (
+	OpRegister           = "register"
+	OpSendHeartbeat      = "send_heartbeat"
+	OpSendHeartbeats     = "send_heartbeats"
+	OpDeregister         = "deregister"
+	OpGetHealthyServices = "get_healthy_services"
+)
+
+// decorates a Client with cross-cutting behaviour such as metrics, logging or retries
+type Middleware func(Client) Client
+
+// wraps the client in the given middlewares; the first middleware is the outermost and sees each call first
+func Chain(client Client, middlewares ...Middleware) Client {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		client = middlewares[i](client)
+	}
+	return client
+}
+
+// describes a single registry call passing through middleware
+type Call struct {
+	Operation string
+	// set for calls concerning a single instance
+	InstanceID string
+	// set for register and get_healthy_services calls
+	ServiceName string
+	// set for send_heartbeats calls
+	InstanceIDs []string
+}
+
+// intercepts a registry call; invoke performs the call by passing it on down the chain and may be called more than once
+type Interceptor func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error
+
+// returns a Middleware that runs every call except Close through the interceptor
+// lets cross-cutting behaviour be written once instead of once per Client method
+func Intercept(interceptor Interceptor) Middleware {
+	return func(next Client) Client {
+		return &interceptedClient{next: next, interceptor: interceptor}
+	}
+}
+
+// implementing the Client interface by running each call through an Interceptor
+type interceptedClient struct {
+	next        Client
+	interceptor Interceptor
+}
+
+func (c *interceptedClient) Register(ctx context.Context, instance api.ServiceInstance) (api.Lease, error) {
+	var lease api.Lease
+	call := Call{Operation: OpRegister, InstanceID: instance.ID, ServiceName: instance.ServiceName}
+	err := c.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		lease, err = c.next.Register(ctx, instance)
+		return err
+	})
+	return lease, err
+}
+
+func (c *interceptedClient) SendHeartbeat(ctx context.Context, instanceID string) (api.Lease, error) {
+	var lease api.Lease
+	call := Call{Operation: OpSendHeartbeat, InstanceID: instanceID}
+	err := c.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		lease, err = c.next.SendHeartbeat(ctx, instanceID)
+		return err
+	})
+	return lease, err
+}
+
+func (c *interceptedClient) SendHeartbeats(ctx context.Context, instanceIDs []string) ([]api.HeartbeatResult, error) {
+	var results []api.HeartbeatResult
+	call := Call{Operation: OpSendHeartbeats, InstanceIDs: instanceIDs}
+	err := c.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		results, err = c.next.SendHeartbeats(ctx, instanceIDs)
+		return err
+	})
+	return results, err
+}
+
+func (c *interceptedClient) Deregister(ctx context.Context, instanceID string) error {
+	call := Call{Operation: OpDeregister, InstanceID: instanceID}
+	return c.interceptor(ctx, call, func(ctx context.Context) error {
+		return c.next.Deregister(ctx, instanceID)
+	})
+}
+
+func (c *interceptedClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	var instances []api.ServiceInstance
+	call := Call{Operation: OpGetHealthyServices, ServiceName: serviceName}
+	err := c.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		instances, err = c.next.GetHealthyServices(ctx, serviceName)
+		return err
+	})
+	return instances, err
+}
+
+func (c *interceptedClient) Close() error {
+	return c.next.Close()
+}
+
+// returns the client wrapped by the middleware
+func (c *interceptedClient) Unwrap() Client {
+	return c.next
+}
+
+// records the count and duration of registry calls, labelled with the given protocol, along with the results of service discovery
+// a nil m records into metrics.Default()
+func Metrics(m *metrics.Metrics, protocol string) Middleware {
+	if m == nil {
+		m = metrics.Default()
+	}
+	calls := callMetrics(m, protocol)
+	return func(next Client) Client {
+		return calls(&discoveryMetricsClient{Client: next, metrics: m})
+	}
+}
+
+// records the count and duration of registry calls, with the trace ID of each call as an exemplar on the duration
+func callMetrics(m *metrics.Metrics, protocol string) Middleware {
+	return Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+		start := time.Now()
+		err := invoke(ctx)
+
+		status := "success"
+		if err != nil {
+			status = "failure"
+		}
+		if errors.Is(err, ErrThrottled) {
+			m.RegistryThrottledCallsTotal.WithLabelValues(call.Operation, "registry").Inc()
+		}
+		opLabels := prometheus.Labels{"operation": call.Operation, "protocol": protocol, "status": status}
+		// links the observation to the call's trace when a span is active, e.g. when Tracing wraps this middleware
+		metrics.ObserveWithExemplar(ctx, m.RegistryCallDurationSeconds.With(opLabels), time.Since(start).Seconds())
+		m.RegistryCallsTotal.With(opLabels).Inc()
+		return err
+	})
+}
+
+// records the size and freshness of each service's discovered instances
+type discoveryMetricsClient struct {
+	Client
+	metrics *metrics.Metrics
+}
+
+func (c *discoveryMetricsClient) GetHealthyServices(ctx context.Context, serviceName string) ([]api.ServiceInstance, error) {
+	instances, err := c.Client.GetHealthyServices(ctx, serviceName)
+	if err == nil {
+		c.metrics.DiscoveryInstances.WithLabelValues(serviceName).Set(float64(len(instances)))
+		c.metrics.DiscoveryAgeSeconds.Touch(serviceName)
+	}
+	return instances, err
+}
+
+// returns the client wrapped by the middleware
+func (c *discoveryMetricsClient) Unwrap() Client {
+	return c.Client
+}
+
+// logs the outcome and duration of every registry call; successes are logged at debug level and failures at warn
+// a nil logger uses slog.Default()
+func Logging(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+		start := time.Now()
+		err := invoke(ctx)
+
+		attrs := []any{"operation", call.Operation, "duration", time.Since(start)}
+		if call.ServiceName != "" {
+			attrs = append(attrs, "service", call.ServiceName)
+		}
+		if call.InstanceID != "" {
+			attrs = append(attrs, "instance_id", call.InstanceID)
+		}
+		if call.InstanceIDs != nil {
+			attrs = append(attrs, "instances", len(call.InstanceIDs))
+		}
+
+		if err != nil {
+			logger.WarnContext(ctx, "registry call failed", append(attrs, "error", err)...)
+		} else {
+			logger.DebugContext(ctx, "registry call succeeded", attrs...)
+		}
+		return err
+	})
+}
+
+// starts a span for a registry call, returning the span's context and a function that ends the span with the call's outcome
+type SpanStarter func(ctx context.Context, call Call) (context.Context, func(err error))
+
+// wraps every registry call in a span started by the given tracer hook
+func Tracing(start SpanStarter) Middleware {
+	return Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+		spanCtx, end := start(ctx, call)
+		err := invoke(spanCtx)
+		end(err)
+		return err
+	})
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// makes one call of every operation through the client, returning the operations in the order they were made
+func callEveryOperation(client Client) []string {
+	ctx := context.Background()
+	client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"})
+	client.SendHeartbeat(ctx, "i1")
+	client.SendHeartbeats(ctx, []string{"i1", "i2"})
+	client.Deregister(ctx, "i1")
+	client.GetHealthyServices(ctx, "svc")
+	return []string{OpRegister, OpSendHeartbeat, OpSendHeartbeats, OpDeregister, OpGetHealthyServices}
+}
+
+func TestChainAppliesFirstMiddlewareOutermost(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+			order = append(order, name+" before")
+			err := invoke(ctx)
+			order = append(order, name+" after")
+			return err
+		})
+	}
+
+	client := Chain(&fakeClient{}, trace("a"), trace("b"))
+	if _, err := client.SendHeartbeat(context.Background(), "i1"); err != nil {
+		t.Fatalf("heartbeat failed: %v", err)
+	}
+	if want := []string{"a before", "b before", "b after", "a after"}; !slices.Equal(order, want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+}
+
+func TestInterceptSeesEveryCallAndError(t *testing.T) {
+	failure := &Error{Kind: ErrUnavailable, Err: errors.New("connection refused")}
+	backend := &fakeClient{err: failure}
+	var calls []Call
+	var errs []error
+	client := Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+		err := invoke(ctx)
+		calls = append(calls, call)
+		errs = append(errs, err)
+		return err
+	})(backend)
+
+	ops := callEveryOperation(client)
+	if len(calls) != len(ops) {
+		t.Fatalf("expected %d intercepted calls, got %+v", len(ops), calls)
+	}
+	for i, op := range ops {
+		if calls[i].Operation != op {
+			t.Errorf("call %d: expected operation %s, got %s", i, op, calls[i].Operation)
+		}
+		if !errors.Is(errs[i], ErrUnavailable) {
+			t.Errorf("%s: expected the interceptor to see the client's error, got %v", op, errs[i])
+		}
+		if backend.count(op) != 1 {
+			t.Errorf("%s: expected the call to reach the client once, got %d", op, backend.count(op))
+		}
+	}
+	if calls[0].InstanceID != "i1" || calls[0].ServiceName != "svc" {
+		t.Errorf("expected register to describe the instance, got %+v", calls[0])
+	}
+	if !slices.Equal(calls[2].InstanceIDs, []string{"i1", "i2"}) {
+		t.Errorf("expected send_heartbeats to carry the instance IDs, got %+v", calls[2])
+	}
+	if calls[4].ServiceName != "svc" || calls[4].InstanceID != "" {
+		t.Errorf("expected get_healthy_services to carry only the service name, got %+v", calls[4])
+	}
+}
+
+func TestMetricsLabelsEveryOperation(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry(), metrics.Options{})
+	if err != nil {
+		t.Fatalf("failed to create metrics: %v", err)
+	}
+	backend := &fakeClient{}
+	client := Metrics(m, "grpc")(backend)
+
+	ops := callEveryOperation(client)
+	backend.setErr(&Error{Kind: ErrUnavailable, Err: errors.New("connection refused")})
+	callEveryOperation(client)
+
+	for _, op := range ops {
+		for _, status := range []string{"success", "failure"} {
+			labels := prometheus.Labels{"operation": op, "protocol": "grpc", "status": status}
+			if n := testutil.ToFloat64(m.RegistryCallsTotal.With(labels)); n != 1 {
+				t.Errorf("expected one %s %s call to be counted, got %v", status, op, n)
+			}
+		}
+	}
+	if n := testutil.CollectAndCount(m.RegistryCallsTotal); n != 2*len(ops) {
+		t.Errorf("expected only the labelled series to be recorded, got %d", n)
+	}
+	if n := testutil.CollectAndCount(m.RegistryCallDurationSeconds); n != 2*len(ops) {
+		t.Errorf("expected a duration series per operation and status, got %d", n)
+	}
+}
+
+func TestLoggingEmitsOneRecordPerCall(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	backend := &fakeClient{}
+	client := Logging(logger)(backend)
+	ctx := context.Background()
+
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	backend.setErr(&Error{Kind: ErrUnavailable, Err: errors.New("connection refused")})
+	client.SendHeartbeats(ctx, []string{"i1", "i2"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one record per call, got:\n%s", buf.String())
+	}
+	type record struct {
+		Level      string `json:"level"`
+		Msg        string `json:"msg"`
+		Operation  string `json:"operation"`
+		Service    string `json:"service"`
+		InstanceID string `json:"instance_id"`
+		Instances  int    `json:"instances"`
+		Error      string `json:"error"`
+	}
+	var records []record
+	for _, line := range lines {
+		var r record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("failed to decode log record %s: %v", line, err)
+		}
+		records = append(records, r)
+	}
+
+	if r := records[0]; r.Level != "DEBUG" || r.Operation != OpRegister || r.Service != "svc" || r.InstanceID != "i1" || r.Error != "" {
+		t.Errorf("expected a debug record of the successful register, got %+v", r)
+	}
+	if r := records[1]; r.Level != "WARN" || r.Operation != OpSendHeartbeats || r.Instances != 2 || r.Error == "" {
+		t.Errorf("expected a warning carrying the heartbeats' error, got %+v", r)
+	}
+}
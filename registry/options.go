@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"log/slog"
+
+	"github.com/lokeshllkumar/flux/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// configures optional behaviour of the registry clients
+type Option func(*clientOptions)
+
+// optional settings shared by the registry clients
+type clientOptions struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	logger         *slog.Logger
+	metrics        *metrics.Metrics
+}
+
+// sets the TracerProvider used for the spans of requests sent to the registry; defaults to the global provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *clientOptions) {
+		o.tracerProvider = tp
+	}
+}
+
+// sets the propagator used to carry trace context to the registry; defaults to the global propagator
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *clientOptions) {
+		o.propagator = propagator
+	}
+}
+
+// sets the logger receiving the client's structured logs; defaults to slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *clientOptions) {
+		o.logger = logger
+	}
+}
+
+// sets the metrics recorded into; defaults to metrics.Default()
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *clientOptions) {
+		o.metrics = m
+	}
+}
+
+// applies the options over the defaults
+func newClientOptions(opts []Option) *clientOptions {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.tracerProvider == nil {
+		o.tracerProvider = otel.GetTracerProvider()
+	}
+	if o.propagator == nil {
+		o.propagator = otel.GetTextMapPropagator()
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	if o.metrics == nil {
+		o.metrics = metrics.Default()
+	}
+	return o
+}
@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// default rate and burst of the limiter shared by a process's registry calls, well above what registrars need in steady state
+// but low enough that a crash looping service cannot flood the registry with registrations
+const (
+	DefaultRateLimit = 10
+	DefaultBurst     = 50
+)
+
+// how long calls are held back after the registry throttles one without saying for how long
+const defaultThrottleDelay = 1 * time.Second
+
+var (
+	defaultLimiter     *Limiter
+	defaultLimiterOnce sync.Once
+)
+
+// returns the process-wide Limiter, allowing DefaultRateLimit calls per second in bursts of up to DefaultBurst
+// registrars use it unless configured with a Limiter of their own, so that every registry call made by the process is limited together
+func DefaultLimiter() *Limiter {
+	defaultLimiterOnce.Do(func() {
+		defaultLimiter = NewLimiter(DefaultRateLimit, DefaultBurst)
+	})
+	return defaultLimiter
+}
+
+// token bucket limiting the rate of registry calls; a single Limiter may be shared by several clients
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64 // tokens added per second
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time // set when the registry throttles a call, holding back every call until then
+}
+
+// creates a new Limiter allowing ratePerSecond calls on average and bursts of up to burst calls
+// a zero or negative rate means unlimited, e.g. NewLimiter(0, 0) opts out of rate limiting; calls are then only held back while the registry is throttling
+func NewLimiter(ratePerSecond float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// blocks until a call may proceed or the context is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	_, err := l.wait(ctx)
+	return err
+}
+
+// holds back every call made through the limiter for d, e.g. for the delay a throttling registry asked for
+// pauses only ever extend, a shorter one does not cut an earlier pause short
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// blocks like Wait, additionally reporting whether the call had to wait
+func (l *Limiter) wait(ctx context.Context) (bool, error) {
+	waited := false
+	for {
+		wait := l.reserve()
+		if wait == 0 {
+			return waited, nil
+		}
+		waited = true
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return waited, ctx.Err()
+		}
+	}
+}
+
+// takes a token if one is available, otherwise returns how long until the next one is
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// makes every registry call wait for the limiter before proceeding
+// when the registry throttles a call, the limiter is paused for the delay it asked for so that no other call adds to the load meanwhile
+// calls held back by the limiter are counted in the metrics set with WithMetrics
+func RateLimit(limiter *Limiter, opts ...Option) Middleware {
+	o := newClientOptions(opts)
+	return Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+		waited, err := limiter.wait(ctx)
+		if waited {
+			o.metrics.RegistryThrottledCallsTotal.WithLabelValues(call.Operation, "client").Inc()
+		}
+		if err != nil {
+			return err
+		}
+
+		err = invoke(ctx)
+		if errors.Is(err, ErrThrottled) {
+			delay := RetryAfter(err)
+			if delay <= 0 {
+				delay = defaultThrottleDelay
+			}
+			limiter.Pause(delay)
+			o.logger.Warn("registry throttled call, pausing registry calls", "operation", call.Operation, "pause", delay)
+		}
+		return err
+	})
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	"github.com/lokeshllkumar/flux/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLimiterWithoutRateIsUnlimited(t *testing.T) {
+	for _, limiter := range []*Limiter{NewLimiter(0, 0), NewLimiter(-1, 5)} {
+		start := time.Now()
+		for range 10000 {
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Fatalf("wait failed: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected an unlimited limiter never to hold calls back, took %v", elapsed)
+		}
+	}
+}
+
+func TestDefaultLimiterSlowsBurstOfRegistrations(t *testing.T) {
+	client := &fakeClient{}
+	limited := RateLimit(DefaultLimiter())(client)
+	ctx := context.Background()
+
+	// a crash looping service registering over and over is held to the default rate once the burst is used up
+	const extra = 5
+	start := time.Now()
+	for range DefaultBurst + extra {
+		if _, err := limited.Register(ctx, api.ServiceInstance{ID: "i1"}); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+	}
+	if elapsed, least := time.Since(start), (extra-1)*time.Second/DefaultRateLimit; elapsed < least {
+		t.Fatalf("expected registrations past the burst to be spaced at %d/s, %d took %v", DefaultRateLimit, DefaultBurst+extra, elapsed)
+	}
+	if n := client.count(OpRegister); n != DefaultBurst+extra {
+		t.Fatalf("expected every registration to go through eventually, got %d", n)
+	}
+}
+
+func TestLimiterAllowsBurstThenRate(t *testing.T) {
+	limiter := NewLimiter(20, 3)
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 3 {
+		limiter.Wait(ctx)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("expected the burst to go through at once, took %v", elapsed)
+	}
+	limiter.Wait(ctx)
+	limiter.Wait(ctx)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected calls past the burst to be spaced at the rate of 20/s, took %v", elapsed)
+	}
+}
+
+func TestLimiterWaitRespectsContext(t *testing.T) {
+	limiter := NewLimiter(0, 0)
+	limiter.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestLimiterPausesOnlyExtend(t *testing.T) {
+	limiter := NewLimiter(0, 0)
+	limiter.Pause(80 * time.Millisecond)
+	limiter.Pause(time.Millisecond)
+
+	start := time.Now()
+	limiter.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Fatalf("expected the shorter pause not to cut the longer one short, waited %v", elapsed)
+	}
+}
+
+func TestRateLimitPausesCallsWhenRegistryThrottles(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry(), metrics.Options{})
+	if err != nil {
+		t.Fatalf("failed to create metrics: %v", err)
+	}
+	client := &fakeClient{err: &Error{Kind: ErrThrottled, RetryAfter: 100 * time.Millisecond, Err: errors.New("slow down")}}
+	limited := RateLimit(NewLimiter(0, 0), WithMetrics(m))(client)
+	ctx := context.Background()
+
+	if _, err := limited.SendHeartbeat(ctx, "i1"); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected the throttled error to be returned, got %v", err)
+	}
+	client.setErr(nil)
+
+	start := time.Now()
+	if _, err := limited.Register(ctx, api.ServiceInstance{ID: "i2"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected the next call to wait out the registry's Retry-After, waited %v", elapsed)
+	}
+	if n := testutil.ToFloat64(m.RegistryThrottledCallsTotal.WithLabelValues(OpRegister, "client")); n != 1 {
+		t.Fatalf("expected the held back call to be counted, got %v", n)
+	}
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// config for the Retry middleware
+type RetryConfig struct {
+	// total attempts per call, including the first
+	MaxAttempts int
+	// delay before the first retry, doubled for every retry after it
+	InitialDelay time.Duration
+	// upper bound on the delay between attempts
+	MaxDelay time.Duration
+}
+
+// returns a new RetryConfig with defaults
+func NewDefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:  3,
+		InitialDelay: 200 * time.Millisecond,
+		MaxDelay:     5 * time.Second,
+	}
+}
+
+// retries registry calls that failed with a retryable error, backing off exponentially and honoring delays requested by the registry
+// calls rejected by a circuit breaker are not retried, as the breaker already decides when the registry may be called again
+func Retry(cfg *RetryConfig) Middleware {
+	if cfg == nil {
+		cfg = NewDefaultRetryConfig()
+	}
+	return Intercept(func(ctx context.Context, call Call, invoke func(ctx context.Context) error) error {
+		delay := cfg.InitialDelay
+		var err error
+		for attempt := 1; ; attempt++ {
+			err = invoke(ctx)
+			if err == nil || attempt >= cfg.MaxAttempts || !IsRetryable(err) || errors.Is(err, ErrCircuitOpen) {
+				return err
+			}
+
+			wait := delay
+			if retryAfter := RetryAfter(err); retryAfter > wait {
+				wait = retryAfter
+			}
+			if cfg.MaxDelay > 0 && wait > cfg.MaxDelay {
+				wait = cfg.MaxDelay
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+			delay *= 2
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// instrumentation name of the tracers created by the registry package
+const tracerName = "github.com/lokeshllkumar/flux/registry"
+
+// span attribute keys describing registry calls
+const (
+	AttrOperation     = attribute.Key("flux.registry.operation")
+	AttrProtocol      = attribute.Key("flux.registry.protocol")
+	AttrServiceName   = attribute.Key("flux.service.name")
+	AttrInstanceID    = attribute.Key("flux.instance.id")
+	AttrInstanceCount = attribute.Key("flux.instance.count")
+)
+
+// returns a SpanStarter for the Tracing middleware that records each registry call as an OpenTelemetry span
+// spans carry the operation, protocol, service name and instance ID of the call
+func OpenTelemetrySpans(tp trace.TracerProvider, protocol string) SpanStarter {
+	tracer := tp.Tracer(tracerName)
+	return func(ctx context.Context, call Call) (context.Context, func(err error)) {
+		attrs := []attribute.KeyValue{
+			AttrOperation.String(call.Operation),
+			AttrProtocol.String(protocol),
+		}
+		if call.ServiceName != "" {
+			attrs = append(attrs, AttrServiceName.String(call.ServiceName))
+		}
+		if call.InstanceID != "" {
+			attrs = append(attrs, AttrInstanceID.String(call.InstanceID))
+		}
+		if call.InstanceIDs != nil {
+			attrs = append(attrs, AttrInstanceCount.Int(len(call.InstanceIDs)))
+		}
+
+		ctx, span := tracer.Start(ctx, "registry."+call.Operation, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+		return ctx, func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+// wraps an HTTP transport, recording each request to the registry as a client span and injecting its trace context into the request headers
+type tracingTransport struct {
+	base       http.RoundTripper
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// creates a new tracingTransport around the base transport
+func newTracingTransport(base http.RoundTripper, o *clientOptions) *tracingTransport {
+	return &tracingTransport{
+		base:       base,
+		tracer:     o.tracerProvider.Tracer(tracerName),
+		propagator: o.propagator,
+	}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+		),
+	)
+	defer span.End()
+
+	// requests must not be modified by a RoundTripper, so the headers are injected into a clone
+	req = req.Clone(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// carries trace context in outgoing gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// starts a client span for a gRPC method and injects its trace context into the outgoing metadata
+func startGRPCSpan(ctx context.Context, tracer trace.Tracer, propagator propagation.TextMapPropagator, method string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+		),
+	)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// returns a unary interceptor recording each RPC to the registry as a client span carrying its trace context
+func tracingUnaryInterceptor(o *clientOptions) grpc.UnaryClientInterceptor {
+	tracer := o.tracerProvider.Tracer(tracerName)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startGRPCSpan(ctx, tracer, o.propagator, method)
+		defer span.End()
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// returns a stream interceptor carrying trace context on streams opened to the registry
+// the span only covers opening the stream, since KeepAlive streams outlive any single operation
+func tracingStreamInterceptor(o *clientOptions) grpc.StreamClientInterceptor {
+	tracer := o.tracerProvider.Tracer(tracerName)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startGRPCSpan(ctx, tracer, o.propagator, method)
+		defer span.End()
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return stream, err
+	}
+}
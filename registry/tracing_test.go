@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+	pb "github.com/lokeshllkumar/flux/gen"
+	"github.com/lokeshllkumar/flux/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func newTestTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return tp, exporter
+}
+
+// returns the ended span with the given name, failing the test if there is none
+func findSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %s among %d spans", name, len(exporter.GetSpans()))
+	return tracetest.SpanStub{}
+}
+
+func attrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestTracingMiddlewareRecordsRegistryCalls(t *testing.T) {
+	tp, exporter := newTestTracerProvider(t)
+	client := &fakeClient{}
+	traced := Tracing(OpenTelemetrySpans(tp, "http"))(client)
+
+	if _, err := traced.Register(context.Background(), api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	span := findSpan(t, exporter, "registry.register")
+	got := attrs(span)
+	want := map[attribute.Key]string{AttrOperation: OpRegister, AttrProtocol: "http", AttrServiceName: "svc", AttrInstanceID: "i1"}
+	for key, value := range want {
+		if got[key].AsString() != value {
+			t.Fatalf("expected attribute %s=%s, got %q", key, value, got[key].AsString())
+		}
+	}
+	if span.Status.Code != codes.Unset {
+		t.Fatalf("expected a successful call to leave the status unset, got %v", span.Status)
+	}
+
+	client.setErr(&Error{Kind: ErrUnavailable, Err: errors.New("registry down")})
+	traced.SendHeartbeat(context.Background(), "i1")
+	span = findSpan(t, exporter, "registry.send_heartbeat")
+	if span.Status.Code != codes.Error || span.Status.Description != "registry down" {
+		t.Fatalf("expected a failed call to set an error status, got %+v", span.Status)
+	}
+	if len(span.Events) == 0 || span.Events[0].Name != "exception" {
+		t.Fatalf("expected the error to be recorded as an exception event, got %+v", span.Events)
+	}
+	if attrs(span)[AttrInstanceID].AsString() != "i1" {
+		t.Fatal("expected the heartbeat span to carry the instance ID")
+	}
+
+	traced.SendHeartbeats(context.Background(), []string{"a", "b", "c"})
+	if n := attrs(findSpan(t, exporter, "registry.send_heartbeats"))[AttrInstanceCount].AsInt64(); n != 3 {
+		t.Fatalf("expected the batched heartbeat span to count 3 instances, got %d", n)
+	}
+}
+
+func TestMetricsServeTraceExemplarsAsOpenMetrics(t *testing.T) {
+	tp, _ := newTestTracerProvider(t)
+	reg := prometheus.NewRegistry()
+	m, err := metrics.New(reg, metrics.Options{})
+	if err != nil {
+		t.Fatalf("failed to create metrics: %v", err)
+	}
+	client := Chain(&fakeClient{}, Tracing(OpenTelemetrySpans(tp, "http")), Metrics(m, "http"))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	if !span.SpanContext().IsSampled() {
+		t.Fatal("expected the test span to be sampled")
+	}
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	span.End()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	metrics.HandlerFor(reg).ServeHTTP(rec, req)
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Fatalf("expected the OpenMetrics format to be served, got %s", contentType)
+	}
+
+	exemplar := `trace_id="` + span.SpanContext().TraceID().String() + `"`
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "flux_registry_call_duration_seconds_bucket{") && strings.Contains(line, `operation="register"`) &&
+			strings.Contains(line, " # {") && strings.Contains(line, exemplar) {
+			return
+		}
+	}
+	t.Fatalf("expected a call duration bucket with the exemplar %s, got:\n%s", exemplar, rec.Body.String())
+}
+
+func TestHTTPClientPropagatesTraceContextInHeaders(t *testing.T) {
+	tp, exporter := newTestTracerProvider(t)
+	headers := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient(srv.URL, time.Second, WithTracerProvider(tp), WithPropagator(propagation.TraceContext{}))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	parent.End()
+
+	header := <-headers
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header)))
+	if !remote.IsValid() || remote.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatalf("expected the request to carry the caller's trace, got traceparent %q", header.Get("traceparent"))
+	}
+
+	span := findSpan(t, exporter, "HTTP POST")
+	if span.SpanKind != trace.SpanKindClient || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("expected a client span under the caller's span, got kind %v parent %v", span.SpanKind, span.Parent.SpanID())
+	}
+	if remote.SpanID() != span.SpanContext.SpanID() {
+		t.Fatal("expected the propagated context to identify the request's client span")
+	}
+}
+
+// registry server recording the metadata of the registration it receives
+type metadataServer struct {
+	pb.UnimplementedServiceRegistryServer
+	received chan metadata.MD
+}
+
+func (s *metadataServer) RegisterService(ctx context.Context, req *pb.RegisterServiceRequest) (*pb.ServiceRegistryResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.received <- md
+	return &pb.ServiceRegistryResponse{Success: true}, nil
+}
+
+func TestGRPCClientPropagatesTraceContextInMetadata(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	registry := &metadataServer{received: make(chan metadata.MD, 1)}
+	pb.RegisterServiceRegistryServer(srv, registry)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	tp, exporter := newTestTracerProvider(t)
+	client, err := NewGRPCClient(lis.Addr().String(), time.Second, WithTracerProvider(tp), WithPropagator(propagation.TraceContext{}))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := client.Register(ctx, api.ServiceInstance{ID: "i1", ServiceName: "svc"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	parent.End()
+
+	md := <-registry.received
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), metadataCarrier(md)))
+	if !remote.IsValid() || remote.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatalf("expected the RPC to carry the caller's trace, got metadata %v", md)
+	}
+
+	method := pb.ServiceRegistry_RegisterService_FullMethodName
+	span := findSpan(t, exporter, method)
+	if span.SpanKind != trace.SpanKindClient || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("expected a client span under the caller's span, got kind %v parent %v", span.SpanKind, span.Parent.SpanID())
+	}
+	if attrs(span)["rpc.method"].AsString() != method {
+		t.Fatalf("expected the span to name the RPC method, got %v", span.Attributes)
+	}
+}
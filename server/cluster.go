@@ -0,0 +1,503 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// a node of a replicated registry cluster
+type Peer struct {
+	// unique, stable ID of the node
+	ID string
+	// address the node's Raft transport listens on
+	RaftAddr string
+	// base URL of the node's registry API, to which other nodes forward writes while it leads
+	APIURL string
+}
+
+// config for running the registry server as a node of a Raft cluster
+type ClusterConfig struct {
+	// ID of this node, which must be one of Peers
+	NodeID string
+	// address to listen on for Raft traffic; ignored when Transport is set
+	RaftAddr string
+	// every node of the cluster, this one included, typically 3 or 5 of them
+	Peers []Peer
+	// bootstraps a new cluster from Peers unless this node already holds Raft state; set it on every node of a new cluster
+	Bootstrap bool
+	// how long a write may wait to be committed by a quorum; DefaultApplyTimeout is used when zero
+	ApplyTimeout time.Duration
+	// carries Raft traffic in place of TCP on RaftAddr, e.g. a raft.NewInmemTransport for nodes run in one process
+	Transport raft.Transport
+	// receives Raft's own logs; os.Stderr is used when nil
+	RaftLogOutput io.Writer
+}
+
+// how long a write waits to be committed when ClusterConfig.ApplyTimeout is zero
+const DefaultApplyTimeout = 5 * time.Second
+
+// header marking a write forwarded by a follower, so that it is not forwarded again while leadership is changing
+const forwardedHeader = "X-Flux-Forwarded"
+
+// the registry's state replicated across a cluster with Raft
+// every change is committed to the Raft log by the leader and applied by every node, so reads are served by any node
+// from its local copy, which may briefly lag the leader's. Writes must be made on the leader, and Handler forwards
+// them there; only the leader expires leases
+type Cluster struct {
+	config  *Config
+	cluster *ClusterConfig
+	logger  *slog.Logger
+
+	fsm  *fsm
+	raft *raft.Raft
+	// closed along with the node: the transport it created and the Bolt store
+	closers []io.Closer
+	// when this node last became leader, nil while it is not leading
+	leaderSince atomic.Pointer[time.Time]
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// starts this node of a registry cluster, with its Raft log and snapshots kept in DataDir, or in memory when DataDir is empty
+func OpenCluster(cfg *Config) (*Cluster, error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+	cc := cfg.Cluster
+	if err := validateClusterConfig(cc); err != nil {
+		return nil, err
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logOutput := cc.RaftLogOutput
+	if logOutput == nil {
+		logOutput = os.Stderr
+	}
+
+	c := &Cluster{
+		config:  cfg,
+		cluster: cc,
+		logger:  logger.With("node_id", cc.NodeID),
+		fsm:     newFSM(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(cc.NodeID)
+	// Raft logs through hclog; only its warnings and errors are worth surfacing next to the registry's own logs
+	rc.Logger = hclog.New(&hclog.LoggerOptions{Name: "raft", Level: hclog.Warn, Output: logOutput})
+	if cfg.SnapshotInterval > 0 {
+		rc.SnapshotInterval = cfg.SnapshotInterval
+	}
+	if cfg.SnapshotThreshold > 0 {
+		rc.SnapshotThreshold = uint64(cfg.SnapshotThreshold)
+	}
+
+	var (
+		logs   raft.LogStore
+		stable raft.StableStore
+		snaps  raft.SnapshotStore
+	)
+	if cfg.DataDir == "" {
+		store := raft.NewInmemStore()
+		logs, stable, snaps = store, store, raft.NewInmemSnapshotStore()
+	} else {
+		if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+			return nil, fmt.Errorf("server: failed to create data directory %s: %w", cfg.DataDir, err)
+		}
+		store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft.db"))
+		if err != nil {
+			return nil, fmt.Errorf("server: failed to open raft log in %s: %w", cfg.DataDir, err)
+		}
+		c.closers = append(c.closers, store)
+		logs, stable = store, store
+		if snaps, err = raft.NewFileSnapshotStore(cfg.DataDir, 2, logOutput); err != nil {
+			c.closeAll()
+			return nil, fmt.Errorf("server: failed to open raft snapshots in %s: %w", cfg.DataDir, err)
+		}
+	}
+
+	transport := cc.Transport
+	if transport == nil {
+		advertise, err := net.ResolveTCPAddr("tcp", cc.RaftAddr)
+		if err != nil {
+			c.closeAll()
+			return nil, fmt.Errorf("server: failed to resolve raft address %s: %w", cc.RaftAddr, err)
+		}
+		tcp, err := raft.NewTCPTransport(cc.RaftAddr, advertise, 3, 10*time.Second, logOutput)
+		if err != nil {
+			c.closeAll()
+			return nil, fmt.Errorf("server: failed to listen for raft traffic on %s: %w", cc.RaftAddr, err)
+		}
+		c.closers = append(c.closers, tcp)
+		transport = tcp
+	}
+
+	if cc.Bootstrap {
+		existing, err := raft.HasExistingState(logs, stable, snaps)
+		if err != nil {
+			c.closeAll()
+			return nil, fmt.Errorf("server: failed to check for existing raft state: %w", err)
+		}
+		if !existing {
+			servers := make([]raft.Server, 0, len(cc.Peers))
+			for _, peer := range cc.Peers {
+				servers = append(servers, raft.Server{ID: raft.ServerID(peer.ID), Address: raft.ServerAddress(peer.RaftAddr)})
+			}
+			if err := raft.BootstrapCluster(rc, logs, stable, snaps, transport, raft.Configuration{Servers: servers}); err != nil {
+				c.closeAll()
+				return nil, fmt.Errorf("server: failed to bootstrap raft cluster: %w", err)
+			}
+		}
+	}
+
+	r, err := raft.NewRaft(rc, c.fsm, logs, stable, snaps, transport)
+	if err != nil {
+		c.closeAll()
+		return nil, fmt.Errorf("server: failed to start raft: %w", err)
+	}
+	c.raft = r
+
+	go c.run()
+	return c, nil
+}
+
+// checks that the cluster config describes this node as one of its peers
+func validateClusterConfig(cc *ClusterConfig) error {
+	if cc == nil {
+		return fmt.Errorf("server: Cluster must be set in the config")
+	}
+	if cc.NodeID == "" {
+		return fmt.Errorf("server: NodeID must be provided in the cluster config")
+	}
+	if cc.Transport == nil && cc.RaftAddr == "" {
+		return fmt.Errorf("server: RaftAddr must be provided in the cluster config")
+	}
+	if cc.ApplyTimeout < 0 {
+		return fmt.Errorf("server: ApplyTimeout must be non-negative")
+	}
+	seen := make(map[string]bool, len(cc.Peers))
+	for _, peer := range cc.Peers {
+		if peer.ID == "" || peer.RaftAddr == "" || peer.APIURL == "" {
+			return fmt.Errorf("server: peer %q must have an ID, RaftAddr and APIURL", peer.ID)
+		}
+		if seen[peer.ID] {
+			return fmt.Errorf("server: peer %s is listed more than once", peer.ID)
+		}
+		seen[peer.ID] = true
+	}
+	if !seen[cc.NodeID] {
+		return fmt.Errorf("server: node %s is not listed among the peers", cc.NodeID)
+	}
+	return nil
+}
+
+// commits an event to the Raft log and returns the response of applying it
+func (c *Cluster) commit(e Event) (any, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to marshal %s event: %w", e.Type, err)
+	}
+	timeout := c.cluster.ApplyTimeout
+	if timeout == 0 {
+		timeout = DefaultApplyTimeout
+	}
+	future := c.raft.Apply(data, timeout)
+	if err := future.Error(); err != nil {
+		return nil, fmt.Errorf("server: failed to replicate %s event: %w", e.Type, err)
+	}
+	if err, ok := future.Response().(error); ok {
+		return nil, err
+	}
+	return future.Response(), nil
+}
+
+// commits an event and returns the lease ID it was applied with
+func (c *Cluster) apply(e Event) (string, error) {
+	response, err := c.commit(e)
+	if err != nil {
+		return "", err
+	}
+	leaseID, _ := response.(string)
+	return leaseID, nil
+}
+
+// commits several events as a single log entry and returns the error each was applied with
+func (c *Cluster) applyBatch(events []Event) ([]error, error) {
+	response, err := c.commit(Event{Type: EventBatch, Events: events})
+	if err != nil {
+		return nil, err
+	}
+	errs, ok := response.([]error)
+	if !ok || len(errs) != len(events) {
+		return nil, fmt.Errorf("server: unexpected response %v to a batch of %d events", response, len(events))
+	}
+	return errs, nil
+}
+
+// registers an instance, replacing any earlier registration of its ID, and grants it a new lease
+func (c *Cluster) Register(instance api.ServiceInstance) (api.Lease, error) {
+	if instance.ID == "" || instance.ServiceName == "" {
+		return api.Lease{}, fmt.Errorf("%w: id and serviceName must be set", ErrInvalid)
+	}
+	leaseID, err := c.apply(Event{Type: EventRegister, Instance: &instance, InstanceID: instance.ID, ExpiresAt: time.Now().Add(c.config.LeaseTTL)})
+	if err != nil {
+		return api.Lease{}, err
+	}
+	return c.lease(leaseID), nil
+}
+
+// returns the event renewing the lease of a registered instance, checked against this node's copy of the state
+func (c *Cluster) heartbeatEvent(instanceID string, now time.Time) (Event, error) {
+	c.fsm.mu.RLock()
+	r, ok := c.fsm.state.records[instanceID]
+	var leaseID string
+	var expiresAt time.Time
+	if ok {
+		leaseID, expiresAt = r.LeaseID, r.ExpiresAt
+	}
+	c.fsm.mu.RUnlock()
+
+	if !ok {
+		return Event{}, fmt.Errorf("%w: %s", ErrNotFound, instanceID)
+	}
+	// a lease that ran out while heartbeats could not be committed for want of a leader is still honoured during the new leader's grace period
+	if !expiresAt.After(now) && !c.inGracePeriod() {
+		return Event{}, fmt.Errorf("%w: lease %s of instance %s", ErrLeaseExpired, leaseID, instanceID)
+	}
+	return Event{Type: EventHeartbeat, InstanceID: instanceID, LeaseID: leaseID, ExpiresAt: now.Add(c.config.LeaseTTL)}, nil
+}
+
+// renews the lease of a registered instance
+func (c *Cluster) Heartbeat(instanceID string) (api.Lease, error) {
+	e, err := c.heartbeatEvent(instanceID, time.Now())
+	if err != nil {
+		return api.Lease{}, err
+	}
+	if _, err := c.apply(e); err != nil {
+		return api.Lease{}, err
+	}
+	return c.lease(e.LeaseID), nil
+}
+
+// renews the leases of several instances, reporting the outcome of each
+// the renewals are committed as a single log entry; an error is only returned when it could not be committed
+func (c *Cluster) Heartbeats(instanceIDs []string) ([]api.HeartbeatResult, error) {
+	now := time.Now()
+	results := make([]api.HeartbeatResult, len(instanceIDs))
+	var batch []Event
+	var positions []int
+	for i, instanceID := range instanceIDs {
+		e, err := c.heartbeatEvent(instanceID, now)
+		if err != nil {
+			results[i] = heartbeatFailure(instanceID, err)
+			continue
+		}
+		batch = append(batch, e)
+		positions = append(positions, i)
+	}
+	if len(batch) == 0 {
+		return results, nil
+	}
+
+	errs, err := c.applyBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range positions {
+		if errs[j] != nil {
+			// the instance registered again or went away before the batch was applied
+			results[i] = heartbeatFailure(instanceIDs[i], errs[j])
+			continue
+		}
+		results[i] = api.HeartbeatResult{InstanceID: instanceIDs[i], Success: true, TTLSeconds: c.lease(batch[j].LeaseID).TTLSeconds}
+	}
+	return results, nil
+}
+
+// reports a heartbeat rejected for an instance that is not registered or whose lease ran out
+func heartbeatFailure(instanceID string, err error) api.HeartbeatResult {
+	if errors.Is(err, ErrLeaseExpired) {
+		return api.HeartbeatResult{InstanceID: instanceID, LeaseExpired: true, Message: err.Error()}
+	}
+	return api.HeartbeatResult{InstanceID: instanceID, NotRegistered: true, Message: err.Error()}
+}
+
+// removes a registered instance
+func (c *Cluster) Deregister(instanceID string) error {
+	_, err := c.apply(Event{Type: EventDeregister, InstanceID: instanceID})
+	return err
+}
+
+// returns the instances of a service whose leases have not run out, from this node's copy of the state
+func (c *Cluster) Healthy(serviceName string) []api.ServiceInstance {
+	c.fsm.mu.RLock()
+	defer c.fsm.mu.RUnlock()
+	return c.fsm.state.healthy(serviceName, time.Now())
+}
+
+func (c *Cluster) lease(leaseID string) api.Lease {
+	return api.Lease{ID: leaseID, TTLSeconds: int64(c.config.LeaseTTL / time.Second)}
+}
+
+// reports whether this node is the cluster's leader
+func (c *Cluster) IsLeader() bool {
+	return c.raft.State() == raft.Leader
+}
+
+// returns the API URL of the current leader, if one is known
+func (c *Cluster) LeaderURL() (string, bool) {
+	_, id := c.raft.LeaderWithID()
+	if id == "" {
+		return "", false
+	}
+	for _, peer := range c.cluster.Peers {
+		if peer.ID == string(id) {
+			return peer.APIURL, true
+		}
+	}
+	return "", false
+}
+
+// returns an http.Handler serving the registry HTTP API, reading from this node and forwarding writes to the leader
+// while no leader is elected writes fail with 503 and a Retry-After, which registry clients retry
+func (c *Cluster) Handler() http.Handler {
+	local := NewHandler(c, c.logger)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || c.IsLeader() {
+			local.ServeHTTP(w, r)
+			return
+		}
+
+		leaderURL, ok := c.LeaderURL()
+		if !ok || r.Header.Get(forwardedHeader) != "" {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "no registry leader elected", http.StatusServiceUnavailable)
+			return
+		}
+		target, err := url.Parse(leaderURL)
+		if err != nil {
+			c.logger.Error("invalid leader API URL", "url", leaderURL, "error", err)
+			http.Error(w, "invalid leader API URL", http.StatusInternalServerError)
+			return
+		}
+		r.Header.Set(forwardedHeader, c.cluster.NodeID)
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			c.logger.Warn("failed to forward write to leader", "leader", leaderURL, "error", err)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "registry leader unreachable", http.StatusServiceUnavailable)
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// tracks leadership and, while leading, expires leases until the node is closed
+// a new leader waits a lease TTL before expiring anything, since heartbeats sent while no leader was elected were lost
+func (c *Cluster) run() {
+	defer close(c.done)
+	expiry := time.NewTicker(c.config.ExpiryInterval)
+	defer expiry.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case leading := <-c.raft.LeaderCh():
+			if leading {
+				now := time.Now()
+				c.leaderSince.Store(&now)
+				c.logger.Info("became registry leader")
+			} else {
+				c.leaderSince.Store(nil)
+				c.logger.Info("lost registry leadership")
+			}
+		case <-expiry.C:
+			if c.leaderSince.Load() == nil || c.inGracePeriod() {
+				continue
+			}
+			c.expire()
+		}
+	}
+}
+
+// reports whether this node became leader less than a lease TTL ago
+func (c *Cluster) inGracePeriod() bool {
+	since := c.leaderSince.Load()
+	return since != nil && time.Since(*since) < c.config.LeaseTTL
+}
+
+// removes instances whose leases ran out, committed as a single log entry so that leadership changes are not left waiting behind
+// one commit per instance
+func (c *Cluster) expire() {
+	c.fsm.mu.RLock()
+	expired := c.fsm.state.expired(time.Now())
+	c.fsm.mu.RUnlock()
+	if len(expired) == 0 {
+		return
+	}
+
+	batch := make([]Event, 0, len(expired))
+	for _, r := range expired {
+		batch = append(batch, Event{Type: EventExpire, InstanceID: r.Instance.ID, LeaseID: r.LeaseID})
+	}
+	if _, err := c.applyBatch(batch); err != nil {
+		c.logger.Warn("failed to expire instances", "instances", len(batch), "error", err)
+		return
+	}
+	for _, r := range expired {
+		c.logger.Info("instance lease expired", "service", r.Instance.ServiceName, "instance_id", r.Instance.ID)
+	}
+}
+
+// stops the node, handing leadership to another node first when leading so that the cluster need not wait for an election timeout
+func (c *Cluster) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+
+		if c.IsLeader() && len(c.cluster.Peers) > 1 {
+			if transferErr := c.raft.LeadershipTransfer().Error(); transferErr != nil {
+				c.logger.Warn("failed to transfer leadership", "error", transferErr)
+			}
+		}
+		if shutdownErr := c.raft.Shutdown().Error(); shutdownErr != nil {
+			err = fmt.Errorf("server: failed to shut down raft: %w", shutdownErr)
+		}
+		c.closeAll()
+	})
+	return err
+}
+
+// closes the transport and stores opened for the node
+func (c *Cluster) closeAll() {
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil {
+			c.logger.Warn("failed to close raft resource", "error", err)
+		}
+	}
+	c.closers = nil
+}
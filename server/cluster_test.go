@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// bytes.Buffer safe for the concurrent writes of a node's logger
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// a node of a test cluster along with its API server and logs
+type testNode struct {
+	cluster *Cluster
+	server  *httptest.Server
+	logs    *logBuffer
+}
+
+// starts a cluster of n nodes connected by in-memory transports, each serving its API on an httptest server
+func startTestCluster(t *testing.T, n int, leaseTTL time.Duration) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, n)
+	handlers := make([]atomic.Pointer[http.Handler], n)
+	transports := make([]*raft.InmemTransport, n)
+	peers := make([]Peer, n)
+	for i := range nodes {
+		addr, transport := raft.NewInmemTransport("")
+		transports[i] = transport
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			(*handlers[i].Load()).ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		nodes[i] = &testNode{server: server, logs: &logBuffer{}}
+		peers[i] = Peer{ID: string(rune('a' + i)), RaftAddr: string(addr), APIURL: server.URL}
+	}
+	for i, transport := range transports {
+		for j, other := range transports {
+			if i != j {
+				transport.Connect(other.LocalAddr(), other)
+			}
+		}
+	}
+
+	for i, node := range nodes {
+		cfg := NewDefaultConfig()
+		cfg.LeaseTTL = leaseTTL
+		cfg.ExpiryInterval = 20 * time.Millisecond
+		cfg.Logger = slog.New(slog.NewTextHandler(node.logs, nil))
+		cfg.Cluster = &ClusterConfig{
+			NodeID:        peers[i].ID,
+			Peers:         peers,
+			Bootstrap:     true,
+			Transport:     transports[i],
+			RaftLogOutput: io.Discard,
+		}
+		cluster, err := OpenCluster(cfg)
+		if err != nil {
+			t.Fatalf("failed to open node %s: %v", peers[i].ID, err)
+		}
+		t.Cleanup(func() { cluster.Close() })
+		node.cluster = cluster
+		handler := cluster.Handler()
+		handlers[i].Store(&handler)
+	}
+	return nodes
+}
+
+// polls until cond holds, failing the test after a while
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// waits for exactly one of the running nodes to lead and returns it
+func waitForLeader(t *testing.T, nodes []*testNode) *testNode {
+	t.Helper()
+	var leader *testNode
+	eventually(t, "a leader is elected", func() bool {
+		leader = nil
+		for _, node := range nodes {
+			if node.cluster.IsLeader() {
+				if leader != nil {
+					return false
+				}
+				leader = node
+			}
+		}
+		return leader != nil && leader.cluster.leaderSince.Load() != nil
+	})
+	return leader
+}
+
+func followersOf(nodes []*testNode, leader *testNode) []*testNode {
+	var followers []*testNode
+	for _, node := range nodes {
+		if node != leader {
+			followers = append(followers, node)
+		}
+	}
+	return followers
+}
+
+// waits until every node reports the given instance IDs of the service
+func waitForConvergence(t *testing.T, nodes []*testNode, serviceName string, ids ...string) {
+	t.Helper()
+	eventually(t, "every node reports "+strings.Join(ids, ","), func() bool {
+		for _, node := range nodes {
+			instances := node.cluster.Healthy(serviceName)
+			if len(instances) != len(ids) {
+				return false
+			}
+			for i, instance := range instances {
+				if instance.ID != ids[i] {
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
+
+func TestClusterElectsLeaderAndForwardsWrites(t *testing.T) {
+	nodes := startTestCluster(t, 3, 30*time.Second)
+	leader := waitForLeader(t, nodes)
+	follower := followersOf(nodes, leader)[0]
+	if url, ok := follower.cluster.LeaderURL(); !ok || url != leader.server.URL {
+		t.Fatalf("expected the follower to know the leader at %s, got %q", leader.server.URL, url)
+	}
+
+	// a write sent to a follower is forwarded to the leader and replicated to every node
+	body, _ := json.Marshal(api.ServiceInstance{ID: "billing-1", ServiceName: "billing", Host: "10.0.0.7", Port: 8000})
+	resp, err := http.Post(follower.server.URL+"/api/v1/services/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("register through the follower failed: %v", err)
+	}
+	var lease api.Lease
+	json.NewDecoder(resp.Body).Decode(&lease)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || lease.ID == "" {
+		t.Fatalf("expected the forwarded registration to be granted a lease, got %d %+v", resp.StatusCode, lease)
+	}
+	waitForConvergence(t, nodes, "billing", "billing-1")
+
+	// reads are served by the follower itself
+	resp, err = http.Get(follower.server.URL + "/api/v1/services/billing/healthy")
+	if err != nil {
+		t.Fatalf("read from the follower failed: %v", err)
+	}
+	var instances []api.ServiceInstance
+	json.NewDecoder(resp.Body).Decode(&instances)
+	resp.Body.Close()
+	if len(instances) != 1 || instances[0].ID != "billing-1" {
+		t.Fatalf("expected the follower to serve the replicated instance, got %+v", instances)
+	}
+}
+
+func TestClusterCommitsHeartbeatsAsOneEntry(t *testing.T) {
+	nodes := startTestCluster(t, 3, 30*time.Second)
+	leader := waitForLeader(t, nodes)
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := leader.cluster.Register(api.ServiceInstance{ID: id, ServiceName: "svc"}); err != nil {
+			t.Fatalf("failed to register %s: %v", id, err)
+		}
+	}
+
+	before := leader.cluster.raft.LastIndex()
+	results, err := leader.cluster.Heartbeats([]string{"a", "missing", "b", "c"})
+	if err != nil {
+		t.Fatalf("heartbeats failed: %v", err)
+	}
+	if after := leader.cluster.raft.LastIndex(); after != before+1 {
+		t.Fatalf("expected the heartbeats to be committed as one log entry, the log grew by %d", after-before)
+	}
+	if len(results) != 4 || !results[0].Success || !results[1].NotRegistered || !results[2].Success || !results[3].Success {
+		t.Fatalf("expected every registered instance to be renewed and the missing one reported, got %+v", results)
+	}
+	if results[0].TTLSeconds != 30 {
+		t.Fatalf("expected the lease TTL to be reported, got %+v", results[0])
+	}
+}
+
+func TestClusterExpiresLeasesOnlyOnLeader(t *testing.T) {
+	nodes := startTestCluster(t, 3, time.Second)
+	leader := waitForLeader(t, nodes)
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := leader.cluster.Register(api.ServiceInstance{ID: id, ServiceName: "svc"}); err != nil {
+			t.Fatalf("failed to register %s: %v", id, err)
+		}
+	}
+	// renewed together, the leases run out at the same moment
+	if _, err := leader.cluster.Heartbeats([]string{"a", "b", "c"}); err != nil {
+		t.Fatalf("heartbeats failed: %v", err)
+	}
+	waitForConvergence(t, nodes, "svc", "a", "b", "c")
+	before := leader.cluster.raft.LastIndex()
+
+	// with no heartbeats, the leader removes the instances once its grace period and their leases have run out
+	eventually(t, "every node dropped the expired instances", func() bool {
+		for _, node := range nodes {
+			node.cluster.fsm.mu.RLock()
+			remaining := len(node.cluster.fsm.state.records)
+			node.cluster.fsm.mu.RUnlock()
+			if remaining != 0 {
+				return false
+			}
+		}
+		return true
+	})
+	if after := leader.cluster.raft.LastIndex(); after != before+1 {
+		t.Fatalf("expected the expirations to be committed as one log entry, the log grew by %d", after-before)
+	}
+
+	if logs := leader.logs.String(); strings.Count(logs, "instance lease expired") != 3 {
+		t.Fatalf("expected the leader to expire the 3 instances, got logs:\n%s", logs)
+	}
+	for _, follower := range followersOf(nodes, leader) {
+		if logs := follower.logs.String(); strings.Contains(logs, "expire") {
+			t.Fatalf("expected follower %s not to expire anything, got logs:\n%s", follower.cluster.cluster.NodeID, logs)
+		}
+	}
+}
+
+func TestClusterKeepsRegistrationsAcrossFailover(t *testing.T) {
+	nodes := startTestCluster(t, 3, 30*time.Second)
+	leader := waitForLeader(t, nodes)
+	lease, err := leader.cluster.Register(api.ServiceInstance{ID: "billing-1", ServiceName: "billing"})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	waitForConvergence(t, nodes, "billing", "billing-1")
+
+	if err := leader.cluster.Close(); err != nil {
+		t.Fatalf("failed to close leader: %v", err)
+	}
+	remaining := followersOf(nodes, leader)
+	next := waitForLeader(t, remaining)
+
+	waitForConvergence(t, remaining, "billing", "billing-1")
+	renewed, err := next.cluster.Heartbeat("billing-1")
+	if err != nil {
+		t.Fatalf("heartbeat to the new leader failed: %v", err)
+	}
+	if renewed.ID != lease.ID {
+		t.Fatalf("expected the lease %s to survive the failover, got %s", lease.ID, renewed.ID)
+	}
+	if !next.cluster.inGracePeriod() {
+		t.Fatal("expected the new leader to hold off expiring leases for a lease TTL")
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// kind of change made to the registry's state
+type EventType string
+
+const (
+	EventRegister   EventType = "register"
+	EventHeartbeat  EventType = "heartbeat"
+	EventDeregister EventType = "deregister"
+	// an instance's lease ran out without being renewed
+	EventExpire EventType = "expire"
+	// several heartbeat or expire events committed together, e.g. as a single Raft log entry
+	EventBatch EventType = "batch"
+)
+
+// a single change to the registry's state, as written to the write-ahead log
+// events carry everything needed to apply them, including lease expiry times, so that replaying them rebuilds the same state
+type Event struct {
+	// position of the event in the log, starting at 1
+	Seq  uint64    `json:"seq"`
+	Type EventType `json:"type"`
+	// set for register events
+	Instance   *api.ServiceInstance `json:"instance,omitempty"`
+	InstanceID string               `json:"instanceId"`
+	LeaseID    string               `json:"leaseId,omitempty"`
+	// set for register and heartbeat events
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// set for batch events, applied in order under the batch's sequence number
+	Events []Event `json:"events,omitempty"`
+}
+
+// a registered instance and its lease
+type record struct {
+	Instance  api.ServiceInstance `json:"instance"`
+	LeaseID   string              `json:"leaseId"`
+	ExpiresAt time.Time           `json:"expiresAt"`
+}
+
+// the registry's state, built up by applying events in order
+type state struct {
+	records map[string]*record
+	// sequence number of the last event applied
+	lastSeq uint64
+}
+
+func newState() *state {
+	return &state{records: map[string]*record{}}
+}
+
+// applies an event to the state; events for unknown instances or superseded leases change nothing, so that applying is deterministic
+// returns ErrNotFound for heartbeats and deregistrations that changed nothing
+func (s *state) apply(e Event) error {
+	if e.Seq > s.lastSeq {
+		s.lastSeq = e.Seq
+	}
+	switch e.Type {
+	case EventRegister:
+		if e.Instance != nil {
+			s.records[e.Instance.ID] = &record{Instance: *e.Instance, LeaseID: e.LeaseID, ExpiresAt: e.ExpiresAt}
+		}
+	case EventHeartbeat:
+		r, ok := s.records[e.InstanceID]
+		if !ok || r.LeaseID != e.LeaseID {
+			return fmt.Errorf("%w: %s", ErrNotFound, e.InstanceID)
+		}
+		r.ExpiresAt = e.ExpiresAt
+	case EventDeregister:
+		if _, ok := s.records[e.InstanceID]; !ok {
+			return fmt.Errorf("%w: %s", ErrNotFound, e.InstanceID)
+		}
+		delete(s.records, e.InstanceID)
+	case EventExpire:
+		if r, ok := s.records[e.InstanceID]; ok && r.LeaseID == e.LeaseID {
+			delete(s.records, e.InstanceID)
+		}
+	case EventBatch:
+		s.applyBatch(e)
+	}
+	return nil
+}
+
+// applies the events of a batch event, returning the error of each in order
+func (s *state) applyBatch(e Event) []error {
+	if e.Seq > s.lastSeq {
+		s.lastSeq = e.Seq
+	}
+	errs := make([]error, len(e.Events))
+	for i, sub := range e.Events {
+		sub.Seq = e.Seq
+		errs[i] = s.apply(sub)
+	}
+	return errs
+}
+
+// returns the instances of a service whose leases have not run out at now, ordered by ID
+func (s *state) healthy(serviceName string, now time.Time) []api.ServiceInstance {
+	instances := []api.ServiceInstance{}
+	for _, r := range s.records {
+		if r.Instance.ServiceName == serviceName && r.ExpiresAt.After(now) {
+			instances = append(instances, r.Instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances
+}
+
+// returns the records whose leases ran out at now
+func (s *state) expired(now time.Time) []record {
+	var expired []record
+	for _, r := range s.records {
+		if !r.ExpiresAt.After(now) {
+			expired = append(expired, *r)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+// applies the events committed to the Raft log to the registry's state; every node holds an identical copy
+type fsm struct {
+	mu    sync.RWMutex
+	state *state
+}
+
+func newFSM() *fsm {
+	return &fsm{state: newState()}
+}
+
+// applies a committed event; the response is the event's lease ID, or the error it failed with, and for batch events the error of
+// each of its events
+// register events are given a lease ID derived from their log index, which every node agrees on
+func (f *fsm) Apply(entry *raft.Log) any {
+	var e Event
+	if err := json.Unmarshal(entry.Data, &e); err != nil {
+		return fmt.Errorf("server: failed to decode replicated event at index %d: %w", entry.Index, err)
+	}
+	e.Seq = entry.Index
+	if e.Type == EventRegister && e.LeaseID == "" {
+		e.LeaseID = strconv.FormatUint(entry.Index, 16)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e.Type == EventBatch {
+		return f.state.applyBatch(e)
+	}
+	if err := f.state.apply(e); err != nil {
+		return err
+	}
+	return e.LeaseID
+}
+
+// captures the state for Raft to persist while it goes on applying events
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := encodeSnapshot(f.state)
+	if err != nil {
+		return nil, err
+	}
+	return &fsmSnapshot{data: data}, nil
+}
+
+// replaces the state with a snapshot, e.g. one sent by the leader to a node that fell too far behind
+func (f *fsm) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	data, err := io.ReadAll(snapshot)
+	if err != nil {
+		return fmt.Errorf("server: failed to read raft snapshot: %w", err)
+	}
+	st, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.state = st
+	f.mu.Unlock()
+	return nil
+}
+
+// state encoded in the snapshot file format, written out by Raft
+type fsmSnapshot struct {
+	data []byte
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.data); err != nil {
+		sink.Cancel()
+		return fmt.Errorf("server: failed to write raft snapshot: %w", err)
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+// registry state served over HTTP; implemented by Store for a single node and by Cluster for a replicated one
+type Registry interface {
+	Register(instance api.ServiceInstance) (api.Lease, error)
+	Heartbeat(instanceID string) (api.Lease, error)
+	Heartbeats(instanceIDs []string) ([]api.HeartbeatResult, error)
+	Deregister(instanceID string) error
+	Healthy(serviceName string) []api.ServiceInstance
+}
+
+// serves the registry HTTP API spoken by registry.NewHTTPClient
+type handler struct {
+	store  Registry
+	logger *slog.Logger
+}
+
+// returns an http.Handler serving the registry HTTP API on top of the registry's state
+// a nil logger uses slog.Default()
+func NewHandler(store Registry, logger *slog.Logger) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	h := &handler{store: store, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/services/register", h.register)
+	mux.HandleFunc("POST /api/v1/services/heartbeat/{id}", h.heartbeat)
+	mux.HandleFunc("POST /api/v1/services/heartbeats", h.heartbeats)
+	mux.HandleFunc("DELETE /api/v1/services/deregister/{id}", h.deregister)
+	mux.HandleFunc("GET /api/v1/services/{name}/healthy", h.healthy)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+func (h *handler) register(w http.ResponseWriter, r *http.Request) {
+	var instance api.ServiceInstance
+	if err := json.NewDecoder(r.Body).Decode(&instance); err != nil {
+		http.Error(w, "invalid instance: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	lease, err := h.store.Register(instance)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.logger.Info("instance registered", "service", instance.ServiceName, "instance_id", instance.ID, "lease_id", lease.ID)
+	writeJSON(w, http.StatusCreated, lease)
+}
+
+func (h *handler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	lease, err := h.store.Heartbeat(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lease)
+}
+
+func (h *handler) heartbeats(w http.ResponseWriter, r *http.Request) {
+	var req api.HeartbeatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid heartbeats request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	results, err := h.store.Heartbeats(req.InstanceIDs)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.HeartbeatsResponse{Results: results})
+}
+
+func (h *handler) deregister(w http.ResponseWriter, r *http.Request) {
+	instanceID := r.PathValue("id")
+	if err := h.store.Deregister(instanceID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.logger.Info("instance deregistered", "instance_id", instanceID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) healthy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.store.Healthy(r.PathValue("name")))
+}
+
+// maps a store error onto the status the HTTP client classifies it by
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrLeaseExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		// the change could not be made durable, which the client treats as the registry being unavailable
+		h.logger.Error("failed to persist registry change", "error", err)
+		http.Error(w, "registry storage unavailable", http.StatusServiceUnavailable)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
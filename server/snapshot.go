@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// version of the snapshot file format; snapshots written in any other version are refused rather than misread
+const snapshotVersion = 1
+
+const snapshotFileName = "snapshot.json"
+
+// contents of the snapshot file: the state after applying every event up to LastSeq
+type snapshotFile struct {
+	Version int      `json:"version"`
+	LastSeq uint64   `json:"lastSeq"`
+	Records []record `json:"records"`
+}
+
+// reads the snapshot in dir into a new state; a missing snapshot yields an empty state
+func readSnapshot(dir string) (*state, error) {
+	st := newState()
+	path := filepath.Join(dir, snapshotFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		return nil, fmt.Errorf("server: failed to read snapshot %s: %w", path, err)
+	}
+
+	st, err = decodeSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to load snapshot %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// decodes a snapshot into a new state
+func decodeSnapshot(data []byte) (*state, error) {
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("server: failed to decode snapshot: %w", err)
+	}
+	if file.Version != snapshotVersion {
+		return nil, fmt.Errorf("server: unsupported snapshot format version %d, expected %d", file.Version, snapshotVersion)
+	}
+
+	st := newState()
+	for _, r := range file.Records {
+		st.records[r.Instance.ID] = &record{Instance: r.Instance, LeaseID: r.LeaseID, ExpiresAt: r.ExpiresAt}
+	}
+	st.lastSeq = file.LastSeq
+	return st, nil
+}
+
+// encodes the state as a snapshot
+func encodeSnapshot(st *state) ([]byte, error) {
+	file := snapshotFile{Version: snapshotVersion, LastSeq: st.lastSeq, Records: make([]record, 0, len(st.records))}
+	for _, r := range st.records {
+		file.Records = append(file.Records, *r)
+	}
+	sort.Slice(file.Records, func(i, j int) bool { return file.Records[i].Instance.ID < file.Records[j].Instance.ID })
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to marshal snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// writes the state as the snapshot in dir, replacing the previous snapshot atomically
+func writeSnapshot(dir string, st *state) error {
+	data, err := encodeSnapshot(st)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, snapshotFileName), data)
+}
+
+// writes data to a temporary file next to path and renames it over path, so that a crash leaves either the old or the new contents
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("server: failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("server: failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("server: failed to sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("server: failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("server: failed to replace %s: %w", path, err)
+	}
+	return syncDir(dir)
+}
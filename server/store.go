@@ -0,0 +1,428 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+var (
+	// returned for instances the registry has no record of
+	ErrNotFound = errors.New("server: instance not registered")
+	// returned for heartbeats of instances whose lease ran out, which must register again
+	ErrLeaseExpired = errors.New("server: lease expired")
+	// returned for instances missing the fields the registry needs
+	ErrInvalid = errors.New("server: invalid instance")
+)
+
+// config for the registry server's store
+type Config struct {
+	// directory holding the snapshot and write-ahead log; state is kept in memory only and lost on restart when empty
+	DataDir string
+	// TTL of the leases granted to registered instances
+	LeaseTTL time.Duration
+	// fsyncs every WAL append before acknowledging the change; without it a machine crash may lose the latest changes
+	SyncWrites bool
+	// how often a snapshot is taken, compacting the WAL
+	SnapshotInterval time.Duration
+	// number of events after which a snapshot is taken regardless of SnapshotInterval; 0 disables the threshold
+	SnapshotThreshold int
+	// how often expired leases are removed
+	ExpiryInterval time.Duration
+	// receives the store's structured logs; slog.Default() is used when nil
+	Logger *slog.Logger
+	// replicates the state across a Raft cluster when set, see OpenCluster; DataDir then holds the Raft log and snapshots
+	Cluster *ClusterConfig
+}
+
+// returns a new Config with defaults
+func NewDefaultConfig() *Config {
+	return &Config{
+		LeaseTTL:          30 * time.Second,
+		SyncWrites:        true,
+		SnapshotInterval:  5 * time.Minute,
+		SnapshotThreshold: 10000,
+		ExpiryInterval:    time.Second,
+	}
+}
+
+// holds the registered instances and their leases
+// every change is appended to the write-ahead log before it is applied, and recovering replays the log on top of the latest snapshot
+type Store struct {
+	config *Config
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	state *state
+	wal   *walSegment // nil when the store is not persisted, or when a snapshot failed to start a new segment
+	// events appended since the last snapshot
+	unsnapshotted int
+	// set once the WAL could not be brought back to its acknowledged events, after which every change is refused
+	failed error
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// opens the store, recovering its state from DataDir, and starts expiring leases and taking periodic snapshots
+func Open(cfg *Config) (*Store, error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Cluster != nil {
+		return nil, fmt.Errorf("server: config describes a cluster node, which is opened with OpenCluster")
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	s := &Store{
+		config: cfg,
+		logger: logger,
+		state:  newState(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if cfg.DataDir != "" {
+		if err := s.recover(); err != nil {
+			return nil, err
+		}
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// checks that the config holds usable values
+func validateConfig(cfg *Config) error {
+	if cfg == nil {
+		return fmt.Errorf("server: config cannot be nil")
+	}
+	if cfg.LeaseTTL < time.Second {
+		return fmt.Errorf("server: LeaseTTL must be at least a second")
+	}
+	if cfg.DataDir != "" && cfg.SnapshotInterval <= 0 {
+		return fmt.Errorf("server: SnapshotInterval must be a positive duration")
+	}
+	if cfg.SnapshotThreshold < 0 {
+		return fmt.Errorf("server: SnapshotThreshold must be non-negative")
+	}
+	if cfg.ExpiryInterval <= 0 {
+		return fmt.Errorf("server: ExpiryInterval must be a positive duration")
+	}
+	return nil
+}
+
+// rebuilds the state from the snapshot and the WAL segments following it, then takes a fresh snapshot
+// leases are extended by a TTL from now, so that instances which were heartbeating before the restart can carry on
+// instead of all registering again at once
+func (s *Store) recover() error {
+	dir := s.config.DataDir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("server: failed to create data directory %s: %w", dir, err)
+	}
+
+	st, err := readSnapshot(dir)
+	if err != nil {
+		return err
+	}
+	snapshotSeq := st.lastSeq
+
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return err
+	}
+	replayed := 0
+	for i, segment := range segments {
+		events, offset, torn, err := readWALSegment(segment)
+		if err != nil {
+			return err
+		}
+		if torn {
+			if i != len(segments)-1 {
+				return fmt.Errorf("server: WAL segment %s is corrupt at offset %d and is followed by later segments", segment, offset)
+			}
+			// only the last record can be torn by a crash mid-append; it was never acknowledged, so it is dropped
+			s.logger.Warn("truncating torn record at the end of the WAL", "segment", segment, "offset", offset)
+			if err := os.Truncate(segment, offset); err != nil {
+				return fmt.Errorf("server: failed to truncate WAL segment %s: %w", segment, err)
+			}
+		}
+		for _, e := range events {
+			if e.Seq <= st.lastSeq {
+				// already covered by the snapshot, left behind by a crash before the segment was removed
+				continue
+			}
+			st.apply(e)
+			replayed++
+		}
+	}
+
+	graceUntil := time.Now().Add(s.config.LeaseTTL)
+	for _, r := range st.records {
+		if r.ExpiresAt.Before(graceUntil) {
+			r.ExpiresAt = graceUntil
+		}
+	}
+	s.state = st
+	s.logger.Info("recovered registry state", "data_dir", dir, "snapshot_seq", snapshotSeq, "replayed_events", replayed, "instances", len(st.records))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// writes a snapshot of the current state, then starts a new WAL segment and removes the segments the snapshot covers
+// the caller holds mu
+func (s *Store) snapshotLocked() error {
+	dir := s.config.DataDir
+	if err := writeSnapshot(dir, s.state); err != nil {
+		return err
+	}
+
+	if s.wal != nil {
+		if err := s.wal.close(); err != nil {
+			s.logger.Warn("failed to close WAL segment", "error", err)
+		}
+		s.wal = nil
+	}
+	wal, err := createWALSegment(dir, s.state.lastSeq+1, s.config.SyncWrites)
+	if err != nil {
+		return err
+	}
+	s.wal = wal
+	s.unsnapshotted = 0
+
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return err
+	}
+	current := filepath.Join(dir, walSegmentName(s.state.lastSeq+1))
+	for _, segment := range segments {
+		if segment == current {
+			continue
+		}
+		if err := os.Remove(segment); err != nil {
+			s.logger.Warn("failed to remove compacted WAL segment", "segment", segment, "error", err)
+		}
+	}
+	return syncDir(dir)
+}
+
+// takes a snapshot now, compacting the WAL; does nothing when the store is not persisted
+func (s *Store) Snapshot() error {
+	if s.config.DataDir == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// logs and applies an event, assigning its sequence number; the caller holds mu
+// the event is not applied if it could not be logged, so the state never holds changes a restart would lose
+func (s *Store) commitLocked(e Event) error {
+	if s.failed != nil {
+		return fmt.Errorf("server: store refuses changes since its WAL failed: %w", s.failed)
+	}
+	e.Seq = s.state.lastSeq + 1
+	if s.config.DataDir != "" {
+		if err := s.appendLocked(e); err != nil {
+			return err
+		}
+	}
+	// the caller has checked the event applies, it cannot fail here
+	s.state.apply(e)
+
+	s.unsnapshotted++
+	if s.config.DataDir != "" && s.config.SnapshotThreshold > 0 && s.unsnapshotted >= s.config.SnapshotThreshold {
+		if err := s.snapshotLocked(); err != nil {
+			// the change itself is durable in the WAL, the next snapshot attempt compacts it
+			s.logger.Warn("failed to take snapshot", "error", err)
+		}
+	}
+	return nil
+}
+
+// appends an event to the WAL; the caller holds mu
+// an append that failed is cut off the segment; when that fails as well, a snapshot of the state without the event replaces the segment,
+// and if even that fails the store is marked failed, since any later event could be lost behind the failed append on recovery
+func (s *Store) appendLocked(e Event) error {
+	if s.wal == nil {
+		if err := s.snapshotLocked(); err != nil {
+			return err
+		}
+	}
+
+	err := s.wal.append(e)
+	if err == nil || !errors.Is(err, errWALTorn) {
+		return err
+	}
+	if snapshotErr := s.snapshotLocked(); snapshotErr != nil {
+		s.failed = err
+		s.logger.Error("failed to replace WAL segment holding a failed append, refusing further changes", "error", err, "snapshot_error", snapshotErr)
+		return err
+	}
+	s.logger.Warn("replaced WAL segment holding a failed append with a snapshot", "error", err)
+	return err
+}
+
+// registers an instance, replacing any earlier registration of its ID, and grants it a new lease
+func (s *Store) Register(instance api.ServiceInstance) (api.Lease, error) {
+	if instance.ID == "" || instance.ServiceName == "" {
+		return api.Lease{}, fmt.Errorf("%w: id and serviceName must be set", ErrInvalid)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := Event{
+		Type:       EventRegister,
+		Instance:   &instance,
+		InstanceID: instance.ID,
+		// lease IDs are derived from the registering event, which keeps them unique across restarts
+		LeaseID:   strconv.FormatUint(s.state.lastSeq+1, 16),
+		ExpiresAt: time.Now().Add(s.config.LeaseTTL),
+	}
+	if err := s.commitLocked(e); err != nil {
+		return api.Lease{}, err
+	}
+	return s.lease(e.LeaseID), nil
+}
+
+// renews the lease of a registered instance
+func (s *Store) Heartbeat(instanceID string) (api.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heartbeatLocked(instanceID, time.Now())
+}
+
+func (s *Store) heartbeatLocked(instanceID string, now time.Time) (api.Lease, error) {
+	r, ok := s.state.records[instanceID]
+	if !ok {
+		return api.Lease{}, fmt.Errorf("%w: %s", ErrNotFound, instanceID)
+	}
+	if !r.ExpiresAt.After(now) {
+		return api.Lease{}, fmt.Errorf("%w: lease %s of instance %s", ErrLeaseExpired, r.LeaseID, instanceID)
+	}
+	if err := s.commitLocked(Event{Type: EventHeartbeat, InstanceID: instanceID, LeaseID: r.LeaseID, ExpiresAt: now.Add(s.config.LeaseTTL)}); err != nil {
+		return api.Lease{}, err
+	}
+	return s.lease(r.LeaseID), nil
+}
+
+// renews the leases of several instances, reporting the outcome of each
+// an error is only returned when a change could not be logged
+func (s *Store) Heartbeats(instanceIDs []string) ([]api.HeartbeatResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	results := make([]api.HeartbeatResult, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		lease, err := s.heartbeatLocked(instanceID, now)
+		switch {
+		case err == nil:
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, Success: true, TTLSeconds: lease.TTLSeconds})
+		case errors.Is(err, ErrNotFound):
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, NotRegistered: true, Message: err.Error()})
+		case errors.Is(err, ErrLeaseExpired):
+			results = append(results, api.HeartbeatResult{InstanceID: instanceID, LeaseExpired: true, Message: err.Error()})
+		default:
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// removes a registered instance
+func (s *Store) Deregister(instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.records[instanceID]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, instanceID)
+	}
+	return s.commitLocked(Event{Type: EventDeregister, InstanceID: instanceID})
+}
+
+// returns the instances of a service whose leases have not run out, ordered by ID
+func (s *Store) Healthy(serviceName string) []api.ServiceInstance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.healthy(serviceName, time.Now())
+}
+
+func (s *Store) lease(leaseID string) api.Lease {
+	return api.Lease{ID: leaseID, TTLSeconds: int64(s.config.LeaseTTL / time.Second)}
+}
+
+// removes instances whose leases ran out
+func (s *Store) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.state.expired(time.Now()) {
+		if err := s.commitLocked(Event{Type: EventExpire, InstanceID: r.Instance.ID, LeaseID: r.LeaseID}); err != nil {
+			s.logger.Warn("failed to expire instance", "instance_id", r.Instance.ID, "error", err)
+			return
+		}
+		s.logger.Info("instance lease expired", "service", r.Instance.ServiceName, "instance_id", r.Instance.ID)
+	}
+}
+
+// expires leases and takes periodic snapshots until the store is closed
+func (s *Store) run() {
+	defer close(s.done)
+	expiry := time.NewTicker(s.config.ExpiryInterval)
+	defer expiry.Stop()
+
+	var snapshots <-chan time.Time
+	if s.config.DataDir != "" {
+		ticker := time.NewTicker(s.config.SnapshotInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-expiry.C:
+			s.expire()
+		case <-snapshots:
+			if err := s.Snapshot(); err != nil {
+				s.logger.Warn("failed to take snapshot", "error", err)
+			}
+		}
+	}
+}
+
+// stops expiring leases and, when persisted, takes a final snapshot and closes the WAL
+func (s *Store) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		if s.config.DataDir == "" {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err = s.snapshotLocked(); err != nil {
+			return
+		}
+		err = s.wal.close()
+		s.wal = nil
+	})
+	return err
+}
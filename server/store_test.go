@@ -0,0 +1,351 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lokeshllkumar/flux/api"
+)
+
+func testStoreConfig(dir string) *Config {
+	cfg := NewDefaultConfig()
+	cfg.DataDir = dir
+	cfg.SnapshotInterval = time.Hour
+	cfg.SnapshotThreshold = 0
+	cfg.ExpiryInterval = time.Hour
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return cfg
+}
+
+func openTestStore(t *testing.T, cfg *Config) *Store {
+	t.Helper()
+	s, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	return s
+}
+
+// stops the store's background work and closes its WAL without the final snapshot Close takes, as a crash would
+func abandon(s *Store) {
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.wal != nil {
+			s.wal.close()
+			s.wal = nil
+		}
+	})
+}
+
+func mustRegister(t *testing.T, s *Store, id string) api.Lease {
+	t.Helper()
+	lease, err := s.Register(api.ServiceInstance{ID: id, ServiceName: "svc", Host: "10.0.0.1", Port: 8000})
+	if err != nil {
+		t.Fatalf("failed to register %s: %v", id, err)
+	}
+	return lease
+}
+
+func healthyIDs(s *Store) []string {
+	var ids []string
+	for _, instance := range s.Healthy("svc") {
+		ids = append(ids, instance.ID)
+	}
+	return ids
+}
+
+// returns the path of the only WAL segment in dir
+func onlySegment(t *testing.T, dir string) string {
+	t.Helper()
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		t.Fatalf("failed to list WAL segments: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("expected a single WAL segment, got %v", segments)
+	}
+	return segments[0]
+}
+
+func TestStoreRecoversFromWALWithoutClose(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, testStoreConfig(dir))
+	a := mustRegister(t, s, "a")
+	mustRegister(t, s, "b")
+	if _, err := s.Heartbeat("a"); err != nil {
+		t.Fatalf("heartbeat failed: %v", err)
+	}
+	if err := s.Deregister("b"); err != nil {
+		t.Fatalf("deregister failed: %v", err)
+	}
+	mustRegister(t, s, "c")
+	abandon(s)
+
+	s = openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a", "c"}) {
+		t.Fatalf("expected a and c to be recovered, got %v", ids)
+	}
+	if s.state.lastSeq != 5 {
+		t.Fatalf("expected the sequence to resume after the 5 logged events, got %d", s.state.lastSeq)
+	}
+	if lease, err := s.Heartbeat("a"); err != nil || lease.ID != a.ID {
+		t.Fatalf("expected a's lease %s to survive the restart, got %+v, %v", a.ID, lease, err)
+	}
+	if lease := mustRegister(t, s, "d"); lease.ID != "7" {
+		t.Fatalf("expected lease IDs to carry on from the recovered sequence, got %s", lease.ID)
+	}
+}
+
+func TestStoreRecoveryDropsTornFinalRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, testStoreConfig(dir))
+	mustRegister(t, s, "a")
+	mustRegister(t, s, "b")
+	abandon(s)
+
+	// a crash mid-append leaves a header promising more payload than was written
+	segment := onlySegment(t, dir)
+	file, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open WAL segment: %v", err)
+	}
+	file.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, '{', '"'})
+	file.Close()
+
+	s = openTestStore(t, testStoreConfig(dir))
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Fatalf("expected the intact records to be recovered, got %v", ids)
+	}
+	// changes made after the torn record was dropped survive the next restart
+	mustRegister(t, s, "c")
+	abandon(s)
+
+	s = openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("expected a, b and c to be recovered, got %v", ids)
+	}
+}
+
+func TestStoreRecoveryStopsAtCRCMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, testStoreConfig(dir))
+	mustRegister(t, s, "a")
+	mustRegister(t, s, "b")
+	abandon(s)
+
+	// flip the last byte of b's payload, leaving its length intact
+	segment := onlySegment(t, dir)
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("failed to read WAL segment: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(segment, data, 0o644); err != nil {
+		t.Fatalf("failed to write WAL segment: %v", err)
+	}
+
+	s = openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a"}) {
+		t.Fatalf("expected only the records before the corrupt one to be recovered, got %v", ids)
+	}
+}
+
+func TestStoreRecoveryRefusesCorruptionBeforeLaterSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, testStoreConfig(dir))
+	mustRegister(t, s, "a")
+	abandon(s)
+
+	// an earlier segment that is corrupt cannot have been torn by a crash, since later segments were written after it
+	if err := os.WriteFile(filepath.Join(dir, walSegmentName(0)), []byte{100, 0, 0, 0}, 0o644); err != nil {
+		t.Fatalf("failed to write WAL segment: %v", err)
+	}
+	if s, err := Open(testStoreConfig(dir)); err == nil {
+		s.Close()
+		t.Fatal("expected a corrupt segment followed by later ones to fail recovery")
+	}
+}
+
+func TestStoreRecoversAcrossSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testStoreConfig(dir)
+	cfg.SnapshotThreshold = 3
+	s := openTestStore(t, cfg)
+	mustRegister(t, s, "a")
+	mustRegister(t, s, "b")
+	mustRegister(t, s, "c") // reaches the threshold, compacting the WAL
+	if segment := onlySegment(t, dir); filepath.Base(segment) != walSegmentName(4) {
+		t.Fatalf("expected the WAL to be compacted into a segment starting at 4, got %s", segment)
+	}
+
+	if err := s.Deregister("b"); err != nil {
+		t.Fatalf("deregister failed: %v", err)
+	}
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	if _, err := s.Heartbeat("a"); err != nil {
+		t.Fatalf("heartbeat failed: %v", err)
+	}
+	mustRegister(t, s, "d")
+	abandon(s)
+
+	snapshot, err := readSnapshot(dir)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	if snapshot.lastSeq != 4 {
+		t.Fatalf("expected the snapshot to cover the first 4 events, got %d", snapshot.lastSeq)
+	}
+
+	s = openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a", "c", "d"}) {
+		t.Fatalf("expected a, c and d to be recovered from the snapshot and the WAL after it, got %v", ids)
+	}
+	if s.state.lastSeq != 6 {
+		t.Fatalf("expected the sequence to resume at 6, got %d", s.state.lastSeq)
+	}
+}
+
+func TestStoreSkipsEventsCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, testStoreConfig(dir))
+	mustRegister(t, s, "a")
+	mustRegister(t, s, "b")
+	abandon(s)
+
+	// a crash between writing a snapshot and removing the segments it covers leaves both behind
+	segment := onlySegment(t, dir)
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("failed to read WAL segment: %v", err)
+	}
+	st, err := readSnapshot(dir)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	st.apply(Event{Seq: 1, Type: EventRegister, Instance: &api.ServiceInstance{ID: "a", ServiceName: "svc"}, InstanceID: "a", LeaseID: "1", ExpiresAt: time.Now().Add(time.Hour)})
+	st.apply(Event{Seq: 2, Type: EventDeregister, InstanceID: "a"})
+	if err := writeSnapshot(dir, st); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if err := os.WriteFile(segment, data, 0o644); err != nil {
+		t.Fatalf("failed to write WAL segment: %v", err)
+	}
+
+	s = openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	if ids := healthyIDs(s); len(ids) != 0 {
+		t.Fatalf("expected the events covered by the snapshot not to be replayed, got %v", ids)
+	}
+}
+
+func TestWALSegmentUndoesFailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	w, err := createWALSegment(dir, 1, true)
+	if err != nil {
+		t.Fatalf("failed to create WAL segment: %v", err)
+	}
+	defer w.close()
+	if err := w.append(Event{Seq: 1, Type: EventDeregister, InstanceID: "a"}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	// bytes of an append that failed partway are cut off, and the next append takes their place
+	w.file.Write([]byte{100, 0, 0, 0, 1, 2})
+	failure := errors.New("write failed")
+	if err := w.undo(failure); err != failure {
+		t.Fatalf("expected the append's own error after cutting it off, got %v", err)
+	}
+	if err := w.append(Event{Seq: 2, Type: EventDeregister, InstanceID: "b"}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	events, _, torn, err := readWALSegment(filepath.Join(dir, walSegmentName(1)))
+	if err != nil {
+		t.Fatalf("failed to read WAL segment: %v", err)
+	}
+	if torn || len(events) != 2 || events[0].InstanceID != "a" || events[1].InstanceID != "b" {
+		t.Fatalf("expected both events and nothing else, got %+v (torn %v)", events, torn)
+	}
+}
+
+func TestStoreReplacesSegmentThatCannotBeCutBack(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	mustRegister(t, s, "a")
+
+	// with the file closed, neither the append nor cutting it off can succeed
+	s.wal.file.Close()
+	if _, err := s.Register(api.ServiceInstance{ID: "b", ServiceName: "svc"}); !errors.Is(err, errWALTorn) {
+		t.Fatalf("expected the append to fail, got %v", err)
+	}
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a"}) {
+		t.Fatalf("expected the failed registration not to be applied, got %v", ids)
+	}
+
+	// a snapshot replaced the segment, so the store carries on
+	mustRegister(t, s, "c")
+	abandon(s)
+	s = openTestStore(t, testStoreConfig(dir))
+	defer s.Close()
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a", "c"}) {
+		t.Fatalf("expected a and c to be recovered, got %v", ids)
+	}
+}
+
+func TestStoreRefusesChangesOnceWALCannotBeRepaired(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	s := openTestStore(t, testStoreConfig(dir))
+	defer abandon(s)
+	mustRegister(t, s, "a")
+
+	// without its directory, no snapshot can replace the segment either
+	s.wal.file.Close()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("failed to remove data directory: %v", err)
+	}
+	if _, err := s.Register(api.ServiceInstance{ID: "b", ServiceName: "svc"}); err == nil {
+		t.Fatal("expected the append to fail")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to recreate data directory: %v", err)
+	}
+	if _, err := s.Register(api.ServiceInstance{ID: "c", ServiceName: "svc"}); !errors.Is(err, errWALTorn) {
+		t.Fatalf("expected the failed store to refuse changes, got %v", err)
+	}
+	if err := s.Deregister("a"); !errors.Is(err, errWALTorn) {
+		t.Fatalf("expected the failed store to refuse changes, got %v", err)
+	}
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a"}) {
+		t.Fatalf("expected the state to be left as acknowledged, got %v", ids)
+	}
+}
+
+func TestStoreWithoutDataDirKeepsStateInMemory(t *testing.T) {
+	cfg := testStoreConfig("")
+	s := openTestStore(t, cfg)
+	defer s.Close()
+	mustRegister(t, s, "a")
+	if ids := healthyIDs(s); !slices.Equal(ids, []string{"a"}) {
+		t.Fatalf("expected a to be registered, got %v", ids)
+	}
+	if _, err := s.Heartbeat("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
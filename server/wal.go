@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// each WAL record is framed by its payload length and a CRC-32C of the payload, both little-endian uint32s,
+// so that a record torn by a crash mid-write is detected rather than replayed
+const walHeaderSize = 8
+
+// upper bound on a record's payload, guarding against reading a corrupt length as a huge allocation
+const maxWALRecordSize = 16 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// returned by appends that failed and could not be cut off the segment, which may then hold a torn record or one that was never acknowledged
+var errWALTorn = errors.New("server: WAL segment holds a failed append")
+
+// WAL segments are named after the sequence number of their first event, so that sorting their names orders them
+const (
+	walSegmentPrefix = "wal-"
+	walSegmentSuffix = ".log"
+)
+
+func walSegmentName(firstSeq uint64) string {
+	return fmt.Sprintf("%s%016x%s", walSegmentPrefix, firstSeq, walSegmentSuffix)
+}
+
+// segment of the write-ahead log open for appending
+type walSegment struct {
+	file *os.File
+	sync bool
+	// length of the records appended so far, where a failed append is cut off
+	size int64
+}
+
+// creates a new, empty segment whose first event will be firstSeq
+func createWALSegment(dir string, firstSeq uint64, sync bool) (*walSegment, error) {
+	path := filepath.Join(dir, walSegmentName(firstSeq))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to create WAL segment %s: %w", path, err)
+	}
+	if err := syncDir(dir); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &walSegment{file: file, sync: sync}, nil
+}
+
+// appends an event to the segment; the event is durable once append returns when the segment syncs writes
+func (w *walSegment) append(e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("server: failed to marshal WAL event: %w", err)
+	}
+
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[walHeaderSize:], payload)
+
+	if _, err := w.file.Write(record); err != nil {
+		return w.undo(fmt.Errorf("server: failed to append to WAL segment %s: %w", w.file.Name(), err))
+	}
+	if w.sync {
+		if err := w.file.Sync(); err != nil {
+			return w.undo(fmt.Errorf("server: failed to sync WAL segment %s: %w", w.file.Name(), err))
+		}
+	}
+	w.size += int64(len(record))
+	return nil
+}
+
+// cuts a failed append off the segment and returns err; a torn record left behind would make recovery drop every later event, and a
+// complete one that was never acknowledged would be replayed with the sequence number of the next event
+// returns an error wrapping errWALTorn if the segment could not be cut back
+func (w *walSegment) undo(err error) error {
+	if truncateErr := w.file.Truncate(w.size); truncateErr != nil {
+		return fmt.Errorf("%w: %w, and truncating it failed: %w", errWALTorn, err, truncateErr)
+	}
+	if w.sync {
+		if syncErr := w.file.Sync(); syncErr != nil {
+			return fmt.Errorf("%w: %w, and syncing its truncation failed: %w", errWALTorn, err, syncErr)
+		}
+	}
+	return err
+}
+
+func (w *walSegment) close() error {
+	return w.file.Close()
+}
+
+// returns the paths of the WAL segments in dir, oldest first
+func listWALSegments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to list data directory %s: %w", dir, err)
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, walSegmentPrefix) || !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walSegmentPrefix), walSegmentSuffix), 16, 64); err != nil {
+			continue
+		}
+		segments = append(segments, filepath.Join(dir, name))
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// reads the events of a WAL segment up to the first incomplete or corrupt record
+// returns the events, the offset just past the last intact record, and whether anything followed it
+func readWALSegment(path string) ([]Event, int64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("server: failed to open WAL segment %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var events []Event
+	var offset int64
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(file, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, offset, false, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return events, offset, true, nil
+			}
+			return nil, 0, false, fmt.Errorf("server: failed to read WAL segment %s: %w", path, err)
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size == 0 || size > maxWALRecordSize {
+			return events, offset, true, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(file, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return events, offset, true, nil
+			}
+			return nil, 0, false, fmt.Errorf("server: failed to read WAL segment %s: %w", path, err)
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return events, offset, true, nil
+		}
+
+		var e Event
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return events, offset, true, nil
+		}
+		events = append(events, e)
+		offset += int64(walHeaderSize) + int64(size)
+	}
+}
+
+// fsyncs a directory so that files created, renamed or removed in it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("server: failed to open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("server: failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}